@@ -0,0 +1,323 @@
+package quote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"time"
+)
+
+// ArrowIPC - convert Quote struct to an Apache Arrow IPC file holding one
+// record batch with a timestamp date column and float64 price/volume
+// columns, the symbol is kept in the schema metadata
+func (q Quote) ArrowIPC() []byte {
+	return arrowFile(q.arrowColumns(), len(q.Date), [][2]string{{"symbol", q.Symbol}})
+}
+
+// WriteArrowIPC - write Quote struct to Arrow IPC file
+func (q Quote) WriteArrowIPC(filename string) error {
+	if filename == "" {
+		filename = q.Symbol + ".arrow"
+	}
+	return os.WriteFile(filename, q.ArrowIPC(), 0644)
+}
+
+// ArrowIPC - convert Quotes to an Arrow IPC file, one record batch with a
+// leading symbol column followed by the bars of each quote in turn
+func (q Quotes) ArrowIPC() []byte {
+	var all Quote
+	var symbols []string
+	for _, quote := range q {
+		for range quote.Date {
+			symbols = append(symbols, quote.Symbol)
+		}
+		all.Date = append(all.Date, quote.Date...)
+		all.Open = append(all.Open, quote.Open...)
+		all.High = append(all.High, quote.High...)
+		all.Low = append(all.Low, quote.Low...)
+		all.Close = append(all.Close, quote.Close...)
+		all.Volume = append(all.Volume, quote.Volume...)
+	}
+	cols := append([]arrowColumn{{name: "symbol", kind: arrowUtf8, strings: symbols}}, all.arrowColumns()...)
+	return arrowFile(cols, len(symbols), nil)
+}
+
+// WriteArrowIPC - write Quotes to Arrow IPC file
+func (q Quotes) WriteArrowIPC(filename string) error {
+	if filename == "" {
+		filename = "quotes.arrow"
+	}
+	return os.WriteFile(filename, q.ArrowIPC(), 0644)
+}
+
+// arrow column types, numbered as in the Type union of Schema.fbs
+const (
+	arrowDouble    = 3
+	arrowUtf8      = 5
+	arrowTimestamp = 10
+)
+
+type arrowColumn struct {
+	name    string
+	kind    byte
+	strings []string
+	times   []time.Time
+	floats  []float64
+}
+
+func (q Quote) arrowColumns() []arrowColumn {
+	return []arrowColumn{
+		{name: "date", kind: arrowTimestamp, times: q.Date},
+		{name: "open", kind: arrowDouble, floats: q.Open},
+		{name: "high", kind: arrowDouble, floats: q.High},
+		{name: "low", kind: arrowDouble, floats: q.Low},
+		{name: "close", kind: arrowDouble, floats: q.Close},
+		{name: "volume", kind: arrowDouble, floats: q.Volume},
+	}
+}
+
+// arrowFile - encode columns as an Arrow IPC file: magic, schema message,
+// one record batch message, end of stream marker and the footer
+func arrowFile(cols []arrowColumn, rows int, meta [][2]string) []byte {
+	le := binary.LittleEndian
+	var body, nodes, buffers []byte
+	buffer := func(data []byte) {
+		buffers = le.AppendUint64(buffers, uint64(len(body)))
+		buffers = le.AppendUint64(buffers, uint64(len(data)))
+		body = append(body, data...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+	}
+	for _, c := range cols {
+		nodes = le.AppendUint64(nodes, uint64(rows))
+		nodes = le.AppendUint64(nodes, 0)
+		buffer(nil) // no validity bitmap, columns never hold nulls
+		switch c.kind {
+		case arrowUtf8:
+			offsets := le.AppendUint32(nil, 0)
+			var data []byte
+			for _, s := range c.strings[:rows] {
+				data = append(data, s...)
+				offsets = le.AppendUint32(offsets, uint32(len(data)))
+			}
+			buffer(offsets)
+			buffer(data)
+		case arrowTimestamp:
+			data := make([]byte, 0, 8*rows)
+			for _, t := range c.times[:rows] {
+				data = le.AppendUint64(data, uint64(t.UnixMilli()))
+			}
+			buffer(data)
+		default:
+			data := make([]byte, 0, 8*rows)
+			for _, f := range c.floats[:rows] {
+				data = le.AppendUint64(data, math.Float64bits(f))
+			}
+			buffer(data)
+		}
+	}
+	batch := fbTable(
+		fbScalar(8, uint64(rows)),
+		fbRef(fbStructs(len(cols), nodes)),
+		fbRef(fbStructs(len(buffers)/16, buffers)),
+	)
+
+	var out bytes.Buffer
+	out.WriteString("ARROW1\x00\x00")
+	schema := arrowSchema(cols, meta)
+	arrowMessage(&out, 1, schema, nil)
+	offset := out.Len()
+	metaLen := arrowMessage(&out, 3, batch, body)
+	out.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+
+	block := le.AppendUint64(nil, uint64(offset))
+	block = le.AppendUint32(block, uint32(metaLen))
+	block = le.AppendUint32(block, 0)
+	block = le.AppendUint64(block, uint64(len(body)))
+	footer := fbFinish(fbTable(
+		fbScalar(2, arrowVersion),
+		fbRef(schema),
+		fbRef(fbStructs(0, nil)),
+		fbRef(fbStructs(1, block)),
+	))
+	out.Write(footer)
+	out.Write(le.AppendUint32(nil, uint32(len(footer))))
+	out.WriteString("ARROW1")
+	return out.Bytes()
+}
+
+// metadata version V5
+const arrowVersion = 4
+
+// arrowMessage - write an encapsulated message, returning the length of
+// its prefix and metadata
+func arrowMessage(out *bytes.Buffer, headerType byte, header *fbNode, body []byte) int {
+	meta := fbFinish(fbTable(
+		fbScalar(2, arrowVersion),
+		fbScalar(1, uint64(headerType)),
+		fbRef(header),
+		fbScalar(8, uint64(len(body))),
+	))
+	le := binary.LittleEndian
+	out.Write(le.AppendUint32(nil, 0xffffffff))
+	out.Write(le.AppendUint32(nil, uint32(len(meta))))
+	out.Write(meta)
+	out.Write(body)
+	return 8 + len(meta)
+}
+
+func arrowSchema(cols []arrowColumn, meta [][2]string) *fbNode {
+	fields := make([]*fbNode, len(cols))
+	for i, c := range cols {
+		var typ *fbNode
+		switch c.kind {
+		case arrowUtf8:
+			typ = fbTable()
+		case arrowTimestamp:
+			typ = fbTable(fbScalar(2, 1), fbRef(fbString("UTC"))) // milliseconds
+		default:
+			typ = fbTable(fbScalar(2, 2)) // double precision
+		}
+		fields[i] = fbTable(
+			fbRef(fbString(c.name)),
+			fbScalar(1, 0), // not nullable
+			fbScalar(1, uint64(c.kind)),
+			fbRef(typ),
+			fbField{},
+			fbRef(fbVector()),
+		)
+	}
+	pairs := make([]*fbNode, len(meta))
+	for i, kv := range meta {
+		pairs[i] = fbTable(fbRef(fbString(kv[0])), fbRef(fbString(kv[1])))
+	}
+	return fbTable(
+		fbScalar(2, 0), // little endian
+		fbRef(fbVector(fields...)),
+		fbRef(fbVector(pairs...)),
+	)
+}
+
+// minimal flatbuffers encoder for the Arrow metadata, nodes are laid out
+// parent first so every offset points forward as the format requires
+type fbNode struct {
+	kind   int
+	fields []fbField // table fields by id
+	str    string
+	elems  []*fbNode // vector of tables
+	count  int       // vector of 8 byte aligned structs
+	data   []byte
+}
+
+const (
+	fbTableNode = iota
+	fbStringNode
+	fbVectorNode
+	fbStructsNode
+)
+
+// fbField - table field, a scalar of size bytes or an offset to ref,
+// size 0 leaves the field out
+type fbField struct {
+	size  int
+	value uint64
+	ref   *fbNode
+}
+
+func fbScalar(size int, value uint64) fbField { return fbField{size: size, value: value} }
+func fbRef(n *fbNode) fbField                 { return fbField{size: 4, ref: n} }
+
+func fbTable(fields ...fbField) *fbNode {
+	return &fbNode{kind: fbTableNode, fields: fields}
+}
+
+func fbString(s string) *fbNode {
+	return &fbNode{kind: fbStringNode, str: s}
+}
+
+func fbVector(elems ...*fbNode) *fbNode {
+	return &fbNode{kind: fbVectorNode, elems: elems}
+}
+
+func fbStructs(count int, data []byte) *fbNode {
+	return &fbNode{kind: fbStructsNode, count: count, data: data}
+}
+
+// fbFinish - lay out root and everything it references, padded to 8 bytes
+func fbFinish(root *fbNode) []byte {
+	b := fbBuilder{buf: make([]byte, 4)}
+	binary.LittleEndian.PutUint32(b.buf, uint32(b.place(root)))
+	b.align(8, 0)
+	return b.buf
+}
+
+type fbBuilder struct {
+	buf []byte
+}
+
+// align - pad until len+extra is a multiple of n
+func (b *fbBuilder) align(n, extra int) {
+	for (len(b.buf)+extra)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) place(n *fbNode) int {
+	le := binary.LittleEndian
+	switch n.kind {
+	case fbStringNode:
+		b.align(4, 0)
+		pos := len(b.buf)
+		b.buf = le.AppendUint32(b.buf, uint32(len(n.str)))
+		b.buf = append(append(b.buf, n.str...), 0)
+		return pos
+	case fbStructsNode:
+		b.align(8, 4)
+		pos := len(b.buf)
+		b.buf = le.AppendUint32(b.buf, uint32(n.count))
+		b.buf = append(b.buf, n.data...)
+		return pos
+	case fbVectorNode:
+		b.align(4, 0)
+		pos := len(b.buf)
+		b.buf = le.AppendUint32(b.buf, uint32(len(n.elems)))
+		b.buf = append(b.buf, make([]byte, 4*len(n.elems))...)
+		for i, elem := range n.elems {
+			at := pos + 4 + 4*i
+			child := b.place(elem)
+			le.PutUint32(b.buf[at:], uint32(child-at))
+		}
+		return pos
+	}
+
+	// table: vtable first, then the table with a signed offset back to it
+	b.align(2, 0)
+	vtable := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4+2*len(n.fields))...)
+	b.align(4, 0)
+	pos := len(b.buf)
+	b.buf = le.AppendUint32(b.buf, uint32(pos-vtable))
+	at := make([]int, len(n.fields))
+	for i, f := range n.fields {
+		if f.size == 0 {
+			continue
+		}
+		b.align(f.size, 0)
+		at[i] = len(b.buf)
+		for s := 0; s < f.size; s++ {
+			b.buf = append(b.buf, byte(f.value>>(8*s)))
+		}
+		le.PutUint16(b.buf[vtable+4+2*i:], uint16(at[i]-pos))
+	}
+	le.PutUint16(b.buf[vtable:], uint16(4+2*len(n.fields)))
+	le.PutUint16(b.buf[vtable+2:], uint16(len(b.buf)-pos))
+	for i, f := range n.fields {
+		if f.ref != nil {
+			child := b.place(f.ref)
+			le.PutUint32(b.buf[at[i]:], uint32(child-at[i]))
+		}
+	}
+	return pos
+}
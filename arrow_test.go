@@ -0,0 +1,174 @@
+package quote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestArrowIPC(t *testing.T) {
+	q := NewQuote("spy", 3)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2021, 1, 4+bar, 0, 0, 0, 0, time.UTC)
+		q.Close[bar] = 372.25 + float64(bar)
+	}
+	data := q.ArrowIPC()
+	equals(t, "ARROW1\x00\x00", string(data[:8]))
+	equals(t, "ARROW1", string(data[len(data)-6:]))
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-10:]))
+	assert(t, footer > 0 && footer%8 == 0 && footer < len(data)-18, "bad footer length %d", footer)
+	for _, name := range []string{"date", "open", "close", "volume", "UTC", "spy"} {
+		assert(t, bytes.Contains(data, []byte(name)), "missing %q in schema", name)
+	}
+
+	// the close column is stored as consecutive little endian doubles
+	var closes []byte
+	for _, c := range q.Close {
+		closes = binary.LittleEndian.AppendUint64(closes, math.Float64bits(c))
+	}
+	assert(t, bytes.Contains(data, closes), "close column not found")
+	millis := binary.LittleEndian.AppendUint64(nil, uint64(q.Date[0].UnixMilli()))
+	assert(t, bytes.Contains(data, millis), "date column not found")
+
+	quotes := Quotes{q, NewQuote("qqq", 0), q}
+	data = quotes.ArrowIPC()
+	assert(t, bytes.Contains(data, []byte("spyspyspyspyspyspy")), "symbol column not found")
+	assert(t, bytes.Contains(data, append(closes, closes...)), "close column not found")
+}
+
+// fbReader - a flatbuffers table read straight from the spec, independent of
+// the encoder, so the test catches offsets the writer gets wrong
+type fbReader struct {
+	buf []byte
+	pos int
+}
+
+func fbRoot(buf []byte) fbReader {
+	return fbReader{buf, int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field - position of field id, 0 when it is left out
+func (r fbReader) field(id int) int {
+	le := binary.LittleEndian
+	vtable := r.pos - int(int32(le.Uint32(r.buf[r.pos:])))
+	if 4+2*id >= int(le.Uint16(r.buf[vtable:])) {
+		return 0
+	}
+	if off := int(le.Uint16(r.buf[vtable+4+2*id:])); off != 0 {
+		return r.pos + off
+	}
+	return 0
+}
+
+func (r fbReader) uint(id, size int) uint64 {
+	var v uint64
+	if p := r.field(id); p != 0 {
+		for s := 0; s < size; s++ {
+			v |= uint64(r.buf[p+s]) << (8 * s)
+		}
+	}
+	return v
+}
+
+func (r fbReader) ref(id int) int {
+	p := r.field(id)
+	return p + int(binary.LittleEndian.Uint32(r.buf[p:]))
+}
+
+func (r fbReader) table(id int) fbReader { return fbReader{r.buf, r.ref(id)} }
+
+func (r fbReader) str(id int) string {
+	p := r.ref(id)
+	return string(r.buf[p+4 : p+4+int(binary.LittleEndian.Uint32(r.buf[p:]))])
+}
+
+// vector - the position of the first element and the element count
+func (r fbReader) vector(id int) (int, int) {
+	p := r.ref(id)
+	return p + 4, int(binary.LittleEndian.Uint32(r.buf[p:]))
+}
+
+// tables - the tables of vector field id
+func (r fbReader) tables(id int) []fbReader {
+	start, n := r.vector(id)
+	tables := make([]fbReader, n)
+	for i := range tables {
+		at := start + 4*i
+		tables[i] = fbReader{r.buf, at + int(binary.LittleEndian.Uint32(r.buf[at:]))}
+	}
+	return tables
+}
+
+func TestArrowIPCLayout(t *testing.T) {
+	le := binary.LittleEndian
+	q := NewQuote("spy", 3)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2021, 1, 4+bar, 0, 0, 0, 0, time.UTC)
+		q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar], q.Volume[bar] = 1, 2, 0.5, 372.25+float64(bar), 100
+	}
+	data := q.ArrowIPC()
+
+	// footer: version, schema, no dictionaries and one record batch block
+	size := int(le.Uint32(data[len(data)-10:]))
+	footer := fbRoot(data[len(data)-10-size : len(data)-10])
+	equals(t, uint64(arrowVersion), footer.uint(0, 2))
+
+	// schema: little endian, the six columns with their types, symbol metadata
+	schema := footer.table(1)
+	equals(t, uint64(0), schema.uint(0, 2))
+	var names []string
+	var kinds []uint64
+	for _, field := range schema.tables(1) {
+		names = append(names, field.str(0))
+		kinds = append(kinds, field.uint(2, 1))
+	}
+	equals(t, []string{"date", "open", "high", "low", "close", "volume"}, names)
+	equals(t, []uint64{arrowTimestamp, arrowDouble, arrowDouble, arrowDouble, arrowDouble, arrowDouble}, kinds)
+	date := schema.tables(1)[0].table(3)
+	equals(t, uint64(1), date.uint(0, 2))
+	equals(t, "UTC", date.str(1))
+	meta := schema.tables(2)
+	equals(t, 1, len(meta))
+	equals(t, "symbol", meta[0].str(0))
+	equals(t, "spy", meta[0].str(1))
+
+	_, dictionaries := footer.vector(2)
+	equals(t, 0, dictionaries)
+	blocks, n := footer.vector(3)
+	equals(t, 1, n)
+	offset := int(le.Uint64(footer.buf[blocks:]))
+	metaLen := int(le.Uint32(footer.buf[blocks+8:]))
+	bodyLen := int(le.Uint64(footer.buf[blocks+16:]))
+
+	// the block points at an encapsulated record batch message
+	equals(t, uint32(0xffffffff), le.Uint32(data[offset:]))
+	equals(t, metaLen-8, int(le.Uint32(data[offset+4:])))
+	message := fbRoot(data[offset+8 : offset+metaLen])
+	equals(t, uint64(arrowVersion), message.uint(0, 2))
+	equals(t, uint64(3), message.uint(1, 1))
+	equals(t, uint64(bodyLen), message.uint(3, 8))
+	batch := message.table(2)
+	equals(t, uint64(3), batch.uint(0, 8))
+	_, nodes := batch.vector(1)
+	equals(t, 6, nodes)
+
+	// a validity and a data buffer per column, read close back from the body
+	buffers, count := batch.vector(2)
+	equals(t, 12, count)
+	body := data[offset+metaLen : offset+metaLen+bodyLen]
+	at := buffers + 16*9
+	start, length := int(le.Uint64(batch.buf[at:])), int(le.Uint64(batch.buf[at+8:]))
+	equals(t, 24, length)
+	var closes []float64
+	for i := start; i < start+length; i += 8 {
+		closes = append(closes, math.Float64frombits(le.Uint64(body[i:])))
+	}
+	equals(t, q.Close, closes)
+
+	// the schema message follows the magic, the end of stream marker the batch
+	equals(t, uint32(0xffffffff), le.Uint32(data[8:]))
+	equals(t, uint64(1), fbRoot(data[16:16+int(le.Uint32(data[12:]))]).uint(1, 1))
+	equals(t, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}, data[offset+metaLen+bodyLen:offset+metaLen+bodyLen+8])
+}
@@ -0,0 +1,474 @@
+package quote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// MsgPack - convert Quote struct to MessagePack, a map with the same keys
+// as the json encoding and dates as MessagePack timestamps
+func (q Quote) MsgPack() ([]byte, error) {
+	var w msgpackWriter
+	w.quote(q)
+	return w.buf.Bytes(), nil
+}
+
+// NewQuoteFromMsgPack - parse MessagePack quote into Quote structure
+func NewQuoteFromMsgPack(data []byte) (Quote, error) {
+	r := msgpackReader{data: data}
+	q, err := r.quote()
+	if err == nil && r.pos != len(r.data) {
+		err = errors.New("msgpack: trailing data after quote")
+	}
+	if err != nil {
+		return NewQuote("", 0), err
+	}
+	return q, nil
+}
+
+// MsgPack - convert Quotes to a MessagePack array of quotes
+func (q Quotes) MsgPack() ([]byte, error) {
+	var w msgpackWriter
+	w.arrayLen(len(q))
+	for _, quote := range q {
+		w.quote(quote)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// NewQuotesFromMsgPack - parse MessagePack array of quotes into Quotes
+func NewQuotesFromMsgPack(data []byte) (Quotes, error) {
+	r := msgpackReader{data: data}
+	n, err := r.arrayLen()
+	if err != nil {
+		return Quotes{}, err
+	}
+	// every quote takes at least a byte, so a longer array header is corrupt
+	if n > len(r.data)-r.pos {
+		return Quotes{}, io.ErrUnexpectedEOF
+	}
+	quotes := make(Quotes, n)
+	for i := range quotes {
+		quotes[i], err = r.quote()
+		if err != nil {
+			return Quotes{}, err
+		}
+	}
+	if r.pos != len(r.data) {
+		return Quotes{}, errors.New("msgpack: trailing data after quotes")
+	}
+	return quotes, nil
+}
+
+// msgpackWriter - encodes the MessagePack subset used by quotes
+type msgpackWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *msgpackWriter) uint(v uint64, size int) {
+	for shift := (size - 1) * 8; shift >= 0; shift -= 8 {
+		w.buf.WriteByte(byte(v >> uint(shift)))
+	}
+}
+
+func (w *msgpackWriter) mapLen(n int) {
+	switch {
+	case n < 16:
+		w.buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		w.buf.WriteByte(0xde)
+		w.uint(uint64(n), 2)
+	default:
+		w.buf.WriteByte(0xdf)
+		w.uint(uint64(n), 4)
+	}
+}
+
+func (w *msgpackWriter) arrayLen(n int) {
+	switch {
+	case n < 16:
+		w.buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		w.buf.WriteByte(0xdc)
+		w.uint(uint64(n), 2)
+	default:
+		w.buf.WriteByte(0xdd)
+		w.uint(uint64(n), 4)
+	}
+}
+
+func (w *msgpackWriter) str(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		w.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		w.buf.WriteByte(0xd9)
+		w.uint(uint64(n), 1)
+	case n <= math.MaxUint16:
+		w.buf.WriteByte(0xda)
+		w.uint(uint64(n), 2)
+	default:
+		w.buf.WriteByte(0xdb)
+		w.uint(uint64(n), 4)
+	}
+	w.buf.WriteString(s)
+}
+
+func (w *msgpackWriter) float(f float64) {
+	w.buf.WriteByte(0xcb)
+	w.uint(math.Float64bits(f), 8)
+}
+
+// timestamp extension (type -1) in its smallest form
+func (w *msgpackWriter) time(t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		w.buf.Write([]byte{0xd6, 0xff})
+		w.uint(uint64(sec), 4)
+	case sec >= 0 && sec < 1<<34:
+		w.buf.Write([]byte{0xd7, 0xff})
+		w.uint(nsec<<34|uint64(sec), 8)
+	default:
+		w.buf.Write([]byte{0xc7, 12, 0xff})
+		w.uint(nsec, 4)
+		w.uint(uint64(sec), 8)
+	}
+}
+
+func (w *msgpackWriter) floats(key string, values []float64) {
+	w.str(key)
+	w.arrayLen(len(values))
+	for _, v := range values {
+		w.float(v)
+	}
+}
+
+func (w *msgpackWriter) quote(q Quote) {
+	w.mapLen(7)
+	w.str("symbol")
+	w.str(q.Symbol)
+	w.str("date")
+	w.arrayLen(len(q.Date))
+	for _, d := range q.Date {
+		w.time(d)
+	}
+	w.floats("open", q.Open)
+	w.floats("high", q.High)
+	w.floats("low", q.Low)
+	w.floats("close", q.Close)
+	w.floats("volume", q.Volume)
+}
+
+// msgpackReader - decodes the MessagePack subset used by quotes,
+// skipping any keys it doesn't know
+type msgpackReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *msgpackReader) uint(size int) (uint64, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (r *msgpackReader) typeByte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *msgpackReader) length(c byte, fix, fixMask byte, size8, size16, size32 byte) (int, bool, error) {
+	var n uint64
+	var err error
+	switch {
+	case c&^fixMask == fix:
+		n = uint64(c & fixMask)
+	case size8 != 0 && c == size8:
+		n, err = r.uint(1)
+	case c == size16:
+		n, err = r.uint(2)
+	case c == size32:
+		n, err = r.uint(4)
+	default:
+		return 0, false, nil
+	}
+	return int(n), true, err
+}
+
+func (r *msgpackReader) mapLen() (int, error) {
+	c, err := r.typeByte()
+	if err != nil {
+		return 0, err
+	}
+	n, ok, err := r.length(c, 0x80, 0x0f, 0, 0xde, 0xdf)
+	if !ok {
+		return 0, fmt.Errorf("msgpack: expected map, got 0x%02x", c)
+	}
+	return n, err
+}
+
+func (r *msgpackReader) arrayLen() (int, error) {
+	c, err := r.typeByte()
+	if err != nil {
+		return 0, err
+	}
+	if c == 0xc0 { // nil
+		return 0, nil
+	}
+	n, ok, err := r.length(c, 0x90, 0x0f, 0, 0xdc, 0xdd)
+	if !ok {
+		return 0, fmt.Errorf("msgpack: expected array, got 0x%02x", c)
+	}
+	return n, err
+}
+
+func (r *msgpackReader) str() (string, error) {
+	c, err := r.typeByte()
+	if err != nil {
+		return "", err
+	}
+	n, ok, err := r.length(c, 0xa0, 0x1f, 0xd9, 0xda, 0xdb)
+	if !ok {
+		return "", fmt.Errorf("msgpack: expected string, got 0x%02x", c)
+	}
+	if err != nil {
+		return "", err
+	}
+	b, err := r.next(n)
+	return string(b), err
+}
+
+func (r *msgpackReader) float() (float64, error) {
+	c, err := r.typeByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c == 0xca:
+		v, err := r.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case c == 0xcb:
+		v, err := r.uint(8)
+		return math.Float64frombits(v), err
+	case c >= 0xcc && c <= 0xcf:
+		v, err := r.uint(1 << (c - 0xcc))
+		return float64(v), err
+	case c >= 0xd0 && c <= 0xd3:
+		size := 1 << (c - 0xd0)
+		v, err := r.uint(size)
+		shift := uint(64 - 8*size)
+		return float64(int64(v<<shift) >> shift), err
+	}
+	return 0, fmt.Errorf("msgpack: expected number, got 0x%02x", c)
+}
+
+func (r *msgpackReader) time() (time.Time, error) {
+	c, err := r.typeByte()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var sec, nsec uint64
+	switch c {
+	case 0xd6:
+		if err = r.extType(); err == nil {
+			sec, err = r.uint(4)
+		}
+	case 0xd7:
+		var v uint64
+		if err = r.extType(); err == nil {
+			v, err = r.uint(8)
+		}
+		sec, nsec = v&(1<<34-1), v>>34
+	case 0xc7:
+		var n uint64
+		if n, err = r.uint(1); err == nil && n != 12 {
+			err = fmt.Errorf("msgpack: invalid timestamp length %d", n)
+		}
+		if err == nil {
+			err = r.extType()
+		}
+		if err == nil {
+			nsec, err = r.uint(4)
+		}
+		if err == nil {
+			sec, err = r.uint(8)
+		}
+	default:
+		return time.Time{}, fmt.Errorf("msgpack: expected timestamp, got 0x%02x", c)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(sec), int64(nsec)).In(Location), nil
+}
+
+// extType - check the extension type is a timestamp
+func (r *msgpackReader) extType() error {
+	t, err := r.typeByte()
+	if err == nil && int8(t) != -1 {
+		err = fmt.Errorf("msgpack: unexpected extension type %d", int8(t))
+	}
+	return err
+}
+
+// skip - step over one value of any type
+func (r *msgpackReader) skip() error {
+	c, err := r.typeByte()
+	if err != nil {
+		return err
+	}
+	var n uint64
+	switch {
+	case c <= 0x7f || c >= 0xe0 || c == 0xc0 || c == 0xc2 || c == 0xc3:
+		return nil
+	case c <= 0x8f:
+		return r.skipValues(2 * int(c&0x0f))
+	case c <= 0x9f:
+		return r.skipValues(int(c & 0x0f))
+	case c <= 0xbf:
+		_, err = r.next(int(c & 0x1f))
+		return err
+	case c >= 0xc4 && c <= 0xc6: // bin
+		if n, err = r.uint(1 << (c - 0xc4)); err == nil {
+			_, err = r.next(int(n))
+		}
+		return err
+	case c >= 0xc7 && c <= 0xc9: // ext
+		if n, err = r.uint(1 << (c - 0xc7)); err == nil {
+			_, err = r.next(int(n) + 1)
+		}
+		return err
+	case c >= 0xca && c <= 0xd3:
+		_, err = r.next([]int{4, 8, 1, 2, 4, 8, 1, 2, 4, 8}[c-0xca])
+		return err
+	case c >= 0xd4 && c <= 0xd8: // fixext
+		_, err = r.next(1 + 1<<(c-0xd4))
+		return err
+	case c >= 0xd9 && c <= 0xdb: // str
+		if n, err = r.uint(1 << (c - 0xd9)); err == nil {
+			_, err = r.next(int(n))
+		}
+		return err
+	case c == 0xdc || c == 0xdd:
+		if n, err = r.uint(2 << (c - 0xdc)); err == nil {
+			err = r.skipValues(int(n))
+		}
+		return err
+	case c == 0xde || c == 0xdf:
+		if n, err = r.uint(2 << (c - 0xde)); err == nil {
+			err = r.skipValues(2 * int(n))
+		}
+		return err
+	}
+	return fmt.Errorf("msgpack: invalid type 0x%02x", c)
+}
+
+func (r *msgpackReader) skipValues(n int) error {
+	for i := 0; i < n; i++ {
+		if err := r.skip(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *msgpackReader) floats() ([]float64, error) {
+	n, err := r.arrayLen()
+	if err != nil {
+		return nil, err
+	}
+	if n > len(r.data)-r.pos {
+		return nil, io.ErrUnexpectedEOF
+	}
+	values := make([]float64, n)
+	for i := range values {
+		if values[i], err = r.float(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (r *msgpackReader) quote() (Quote, error) {
+	q := Quote{}
+	n, err := r.mapLen()
+	if err != nil {
+		return q, err
+	}
+	for i := 0; i < n && err == nil; i++ {
+		var key string
+		if key, err = r.str(); err != nil {
+			break
+		}
+		switch key {
+		case "symbol":
+			q.Symbol, err = r.str()
+		case "date":
+			var dates int
+			if dates, err = r.arrayLen(); err != nil {
+				break
+			}
+			if dates > len(r.data)-r.pos {
+				err = io.ErrUnexpectedEOF
+				break
+			}
+			q.Date = make([]time.Time, dates)
+			for bar := 0; bar < dates && err == nil; bar++ {
+				q.Date[bar], err = r.time()
+			}
+		case "open":
+			q.Open, err = r.floats()
+		case "high":
+			q.High, err = r.floats()
+		case "low":
+			q.Low, err = r.floats()
+		case "close":
+			q.Close, err = r.floats()
+		case "volume":
+			q.Volume, err = r.floats()
+		default:
+			err = r.skip()
+		}
+	}
+	if err != nil {
+		return q, err
+	}
+	// a missing column is an empty one, so every column needs the same length
+	for _, c := range []struct {
+		name   string
+		values []float64
+	}{{"open", q.Open}, {"high", q.High}, {"low", q.Low}, {"close", q.Close}, {"volume", q.Volume}} {
+		if len(c.values) != len(q.Date) {
+			return q, fmt.Errorf("msgpack: %s has %d bars, date has %d", c.name, len(c.values), len(q.Date))
+		}
+	}
+	return q, nil
+}
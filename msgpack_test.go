@@ -0,0 +1,77 @@
+package quote
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMsgPack(t *testing.T) {
+	q := NewQuote("spy", 20)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC).AddDate(0, 0, bar)
+		q.Open[bar] = 370 + float64(bar)
+		q.High[bar] = 375.5 + float64(bar)
+		q.Low[bar] = -1 // not a real price, just checks the sign survives
+		q.Close[bar] = 372.25
+		q.Volume[bar] = 1e8
+	}
+	q.Date[1] = q.Date[1].Add(123 * time.Millisecond)       // fixext8 timestamp
+	q.Date[2] = time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC) // ext8 timestamp
+
+	data, err := q.MsgPack()
+	ok(t, err)
+	back, err := NewQuoteFromMsgPack(data)
+	ok(t, err)
+	equals(t, q.JSON(false), back.JSON(false))
+
+	quotes := Quotes{q, NewQuote("empty", 0)}
+	data, err = quotes.MsgPack()
+	ok(t, err)
+	qs, err := NewQuotesFromMsgPack(data)
+	ok(t, err)
+	equals(t, quotes.JSON(false), qs.JSON(false))
+
+	_, err = NewQuoteFromMsgPack(data[:len(data)-3])
+	assert(t, err != nil, "expected error for truncated data")
+	_, err = NewQuotesFromMsgPack(data[:len(data)-3])
+	assert(t, err != nil, "expected error for truncated quotes")
+	// an array32 header claiming 2^31-1 quotes with nothing after it
+	_, err = NewQuotesFromMsgPack([]byte{0xdd, 0x7f, 0xff, 0xff, 0xff})
+	assert(t, err != nil, "expected error for a huge array header")
+
+	// {"extra": [1, "x"], "symbol": "a", "date": [t], "open": [1], "high": [2.5],
+	// "low": [-2], "close": [1], "volume": [1]} with integer and float32 prices
+	other := []byte{0x88,
+		0xa5, 'e', 'x', 't', 'r', 'a', 0x92, 0x01, 0xa1, 'x',
+		0xa6, 's', 'y', 'm', 'b', 'o', 'l', 0xa1, 'a',
+		0xa4, 'd', 'a', 't', 'e', 0x91, 0xd6, 0xff, 0x65, 0x93, 0x52, 0x00,
+		0xa4, 'o', 'p', 'e', 'n', 0x91, 0x01,
+		0xa4, 'h', 'i', 'g', 'h', 0x91, 0xca, 0x40, 0x20, 0x00, 0x00,
+		0xa3, 'l', 'o', 'w', 0x91, 0xfe,
+		0xa5, 'c', 'l', 'o', 's', 'e', 0x91, 0x01,
+		0xa6, 'v', 'o', 'l', 'u', 'm', 'e', 0x91, 0x01}
+	a, err := NewQuoteFromMsgPack(other)
+	ok(t, err)
+	equals(t, "a", a.Symbol)
+	equals(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), a.Date[0].UTC())
+	equals(t, []float64{2.5}, a.High)
+	equals(t, []float64{-2}, a.Low)
+	equals(t, []float64{1}, a.Close)
+
+	// {"symbol": "a", "close": [1, -2]} is missing the other columns
+	_, err = NewQuoteFromMsgPack([]byte{0x82,
+		0xa6, 's', 'y', 'm', 'b', 'o', 'l', 0xa1, 'a',
+		0xa5, 'c', 'l', 'o', 's', 'e', 0x92, 0x01, 0xfe})
+	assert(t, err != nil, "expected error for a close column without dates")
+	// {"symbol": "a"} has every column empty
+	empty, err := NewQuoteFromMsgPack([]byte{0x81, 0xa6, 's', 'y', 'm', 'b', 'o', 'l', 0xa1, 'a'})
+	ok(t, err)
+	equals(t, 0, len(empty.Close))
+
+	long := q
+	long.Volume = append(q.Volume[:len(q.Volume):len(q.Volume)], 1)
+	data, err = long.MsgPack()
+	ok(t, err)
+	_, err = NewQuoteFromMsgPack(data)
+	assert(t, err != nil, "expected error for a longer volume column")
+}
@@ -0,0 +1,266 @@
+package quote
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Parquet - convert Quote struct to an Apache Parquet file holding one row
+// group with a millisecond UTC timestamp date column and double price/volume
+// columns, plain encoded and uncompressed. The symbol is kept in the file's
+// key/value metadata
+func (q Quote) Parquet() []byte {
+	le := binary.LittleEndian
+	rows := len(q.Date)
+	out := []byte("PAR1")
+
+	type chunk struct {
+		name        string
+		kind        int32
+		start, size int
+	}
+	var chunks []chunk
+	page := func(name string, kind int32, data []byte) {
+		var header thriftWriter
+		header.i32(1, 0) // data page
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.begin(5)
+		header.i32(1, int32(rows))
+		header.i32(2, 0) // plain
+		header.i32(3, 3) // rle levels, none for required columns
+		header.i32(4, 3)
+		header.stop()
+		header.stop()
+		chunks = append(chunks, chunk{name: name, kind: kind, start: len(out), size: len(header.buf) + len(data)})
+		out = append(append(out, header.buf...), data...)
+	}
+
+	dates := make([]byte, 0, 8*rows)
+	for _, t := range q.Date {
+		dates = le.AppendUint64(dates, uint64(t.UnixMilli()))
+	}
+	page("date", parquetInt64, dates)
+	for _, c := range []struct {
+		name   string
+		values []float64
+	}{{"open", q.Open}, {"high", q.High}, {"low", q.Low}, {"close", q.Close}, {"volume", q.Volume}} {
+		data := make([]byte, 0, 8*rows)
+		for _, v := range c.values[:rows] {
+			data = le.AppendUint64(data, math.Float64bits(v))
+		}
+		page(c.name, parquetDouble, data)
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1) // format version
+	meta.list(2, thriftStruct, len(chunks)+1)
+	meta.elem()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(chunks)))
+	meta.stop()
+	for _, c := range chunks {
+		meta.elem()
+		meta.i32(1, c.kind)
+		meta.i32(3, 0) // required
+		meta.binary(4, c.name)
+		if c.kind == parquetInt64 {
+			meta.i32(6, 9) // TIMESTAMP_MILLIS
+			meta.begin(10) // logical type
+			meta.begin(8)  // timestamp
+			meta.boolean(1, true)
+			meta.begin(2) // unit
+			meta.begin(1) // milliseconds
+			meta.stop()
+			meta.stop()
+			meta.stop()
+			meta.stop()
+		}
+		meta.stop()
+	}
+	meta.i64(3, int64(rows))
+	meta.list(4, thriftStruct, 1)
+	meta.elem()
+	meta.list(1, thriftStruct, len(chunks))
+	total := 0
+	for _, c := range chunks {
+		total += c.size
+		meta.elem()
+		meta.i64(2, int64(c.start))
+		meta.begin(3)
+		meta.i32(1, c.kind)
+		meta.list(2, thriftI32, 1)
+		meta.varint(0) // plain
+		meta.list(3, thriftBinary, 1)
+		meta.str(c.name)
+		meta.i32(4, 0) // uncompressed
+		meta.i64(5, int64(rows))
+		meta.i64(6, int64(c.size))
+		meta.i64(7, int64(c.size))
+		meta.i64(9, int64(c.start))
+		meta.stop()
+		meta.stop()
+	}
+	meta.i64(2, int64(total))
+	meta.i64(3, int64(rows))
+	meta.stop()
+	meta.list(5, thriftStruct, 1)
+	meta.elem()
+	meta.binary(1, "symbol")
+	meta.binary(2, q.Symbol)
+	meta.stop()
+	meta.binary(6, "go-quote")
+	meta.stop()
+
+	out = append(out, meta.buf...)
+	out = le.AppendUint32(out, uint32(len(meta.buf)))
+	return append(out, "PAR1"...)
+}
+
+// WriteParquet - write Quote struct to Parquet file
+func (q Quote) WriteParquet(filename string) error {
+	if filename == "" {
+		filename = q.Symbol + ".parquet"
+	}
+	return os.WriteFile(filename, q.Parquet(), 0644)
+}
+
+// WriteParquetPartitioned - write each quote to its own Parquet file in a hive
+// style partitioned dataset, dir/symbol=spy/data.parquet, that DuckDB, Spark
+// and polars read back as one table with a symbol column
+func (q Quotes) WriteParquetPartitioned(dir string) error {
+	for _, quote := range q {
+		if quote.Symbol == "" || quote.Symbol == "." || quote.Symbol == ".." {
+			return fmt.Errorf("can't partition symbol '%s'", quote.Symbol)
+		}
+		filename := PartitionFile(dir, quote.Symbol)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := quote.WriteParquet(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PartitionFile - the file WriteParquetPartitioned writes a symbol to
+func PartitionFile(dir, symbol string) string {
+	if dir == "" {
+		dir = "quotes"
+	}
+	return filepath.Join(dir, "symbol="+url.PathEscape(symbol), "data.parquet")
+}
+
+// parquet physical types, numbered as in parquet.thrift
+const (
+	parquetInt64  = 2
+	parquetDouble = 5
+)
+
+// thrift compact protocol types
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter - minimal thrift compact protocol encoder for the Parquet
+// metadata. Structs are written field by field in increasing id order and
+// closed with stop, the top level one included
+type thriftWriter struct {
+	buf  []byte
+	last []int16 // last field id of each open struct
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) field(id int16, kind byte) {
+	if len(w.last) == 0 {
+		w.last = []int16{0}
+	}
+	top := len(w.last) - 1
+	if delta := id - w.last[top]; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|kind)
+	} else {
+		w.buf = append(w.buf, kind)
+		w.zigzag(int64(id))
+	}
+	w.last[top] = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) boolean(id int16, v bool) {
+	if v {
+		w.field(id, thriftTrue)
+	} else {
+		w.field(id, thriftFalse)
+	}
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.str(s)
+}
+
+// str - a binary list element, or the value of a binary field
+func (w *thriftWriter) str(s string) {
+	w.varint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// list - a list field header, its n elements follow
+func (w *thriftWriter) list(id int16, kind byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|kind)
+	} else {
+		w.buf = append(w.buf, 0xf0|kind)
+		w.varint(uint64(n))
+	}
+}
+
+// begin - a struct field, closed with stop
+func (w *thriftWriter) begin(id int16) {
+	w.field(id, thriftStruct)
+	w.last = append(w.last, 0)
+}
+
+// elem - a struct list element, closed with stop
+func (w *thriftWriter) elem() {
+	if len(w.last) == 0 {
+		w.last = []int16{0}
+	}
+	w.last = append(w.last, 0)
+}
+
+// stop - close the innermost struct
+func (w *thriftWriter) stop() {
+	w.buf = append(w.buf, 0)
+	if len(w.last) > 0 {
+		w.last = w.last[:len(w.last)-1]
+	}
+}
@@ -0,0 +1,149 @@
+package quote
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// thriftReader - decodes the thrift compact structs the Parquet writer emits
+// into maps of field id to int64, string, bool, list or nested struct
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(kind byte) interface{} {
+	switch kind {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		r.pos += n
+		return string(r.buf[r.pos-n : r.pos])
+	case thriftList:
+		head := r.buf[r.pos]
+		r.pos++
+		n := int(head >> 4)
+		if n == 15 {
+			n = int(r.varint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(head & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.object()
+	}
+	panic("unexpected thrift type")
+}
+
+func (r *thriftReader) object() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var id int16
+	for {
+		head := r.buf[r.pos]
+		r.pos++
+		if head == 0 {
+			return fields
+		}
+		if delta := int16(head >> 4); delta > 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(head & 0x0f)
+	}
+}
+
+func TestParquet(t *testing.T) {
+	q := NewQuote("spy", 3)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2024, 1, 2+bar, 14, 30, 0, 0, time.UTC)
+		q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar], q.Volume[bar] = 10.5, 12.25, 9.75, float64(11+bar), 1000
+	}
+	data := q.Parquet()
+
+	equals(t, "PAR1", string(data[:4]))
+	equals(t, "PAR1", string(data[len(data)-4:]))
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := (&thriftReader{buf: data[len(data)-8-size:]}).object()
+	equals(t, int64(1), meta[1])
+	equals(t, int64(3), meta[3])
+	equals(t, "go-quote", meta[6])
+	equals(t, map[int16]interface{}{1: "symbol", 2: "spy"}, meta[5].([]interface{})[0])
+
+	schema := meta[2].([]interface{})
+	equals(t, map[int16]interface{}{4: "schema", 5: int64(6)}, schema[0])
+	names := []string{"date", "open", "high", "low", "close", "volume"}
+	for i, name := range names {
+		column := schema[i+1].(map[int16]interface{})
+		equals(t, name, column[4])
+		equals(t, int64(0), column[3])
+		if i == 0 {
+			equals(t, int64(parquetInt64), column[1])
+			equals(t, int64(9), column[6])
+		} else {
+			equals(t, int64(parquetDouble), column[1])
+		}
+	}
+
+	group := meta[4].([]interface{})[0].(map[int16]interface{})
+	equals(t, int64(3), group[3])
+	columns := group[1].([]interface{})
+	equals(t, len(names), len(columns))
+	want := [][]float64{nil, q.Open, q.High, q.Low, q.Close, q.Volume}
+	for i, c := range columns {
+		chunk := c.(map[int16]interface{})[3].(map[int16]interface{})
+		equals(t, []interface{}{names[i]}, chunk[3])
+		equals(t, int64(3), chunk[5])
+
+		page := &thriftReader{buf: data, pos: int(chunk[9].(int64))}
+		header := page.object()
+		equals(t, chunk[6], int64(page.pos)-chunk[9].(int64)+header[2].(int64))
+		equals(t, int64(3), header[5].(map[int16]interface{})[1])
+		values := data[page.pos : page.pos+int(header[2].(int64))]
+		for bar := 0; bar < 3; bar++ {
+			v := binary.LittleEndian.Uint64(values[8*bar:])
+			if i == 0 {
+				equals(t, q.Date[bar].UnixMilli(), int64(v))
+			} else {
+				equals(t, want[i][bar], math.Float64frombits(v))
+			}
+		}
+	}
+}
+
+func TestWriteParquetPartitioned(t *testing.T) {
+	quotes := Quotes{NewQuote("spy", 2), NewQuote("btc/usd", 2)}
+	dir := t.TempDir()
+	ok(t, quotes.WriteParquetPartitioned(dir))
+
+	data, err := os.ReadFile(filepath.Join(dir, "symbol=spy", "data.parquet"))
+	ok(t, err)
+	equals(t, quotes[0].Parquet(), data)
+	equals(t, filepath.Join(dir, "symbol=btc%2Fusd", "data.parquet"), PartitionFile(dir, "btc/usd"))
+	_, err = os.Stat(PartitionFile(dir, "btc/usd"))
+	ok(t, err)
+
+	assert(t, Quotes{NewQuote("..", 0)}.WriteParquetPartitioned(dir) != nil, "expected error for a path symbol")
+}
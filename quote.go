@@ -12,19 +12,32 @@ package quote
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"io"
 	"log"
+	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -38,6 +51,17 @@ type Quote struct {
 	Low       []float64   `json:"low"`
 	Close     []float64   `json:"close"`
 	Volume    []float64   `json:"volume"`
+	Raw       []byte      `json:"-"`
+}
+
+// Bar - a single row of a Quote
+type Bar struct {
+	Date   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
 }
 
 // Quotes - an array of historical price data
@@ -46,8 +70,19 @@ type Quotes []Quote
 // Period - for quote history
 type Period string
 
-// ClientTimeout - connect/read timeout for client requests
-const ClientTimeout = 10 * time.Second
+// ClientTimeout - timeout for a whole request including reading the body,
+// generous so slow paged downloads aren't cut off (default=60s)
+var ClientTimeout = 60 * time.Second
+
+// DialTimeout - timeout for opening a connection (default=10s)
+var DialTimeout = 10 * time.Second
+
+// TLSHandshakeTimeout - timeout for the TLS handshake (default=10s)
+var TLSHandshakeTimeout = 10 * time.Second
+
+// ResponseHeaderTimeout - timeout waiting for response headers once the
+// request is sent, catches hung connections quickly (default=20s)
+var ResponseHeaderTimeout = 20 * time.Second
 
 const (
 	// Min1 - 1 Minute time period
@@ -80,8 +115,178 @@ const (
 	Weekly Period = "w"
 	// Monthly time period
 	Monthly Period = "m"
+	// Quarterly - calendar quarter time period
+	Quarterly Period = "q"
+	// Yearly - calendar year time period
+	Yearly Period = "y"
 )
 
+// nominal length of a period
+func periodDuration(period Period) time.Duration {
+	switch period {
+	case Min1:
+		return time.Minute
+	case Min3:
+		return 3 * time.Minute
+	case Min5:
+		return 5 * time.Minute
+	case Min15:
+		return 15 * time.Minute
+	case Min30:
+		return 30 * time.Minute
+	case Min60:
+		return time.Hour
+	case Hour2:
+		return 2 * time.Hour
+	case Hour4:
+		return 4 * time.Hour
+	case Hour6:
+		return 6 * time.Hour
+	case Hour8:
+		return 8 * time.Hour
+	case Hour12:
+		return 12 * time.Hour
+	case Daily:
+		return 24 * time.Hour
+	case Day3:
+		return 3 * 24 * time.Hour
+	case Weekly:
+		return 7 * 24 * time.Hour
+	case Monthly:
+		return 30 * 24 * time.Hour
+	case Quarterly:
+		return 91 * 24 * time.Hour
+	case Yearly:
+		return 365 * 24 * time.Hour
+	}
+	return 0
+}
+
+// NextBarTime - time of the bar following t, calendar aware for daily and longer periods
+func NextBarTime(t time.Time, period Period) time.Time {
+	switch period {
+	case Daily:
+		return t.AddDate(0, 0, 1)
+	case Day3:
+		return t.AddDate(0, 0, 3)
+	case Weekly:
+		return t.AddDate(0, 0, 7)
+	case Monthly:
+		return t.AddDate(0, 1, 0)
+	case Quarterly:
+		return t.AddDate(0, 3, 0)
+	case Yearly:
+		return t.AddDate(1, 0, 0)
+	}
+	return t.Add(periodDuration(period))
+}
+
+// start of the period containing t, in t's location
+func periodStart(t time.Time, period Period) time.Time {
+	year, month, day := t.Date()
+	switch period {
+	case Daily:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case Day3:
+		midnight := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+		days := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400
+		return midnight.AddDate(0, 0, -int(days%3))
+	case Weekly:
+		midnight := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+		return midnight.AddDate(0, 0, -(int(t.Weekday())+6)%7) // monday
+	case Monthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	case Quarterly:
+		return time.Date(year, (month-1)/3*3+1, 1, 0, 0, 0, 0, t.Location())
+	case Yearly:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, t.Location())
+	}
+	return t.Truncate(periodDuration(period))
+}
+
+// SupportedPeriods - list of periods a source can download
+func SupportedPeriods(source string) []Period {
+	switch source {
+	case "yahoo":
+		return []Period{Daily}
+	case "tiingo":
+		return []Period{Daily}
+	case "tiingo-crypto":
+		return []Period{Min1, Min3, Min5, Min15, Min30, Min60, Hour2, Hour4, Hour6, Hour8, Hour12, Daily, Day3, Weekly, Monthly}
+	case "tiingo-fx":
+		return []Period{Min1, Min5, Min15, Min30, Min60, Hour4, Daily}
+	case "coinbase":
+		return []Period{Min1, Min5, Min15, Min30, Min60, Hour2, Hour4, Hour6, Hour8, Hour12, Daily, Weekly, Monthly}
+	case "coinbase-advanced":
+		return []Period{Min1, Min5, Min15, Min30, Min60, Hour2, Hour4, Hour6, Daily}
+	case "deribit":
+		return []Period{Min1, Min3, Min5, Min15, Min30, Min60, Hour2, Hour6, Hour12, Daily}
+	case "gateio":
+		return []Period{Min1, Min5, Min15, Min30, Min60, Hour4, Hour8, Daily, Weekly, Monthly}
+	case "bybit":
+		return []Period{Min1, Min3, Min5, Min15, Min30, Min60, Hour2, Hour4, Hour6, Hour12, Daily, Weekly, Monthly}
+	case "eodhd":
+		return []Period{Min1, Min5, Min60, Daily, Weekly, Monthly}
+	case "kraken":
+		return []Period{Min1, Min5, Min15, Min30, Min60, Hour4, Daily, Weekly}
+	case "mexc":
+		return []Period{Min1, Min5, Min15, Min30, Min60, Hour4, Daily, Weekly, Monthly}
+	}
+	return []Period{}
+}
+
+// ErrUnsupportedPeriod - returned, wrapped, by a source asked for a period it
+// can't download, see SupportedPeriods
+var ErrUnsupportedPeriod = errors.New("unsupported period")
+
+// ErrSymbolNotFound - returned, wrapped, when a source doesn't know a symbol,
+// e.g. delisted or renamed tickers. These aren't retried, see NotFound
+var ErrSymbolNotFound = errors.New("symbol not found")
+
+// ErrUnauthorized - returned, wrapped, when a source rejects the api token
+// or the request with a 401 or 403. These aren't retried
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Retries - times a failed symbol is downloaded again in the batch
+// functions, symbols that weren't found, unsupported periods and rejected
+// tokens aren't retried (default=0)
+var Retries int
+
+// statusError - the error for a request that didn't succeed, wrapping
+// ErrSymbolNotFound for a 404 and ErrUnauthorized for a 401 or 403
+func statusError(source, symbol string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s %s", ErrUnauthorized, source, resp.Status)
+	}
+	return fmt.Errorf("%s error: %s", source, resp.Status)
+}
+
+// NotFound - sorted symbols whose download error is ErrSymbolNotFound, from the
+// errors returned by the WithErrors batch functions
+func NotFound(errs map[string]error) []string {
+	var symbols []string
+	for symbol, err := range errs {
+		if errors.Is(err, ErrSymbolNotFound) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// check that a source can download a period
+func checkPeriod(source string, period Period) error {
+	for _, p := range SupportedPeriods(source) {
+		if p == period {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s does not support period '%s'", ErrUnsupportedPeriod, source, period)
+}
+
 // Log - standard logger, disabled by default
 var Log *log.Logger
 
@@ -89,11 +294,224 @@ var Log *log.Logger
 // Be nice, don't get blocked
 var Delay time.Duration
 
+// DelayJitter - random number of milliseconds, like Delay, added to or taken
+// from each Delay so requests aren't perfectly periodic (default=0)
+var DelayJitter time.Duration
+
+// SleepDelay - sleep between requests for Delay, plus or minus a random DelayJitter
+func SleepDelay() {
+	if d := jitteredDelay(); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// jitteredDelay - Delay plus or minus a random DelayJitter, never negative
+func jitteredDelay() time.Duration {
+	d := Delay
+	if DelayJitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*DelayJitter)+1)) - DelayJitter
+	}
+	if d < 0 {
+		return 0
+	}
+	return d * time.Millisecond
+}
+
+// Limit - keep only the last Limit bars of each download, 0 keeps them all.
+// Paged sources don't request the pages before them either (default=0)
+var Limit int
+
+// limitBars - the last limit bars of q, all of them when limit is 0
+func limitBars(q Quote, limit int) Quote {
+	if limit <= 0 {
+		return q
+	}
+	return q.Tail(limit)
+}
+
+// KeepRaw - keep the raw provider response in Quote.Raw (default=false)
+var KeepRaw bool
+
+// SaveRawResponses - directory each source writes its raw http response body to
+// before parsing, as <source>_<symbol>_<timestamp>.json, for diagnosing parse
+// failures (default="", not saved)
+var SaveRawResponses string
+
+// FieldSeparator - separator between csv fields, e.g. ";" for localized spreadsheets (default=",")
+var FieldSeparator = ","
+
+// DecimalSeparator - decimal point used in csv numbers, e.g. "," with FieldSeparator ";" (default=".")
+var DecimalSeparator = "."
+
+// Verbose - log each request url, http status, elapsed time and bar count (default=false)
+var Verbose bool
+
+// DateOnly - write csv dates without a time for quotes where every bar is at midnight (default=false)
+var DateOnly bool
+
+// CSVEpoch - write csv dates as unix timestamps, "s" for seconds or "ms" for
+// milliseconds, instead of formatted dates. Reading detects either (default="")
+var CSVEpoch string
+
+// OutputUTC - format written timestamps in UTC, regardless of their location (default=true)
+var OutputUTC = true
+
+// Location - time zone all parsed bar timestamps are normalized into (default=UTC)
+var Location = time.UTC
+
 func init() {
 	Log = log.New(io.Discard, "quote: ", log.Ldate|log.Ltime|log.Lshortfile)
 	Delay = 100
 }
 
+// transport shared by all clients, proxies are taken from the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+var transport = newTransport()
+
+// guards updating the transport timeouts
+var transportMu sync.Mutex
+
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		transportMu.Lock()
+		dialer := net.Dialer{Timeout: DialTimeout, KeepAlive: 30 * time.Second}
+		transportMu.Unlock()
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return t
+}
+
+// browser user agents, rotated so requests look less like a bot
+var userAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+}
+
+func pickRandomUserAgent() string {
+	return userAgents[rand.Intn(len(userAgents))]
+}
+
+// new http client using the shared transport
+func newClient() *http.Client {
+	return &http.Client{Timeout: ClientTimeout, Transport: clientTransport()}
+}
+
+// shared transport with the current timeouts, wrapped to log each request when Verbose is set
+func clientTransport() http.RoundTripper {
+	transportMu.Lock()
+	if transport.TLSHandshakeTimeout != TLSHandshakeTimeout || transport.ResponseHeaderTimeout != ResponseHeaderTimeout {
+		transport.TLSHandshakeTimeout = TLSHandshakeTimeout
+		transport.ResponseHeaderTimeout = ResponseHeaderTimeout
+	}
+	transportMu.Unlock()
+	if Verbose {
+		return verboseTransport{transport}
+	}
+	return transport
+}
+
+// verboseTransport - logs each request url, status and elapsed time
+type verboseTransport struct {
+	next http.RoundTripper
+}
+
+func (vt verboseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	began := time.Now()
+	resp, err := vt.next.RoundTrip(req)
+	if err != nil {
+		Log.Printf("%s %s: %v (%v)\n", req.Method, redactURL(req.URL), err, time.Since(began).Round(time.Millisecond))
+		return resp, err
+	}
+	Log.Printf("%s %s: %s (%v)\n", req.Method, redactURL(req.URL), resp.Status, time.Since(began).Round(time.Millisecond))
+	return resp, err
+}
+
+// secretParams - query parameters that carry api keys and never get logged
+var secretParams = []string{"api_token", "token", "apikey", "api_key", "key"}
+
+// redactURL - u as a string with the value of every secret query parameter replaced
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, param := range secretParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.String()
+	}
+	clean := *u
+	clean.RawQuery = query.Encode()
+	return clean.String()
+}
+
+// logBars - with Verbose set, log the bar count and elapsed time of a symbol download
+func logBars(symbol string, bars int, began time.Time) {
+	if Verbose {
+		Log.Printf("%s: %d bars in %v\n", symbol, bars, time.Since(began).Round(time.Millisecond))
+	}
+}
+
+// saveRaw - with SaveRawResponses set, write a raw response body to a file in
+// it. Failures are only logged so they never break a download
+func saveRaw(source, symbol string, contents []byte) {
+	if SaveRawResponses == "" {
+		return
+	}
+	symbol = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '-'
+		}
+		return r
+	}, symbol)
+	name := fmt.Sprintf("%s_%s_%s.json", source, symbol, time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.WriteFile(filepath.Join(SaveRawResponses, name), contents, 0644); err != nil {
+		Log.Printf("save raw response: %v\n", err)
+	}
+}
+
+// SetTLSConfig - use a custom TLS configuration for all requests,
+// e.g. to skip verification behind an intercepting proxy
+func SetTLSConfig(config *tls.Config) {
+	transport.TLSClientConfig = config
+	transport.CloseIdleConnections()
+}
+
+// SetCABundle - trust the PEM encoded certificates in filename
+// in addition to the system roots
+func SetCABundle(filename string) error {
+	pem, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in %s", filename)
+	}
+	config := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		config = transport.TLSClientConfig.Clone()
+	}
+	config.RootCAs = pool
+	SetTLSConfig(config)
+	return nil
+}
+
+// convert unix seconds to a time in Location
+func unixTime(sec int64) time.Time {
+	return time.Unix(sec, 0).In(Location)
+}
+
 // NewQuote - new empty Quote struct
 func NewQuote(symbol string, bars int) Quote {
 	return Quote{
@@ -127,21 +545,176 @@ func getPrecision(symbol string) int {
 	return precision
 }
 
+// time as it should be written
+func outputTime(t time.Time) time.Time {
+	if OutputUTC {
+		return t.UTC()
+	}
+	return t
+}
+
+// copy of q with dates as they should be written
+func (q Quote) outputDates() Quote {
+	if !OutputUTC {
+		return q
+	}
+	dates := make([]time.Time, len(q.Date))
+	for bar := range q.Date {
+		dates[bar] = q.Date[bar].UTC()
+	}
+	q.Date = dates
+	return q
+}
+
+// IsDaily - true if every bar is timestamped at midnight
+func (q Quote) IsDaily() bool {
+	for _, date := range q.Date {
+		if date.Hour() != 0 || date.Minute() != 0 || date.Second() != 0 {
+			return false
+		}
+	}
+	return len(q.Date) > 0
+}
+
+// csv date layout, date only for daily quotes when DateOnly is set
+func (q Quote) csvLayout() string {
+	if CSVEpoch == "s" || CSVEpoch == "ms" {
+		return CSVEpoch
+	}
+	if DateOnly && q.outputDates().IsDaily() {
+		return "2006-01-02"
+	}
+	return "2006-01-02 15:04"
+}
+
+// csvDate - a csv date in layout, or a unix timestamp for the CSVEpoch layouts
+func csvDate(t time.Time, layout string) string {
+	switch layout {
+	case "s":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "ms":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return outputTime(t).Format(layout)
+}
+
+// parse a csv date written with or without a time, or as a unix timestamp in
+// seconds or, for values too big to be seconds, milliseconds
+func parseCSVDate(date string) (time.Time, error) {
+	if epoch, err := strconv.ParseInt(date, 10, 64); err == nil {
+		if epoch > 1e11 || epoch < -1e11 {
+			return time.UnixMilli(epoch).In(Location), nil
+		}
+		return time.Unix(epoch, 0).In(Location), nil
+	}
+	if len(date) == len("2006-01-02") {
+		return time.ParseInLocation("2006-01-02", date, Location)
+	}
+	return time.ParseInLocation("2006-01-02 15:04", date, Location)
+}
+
 // CSV - convert Quote structure to csv string
 func (q Quote) CSV() string {
 
 	precision := getPrecision(q.Symbol)
+	layout := q.csvLayout()
 
 	var buffer bytes.Buffer
-	buffer.WriteString("datetime,open,high,low,close,volume\n")
+	buffer.WriteString(q.csvHeader())
 	for bar := range q.Close {
-		str := fmt.Sprintf("%s,%.*f,%.*f,%.*f,%.*f,%.*f\n", q.Date[bar].Format("2006-01-02 15:04"),
-			precision, q.Open[bar], precision, q.High[bar], precision, q.Low[bar], precision, q.Close[bar], precision, q.Volume[bar])
-		buffer.WriteString(str)
+		buffer.WriteString(q.csvLine(bar, precision, layout, !IsIndex(q.Symbol)))
 	}
 	return buffer.String()
 }
 
+// CSVColumns - convert Quote structure to csv string with only the given
+// columns, in the given order, from datetime, open, high, low, close, volume
+// and registered indicators (sma20). Bars without an indicator value are empty
+func (q Quote) CSVColumns(cols []string) (string, error) {
+
+	precision := getPrecision(q.Symbol)
+	layout := q.csvLayout()
+
+	columns := map[string][]float64{"open": q.Open, "high": q.High, "low": q.Low, "close": q.Close, "volume": q.Volume}
+	for _, col := range cols {
+		if _, ok := columns[col]; ok || col == "datetime" {
+			continue
+		}
+		fn, err := Indicator(col)
+		if err != nil {
+			return "", fmt.Errorf("invalid csv column '%s'", col)
+		}
+		columns[col] = q.Apply(fn)
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(csvJoin(cols...))
+	fields := make([]string, len(cols))
+	for bar := range q.Close {
+		for i, col := range cols {
+			if col == "datetime" {
+				fields[i] = csvDate(q.Date[bar], layout)
+			} else if v := columns[col][bar]; math.IsNaN(v) {
+				fields[i] = ""
+			} else {
+				fields[i] = csvFloat(v, precision)
+			}
+		}
+		buffer.WriteString(csvJoin(fields...))
+	}
+	return buffer.String(), nil
+}
+
+// csv header row, without volume for an index
+func (q Quote) csvHeader() string {
+	if IsIndex(q.Symbol) {
+		return csvJoin("datetime", "open", "high", "low", "close")
+	}
+	return csvJoin("datetime", "open", "high", "low", "close", "volume")
+}
+
+// single csv row for a bar. An index never gets a volume value: without a
+// volume column its rows have five fields, with one its volume is left empty
+func (q Quote) csvLine(bar, precision int, layout string, volumeColumn bool) string {
+	if !volumeColumn {
+		return csvJoin(csvDate(q.Date[bar], layout), csvFloat(q.Open[bar], precision), csvFloat(q.High[bar], precision),
+			csvFloat(q.Low[bar], precision), csvFloat(q.Close[bar], precision))
+	}
+	volume := ""
+	if !IsIndex(q.Symbol) {
+		volume = csvFloat(q.Volume[bar], precision)
+	}
+	return csvJoin(csvDate(q.Date[bar], layout), csvFloat(q.Open[bar], precision), csvFloat(q.High[bar], precision),
+		csvFloat(q.Low[bar], precision), csvFloat(q.Close[bar], precision), volume)
+}
+
+// csvJoin - csv row from fields, separated by FieldSeparator
+func csvJoin(fields ...string) string {
+	return strings.Join(fields, FieldSeparator) + "\n"
+}
+
+// csvFloat - format a csv number using DecimalSeparator
+func csvFloat(v float64, precision int) string {
+	str := strconv.FormatFloat(v, 'f', precision, 64)
+	if DecimalSeparator != "." {
+		str = strings.Replace(str, ".", DecimalSeparator, 1)
+	}
+	return str
+}
+
+// csvSplit - csv fields of a row separated by FieldSeparator
+func csvSplit(line string) []string {
+	return strings.Split(line, FieldSeparator)
+}
+
+// parseCSVFloat - parse a csv number written with DecimalSeparator
+func parseCSVFloat(str string) (float64, error) {
+	if DecimalSeparator != "." {
+		str = strings.Replace(str, DecimalSeparator, ".", 1)
+	}
+	return strconv.ParseFloat(str, 64)
+}
+
 // Highstock - convert Quote structure to Highstock json format
 func (q Quote) Highstock() string {
 
@@ -163,6 +736,26 @@ func (q Quote) Highstock() string {
 	return buffer.String()
 }
 
+// HighstockOHLCV - convert Quote structure to a Highstock json object with
+// separate "ohlc" and "volume" arrays for a candlestick + volume chart
+func (q Quote) HighstockOHLCV() string {
+
+	precision := getPrecision(q.Symbol)
+
+	var ohlc, volume bytes.Buffer
+	for bar := range q.Close {
+		comma := ","
+		if bar == len(q.Close)-1 {
+			comma = ""
+		}
+		ms := q.Date[bar].UnixNano() / 1000000
+		ohlc.WriteString(fmt.Sprintf("[%d,%.*f,%.*f,%.*f,%.*f]%s\n",
+			ms, precision, q.Open[bar], precision, q.High[bar], precision, q.Low[bar], precision, q.Close[bar], comma))
+		volume.WriteString(fmt.Sprintf("[%d,%.*f]%s\n", ms, precision, q.Volume[bar], comma))
+	}
+	return "{\"ohlc\":[\n" + ohlc.String() + "],\n\"volume\":[\n" + volume.String() + "]}\n"
+}
+
 // Amibroker - convert Quote structure to csv string
 func (q Quote) Amibroker() string {
 
@@ -171,7 +764,7 @@ func (q Quote) Amibroker() string {
 	var buffer bytes.Buffer
 	buffer.WriteString("date,time,open,high,low,close,volume\n")
 	for bar := range q.Close {
-		str := fmt.Sprintf("%s,%s,%.*f,%.*f,%.*f,%.*f,%.*f\n", q.Date[bar].Format("2006-01-02"), q.Date[bar].Format("15:04"),
+		str := fmt.Sprintf("%s,%s,%.*f,%.*f,%.*f,%.*f,%.*f\n", outputTime(q.Date[bar]).Format("2006-01-02"), outputTime(q.Date[bar]).Format("15:04"),
 			precision, q.Open[bar], precision, q.High[bar], precision, q.Low[bar], precision, q.Close[bar], precision, q.Volume[bar])
 		buffer.WriteString(str)
 	}
@@ -191,8 +784,8 @@ func (q Quote) WriteCSV(filename string) error {
 	return os.WriteFile(filename, []byte(csv), 0644)
 }
 
-// WriteAmibroker - write Quote struct to csv file
-func (q Quote) WriteAmibroker(filename string) error {
+// WriteCSVColumns - write selected columns of Quote struct to csv file
+func (q Quote) WriteCSVColumns(filename string, cols []string) error {
 	if filename == "" {
 		if q.Symbol != "" {
 			filename = q.Symbol + ".csv"
@@ -200,265 +793,365 @@ func (q Quote) WriteAmibroker(filename string) error {
 			filename = "quote.csv"
 		}
 	}
-	csv := q.Amibroker()
+	csv, err := q.CSVColumns(cols)
+	if err != nil {
+		return err
+	}
 	return os.WriteFile(filename, []byte(csv), 0644)
 }
 
-// WriteHighstock - write Quote struct to Highstock json format
-func (q Quote) WriteHighstock(filename string) error {
+// AppendCSV - append bars newer than the last line of a csv file,
+// writing the header first if the file is new or empty
+func (q Quote) AppendCSV(filename string) error {
 	if filename == "" {
 		if q.Symbol != "" {
-			filename = q.Symbol + ".json"
+			filename = q.Symbol + ".csv"
 		} else {
-			filename = "quote.json"
+			filename = "quote.csv"
 		}
 	}
-	csv := q.Highstock()
-	return os.WriteFile(filename, []byte(csv), 0644)
-}
-
-// NewQuoteFromCSV - parse csv quote string into Quote structure
-func NewQuoteFromCSV(symbol, csv string) (Quote, error) {
 
-	tmp := strings.Split(csv, "\n")
-	numrows := len(tmp)
-	q := NewQuote(symbol, numrows-1)
+	last, err := lastLine(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
 
-	for row, bar := 1, 0; row < numrows; row, bar = row+1, bar+1 {
-		line := strings.Split(tmp[row], ",")
-		if len(line) != 6 {
-			break
+	var buffer bytes.Buffer
+	var lastDate time.Time
+	// new rows match the columns already in the file
+	volumeColumn := !IsIndex(q.Symbol)
+	if strings.TrimSpace(last) == "" {
+		buffer.WriteString(q.csvHeader())
+	} else {
+		columns, err := firstLineFields(filename)
+		if err != nil {
+			return err
+		}
+		volumeColumn = columns == 6
+		if !strings.HasPrefix(last, "datetime") {
+			lastDate, err = parseCSVDate(csvSplit(last)[0])
+			if err != nil {
+				return fmt.Errorf("can't append to %s: %v", filename, err)
+			}
 		}
-		q.Date[bar], _ = time.Parse("2006-01-02 15:04", line[0])
-		q.Open[bar], _ = strconv.ParseFloat(line[1], 64)
-		q.High[bar], _ = strconv.ParseFloat(line[2], 64)
-		q.Low[bar], _ = strconv.ParseFloat(line[3], 64)
-		q.Close[bar], _ = strconv.ParseFloat(line[4], 64)
-		q.Volume[bar], _ = strconv.ParseFloat(line[5], 64)
 	}
-	return q, nil
-}
-
-// NewQuoteFromCSVDateFormat - parse csv quote string into Quote structure
-// with specified DateTime format
-func NewQuoteFromCSVDateFormat(symbol, csv string, format string) (Quote, error) {
-
-	tmp := strings.Split(csv, "\n")
-	numrows := len(tmp)
-	q := NewQuote("", numrows-1)
 
-	if len(strings.TrimSpace(format)) == 0 {
-		format = "2006-01-02 15:04"
+	precision := getPrecision(q.Symbol)
+	layout := q.csvLayout()
+	for bar := range q.Close {
+		if !lastDate.IsZero() && !q.Date[bar].After(lastDate) {
+			continue
+		}
+		buffer.WriteString(q.csvLine(bar, precision, layout, volumeColumn))
 	}
 
-	for row, bar := 1, 0; row < numrows; row, bar = row+1, bar+1 {
-		line := strings.Split(tmp[row], ",")
-		q.Date[bar], _ = time.Parse(format, line[0])
-		q.Open[bar], _ = strconv.ParseFloat(line[1], 64)
-		q.High[bar], _ = strconv.ParseFloat(line[2], 64)
-		q.Low[bar], _ = strconv.ParseFloat(line[3], 64)
-		q.Close[bar], _ = strconv.ParseFloat(line[4], 64)
-		q.Volume[bar], _ = strconv.ParseFloat(line[5], 64)
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
 	}
-	return q, nil
-}
+	defer f.Close()
 
-// NewQuoteFromCSVFile - parse csv quote file into Quote structure
-func NewQuoteFromCSVFile(symbol, filename string) (Quote, error) {
-	csv, err := os.ReadFile(filename)
-	if err != nil {
-		return NewQuote("", 0), err
+	// make sure the new rows start on their own line
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		end := make([]byte, 1)
+		if _, err = f.ReadAt(end, info.Size()-1); err == nil && end[0] != '\n' {
+			f.Write([]byte("\n"))
+		}
 	}
-	return NewQuoteFromCSV(symbol, string(csv))
+
+	_, err = f.Write(buffer.Bytes())
+	return err
 }
 
-// NewQuoteFromCSVFileDateFormat - parse csv quote file into Quote structure
-// with specified DateTime format
-func NewQuoteFromCSVFileDateFormat(symbol, filename string, format string) (Quote, error) {
-	csv, err := os.ReadFile(filename)
+// LastCSVDate - date of the last bar in a csv file written by WriteCSV,
+// zero if the file has no bars
+func LastCSVDate(filename string) (time.Time, error) {
+	last, err := lastLine(filename)
+	if err != nil || last == "" || strings.HasPrefix(last, "datetime") {
+		return time.Time{}, err
+	}
+	date, err := parseCSVDate(csvSplit(last)[0])
 	if err != nil {
-		return NewQuote("", 0), err
+		return time.Time{}, fmt.Errorf("can't read last date of %s: %v", filename, err)
 	}
-	return NewQuoteFromCSVDateFormat(symbol, string(csv), format)
+	return date, nil
 }
 
-// JSON - convert Quote struct to json string
-func (q Quote) JSON(indent bool) string {
-	var j []byte
-	if indent {
-		j, _ = json.MarshalIndent(q, "", "  ")
+// LastFileDate - date of the last bar in a csv or json file written by one
+// of the Write functions, the earliest of the symbols' last dates for a file
+// holding several quotes so none of them miss bars, zero if it has no bars
+func LastFileDate(filename string) (time.Time, error) {
+	var quotes Quotes
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			quotes, err = NewQuotesFromJSON(string(data))
+		} else {
+			var q Quote
+			q, err = NewQuoteFromJSON(string(data))
+			quotes = Quotes{q}
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("can't read last date of %s: %v", filename, err)
+		}
 	} else {
-		j, _ = json.Marshal(q)
+		last, err := LastCSVDate(filename)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return last, err
+		}
+		// symbol first, as written by Quotes.WriteCSV
+		quotes, err = NewQuotesFromCSVFile(filename)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(quotes) == 0 {
+			return time.Time{}, fmt.Errorf("can't read last date of %s", filename)
+		}
 	}
-	return string(j)
+	var last time.Time
+	for _, q := range quotes {
+		if n := len(q.Date); n > 0 && (last.IsZero() || q.Date[n-1].Before(last)) {
+			last = q.Date[n-1]
+		}
+	}
+	return last, nil
 }
 
-// WriteJSON - write Quote struct to json file
-func (q Quote) WriteJSON(filename string, indent bool) error {
-	if filename == "" {
-		filename = q.Symbol + ".json"
+// firstLineFields - number of fields in the first line of a csv file, its header
+func firstLineFields(filename string) (int, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
 	}
-	json := q.JSON(indent)
-	return os.WriteFile(filename, []byte(json), 0644)
-
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	return len(csvSplit(strings.TrimRight(line, "\r\n"))), nil
 }
 
-// NewQuoteFromJSON - parse json quote string into Quote structure
-func NewQuoteFromJSON(jsn string) (Quote, error) {
-	q := Quote{}
-	err := json.Unmarshal([]byte(jsn), &q)
+// last non-empty line of a file, read from the end so large files stay cheap
+func lastLine(filename string) (string, error) {
+	f, err := os.Open(filename)
 	if err != nil {
-		return q, err
+		return "", err
 	}
-	return q, nil
-}
+	defer f.Close()
 
-// NewQuoteFromJSONFile - parse json quote string into Quote structure
-func NewQuoteFromJSONFile(filename string) (Quote, error) {
-	jsn, err := os.ReadFile(filename)
+	info, err := f.Stat()
 	if err != nil {
-		return NewQuote("", 0), err
+		return "", err
+	}
+	size := info.Size()
+	chunk := int64(4096)
+	for {
+		if chunk > size {
+			chunk = size
+		}
+		buf := make([]byte, chunk)
+		if _, err = f.ReadAt(buf, size-chunk); err != nil && err != io.EOF {
+			return "", err
+		}
+		text := strings.TrimRight(string(buf), "\r\n")
+		if i := strings.LastIndex(text, "\n"); i >= 0 || chunk == size {
+			return strings.TrimSpace(text[i+1:]), nil
+		}
+		chunk *= 2
 	}
-	return NewQuoteFromJSON(string(jsn))
 }
 
-// CSV - convert Quotes structure to csv string
-func (q Quotes) CSV() string {
-
-	var buffer bytes.Buffer
-
-	buffer.WriteString("symbol,datetime,open,high,low,close,volume\n")
+// WriteAmibroker - write Quote struct to csv file
+func (q Quote) WriteAmibroker(filename string) error {
+	if filename == "" {
+		if q.Symbol != "" {
+			filename = q.Symbol + ".csv"
+		} else {
+			filename = "quote.csv"
+		}
+	}
+	csv := q.Amibroker()
+	return os.WriteFile(filename, []byte(csv), 0644)
+}
 
-	for sym := 0; sym < len(q); sym++ {
-		quote := q[sym]
-		precision := getPrecision(quote.Symbol)
-		for bar := range quote.Close {
-			str := fmt.Sprintf("%s,%s,%.*f,%.*f,%.*f,%.*f,%.*f\n",
-				quote.Symbol, quote.Date[bar].Format("2006-01-02 15:04"), precision, quote.Open[bar], precision, quote.High[bar], precision, quote.Low[bar], precision, quote.Close[bar], precision, quote.Volume[bar])
-			buffer.WriteString(str)
+// WriteHighstock - write Quote struct to Highstock json format
+func (q Quote) WriteHighstock(filename string) error {
+	if filename == "" {
+		if q.Symbol != "" {
+			filename = q.Symbol + ".json"
+		} else {
+			filename = "quote.json"
 		}
 	}
+	csv := q.Highstock()
+	return os.WriteFile(filename, []byte(csv), 0644)
+}
 
-	return buffer.String()
+// WriteHighstockOHLCV - write Quote struct to Highstock ohlc/volume json format
+func (q Quote) WriteHighstockOHLCV(filename string) error {
+	if filename == "" {
+		if q.Symbol != "" {
+			filename = q.Symbol + ".json"
+		} else {
+			filename = "quote.json"
+		}
+	}
+	hs := q.HighstockOHLCV()
+	return os.WriteFile(filename, []byte(hs), 0644)
 }
 
-// Highstock - convert Quotes structure to Highstock json format
-func (q Quotes) Highstock() string {
+// csvLines - split csv text into lines, dropping a leading UTF-8 BOM and
+// the carriage returns left behind by Windows line endings
+func csvLines(csv string) []string {
+	csv = strings.TrimPrefix(csv, "\ufeff")
+	lines := strings.Split(csv, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines
+}
 
-	var buffer bytes.Buffer
+// NewQuoteFromCSV - parse csv quote string into Quote structure
+func NewQuoteFromCSV(symbol, csv string) (Quote, error) {
 
-	buffer.WriteString("{")
+	tmp := csvLines(csv)
+	numrows := len(tmp)
+	q := NewQuote(symbol, numrows-1)
 
-	for sym := 0; sym < len(q); sym++ {
-		quote := q[sym]
-		precision := getPrecision(quote.Symbol)
-		for bar := range quote.Close {
-			comma := ","
-			if bar == len(quote.Close)-1 {
-				comma = ""
-			}
-			if bar == 0 {
-				buffer.WriteString(fmt.Sprintf("\"%s\":[\n", quote.Symbol))
-			}
-			str := fmt.Sprintf("[%d,%.*f,%.*f,%.*f,%.*f,%.*f]%s\n",
-				quote.Date[bar].UnixNano()/1000000, precision, quote.Open[bar], precision, quote.High[bar], precision, quote.Low[bar], precision, quote.Close[bar], precision, quote.Volume[bar], comma)
-			buffer.WriteString(str)
+	bar := 0
+	for row := 1; row < numrows; row, bar = row+1, bar+1 {
+		line := csvSplit(tmp[row])
+		if len(line) != 6 && len(line) != 5 {
+			break
 		}
-		if sym < len(q)-1 {
-			buffer.WriteString("],\n")
-		} else {
-			buffer.WriteString("]\n")
+		q.Date[bar], _ = parseCSVDate(line[0])
+		q.Open[bar], _ = parseCSVFloat(line[1])
+		q.High[bar], _ = parseCSVFloat(line[2])
+		q.Low[bar], _ = parseCSVFloat(line[3])
+		q.Close[bar], _ = parseCSVFloat(line[4])
+		if len(line) == 6 { // an index has no volume column
+			q.Volume[bar], _ = parseCSVFloat(line[5])
 		}
 	}
-
-	buffer.WriteString("}")
-
-	return buffer.String()
+	// no empty bars for the trailing newline
+	if bar < len(q.Close) {
+		q = q.filter(func(i int) bool { return i < bar })
+	}
+	return q, nil
 }
 
-// Amibroker - convert Quotes structure to csv string
-func (q Quotes) Amibroker() string {
-
-	var buffer bytes.Buffer
+// NewQuoteFromCSVDateFormat - parse csv quote string into Quote structure
+// with specified DateTime format
+func NewQuoteFromCSVDateFormat(symbol, csv string, format string) (Quote, error) {
 
-	buffer.WriteString("symbol,date,time,open,high,low,close,volume\n")
+	tmp := csvLines(csv)
+	numrows := len(tmp)
+	q := NewQuote("", numrows-1)
 
-	for sym := 0; sym < len(q); sym++ {
-		quote := q[sym]
-		precision := getPrecision(quote.Symbol)
-		for bar := range quote.Close {
-			str := fmt.Sprintf("%s,%s,%s,%.*f,%.*f,%.*f,%.*f,%.*f\n",
-				quote.Symbol, quote.Date[bar].Format("2006-01-02"), quote.Date[bar].Format("15:04"), precision, quote.Open[bar], precision, quote.High[bar], precision, quote.Low[bar], precision, quote.Close[bar], precision, quote.Volume[bar])
-			buffer.WriteString(str)
-		}
+	if len(strings.TrimSpace(format)) == 0 {
+		format = "2006-01-02 15:04"
 	}
 
-	return buffer.String()
+	for row, bar := 1, 0; row < numrows; row, bar = row+1, bar+1 {
+		line := csvSplit(tmp[row])
+		q.Date[bar], _ = time.ParseInLocation(format, line[0], Location)
+		q.Open[bar], _ = parseCSVFloat(line[1])
+		q.High[bar], _ = parseCSVFloat(line[2])
+		q.Low[bar], _ = parseCSVFloat(line[3])
+		q.Close[bar], _ = parseCSVFloat(line[4])
+		q.Volume[bar], _ = parseCSVFloat(line[5])
+	}
+	return q, nil
 }
 
-// WriteCSV - write Quotes structure to file
-func (q Quotes) WriteCSV(filename string) error {
-	if filename == "" {
-		filename = "quotes.csv"
+// NewQuoteFromCSVFile - parse csv quote file into Quote structure
+func NewQuoteFromCSVFile(symbol, filename string) (Quote, error) {
+	csv, err := os.ReadFile(filename)
+	if err != nil {
+		return NewQuote("", 0), err
 	}
-	csv := q.CSV()
-	ba := []byte(csv)
-	return os.WriteFile(filename, ba, 0644)
+	return NewQuoteFromCSV(symbol, string(csv))
 }
 
-// WriteAmibroker - write Quotes structure to file
-func (q Quotes) WriteAmibroker(filename string) error {
-	if filename == "" {
-		filename = "quotes.csv"
+// NewQuoteFromCSVFileDateFormat - parse csv quote file into Quote structure
+// with specified DateTime format
+func NewQuoteFromCSVFileDateFormat(symbol, filename string, format string) (Quote, error) {
+	csv, err := os.ReadFile(filename)
+	if err != nil {
+		return NewQuote("", 0), err
 	}
-	csv := q.Amibroker()
-	ba := []byte(csv)
-	return os.WriteFile(filename, ba, 0644)
+	return NewQuoteFromCSVDateFormat(symbol, string(csv), format)
 }
 
-// NewQuotesFromCSV - parse csv quote string into Quotes array
-func NewQuotesFromCSV(csv string) (Quotes, error) {
+// NewQuoteFromAmibrokerCSV - parse an Amibroker/Metastock csv string, as
+// written by Amibroker, with separate date and time columns:
+// date,time,open,high,low,close,volume. Dates may be 2006-01-02 or 20060102
+// and times 15:04 or 15:04:05
+func NewQuoteFromAmibrokerCSV(symbol, csv string) (Quote, error) {
 
-	quotes := Quotes{}
-	tmp := strings.Split(csv, "\n")
+	// Amibroker always writes commas and plain decimals, whatever
+	// FieldSeparator and DecimalSeparator are set to
+	tmp := csvLines(csv)
 	numrows := len(tmp)
+	q := NewQuote(symbol, 0)
 
-	var index = make(map[string]int)
-	for idx := 1; idx < numrows; idx++ {
-		sym := strings.Split(tmp[idx], ",")[0]
-		index[sym]++
-	}
-
-	row := 1
-	for sym, len := range index {
-		q := NewQuote(sym, len)
-		for bar := 0; bar < len; bar++ {
-			line := strings.Split(tmp[row], ",")
-			q.Date[bar], _ = time.Parse("2006-01-02 15:04", line[1])
-			q.Open[bar], _ = strconv.ParseFloat(line[2], 64)
-			q.High[bar], _ = strconv.ParseFloat(line[3], 64)
-			q.Low[bar], _ = strconv.ParseFloat(line[4], 64)
-			q.Close[bar], _ = strconv.ParseFloat(line[5], 64)
-			q.Volume[bar], _ = strconv.ParseFloat(line[6], 64)
-			row++
+	for row := 1; row < numrows; row++ {
+		if row == numrows-1 && strings.TrimSpace(tmp[row]) == "" {
+			break
 		}
-		quotes = append(quotes, q)
+		line := strings.Split(tmp[row], ",")
+		if len(line) != 7 {
+			return NewQuote(symbol, 0), fmt.Errorf("row %d: %d fields, want 7", row+1, len(line))
+		}
+		date, err := parseAmibrokerDate(line[0], line[1])
+		if err != nil {
+			return NewQuote(symbol, 0), fmt.Errorf("row %d: %w", row+1, err)
+		}
+		var values [5]float64
+		for i := range values {
+			if values[i], err = strconv.ParseFloat(line[2+i], 64); err != nil {
+				return NewQuote(symbol, 0), fmt.Errorf("row %d: %w", row+1, err)
+			}
+		}
+		q.Date = append(q.Date, date)
+		q.Open = append(q.Open, values[0])
+		q.High = append(q.High, values[1])
+		q.Low = append(q.Low, values[2])
+		q.Close = append(q.Close, values[3])
+		q.Volume = append(q.Volume, values[4])
 	}
-	return quotes, nil
+	return q, nil
 }
 
-// NewQuotesFromCSVFile - parse csv quote file into Quotes array
-func NewQuotesFromCSVFile(filename string) (Quotes, error) {
+// NewQuoteFromAmibrokerCSVFile - parse an Amibroker csv file into Quote structure
+func NewQuoteFromAmibrokerCSVFile(symbol, filename string) (Quote, error) {
 	csv, err := os.ReadFile(filename)
 	if err != nil {
-		return Quotes{}, err
+		return NewQuote("", 0), err
 	}
-	return NewQuotesFromCSV(string(csv))
+	return NewQuoteFromAmibrokerCSV(symbol, string(csv))
 }
 
-// JSON - convert Quotes struct to json string
-func (q Quotes) JSON(indent bool) string {
+// combine the separate date and time columns of an Amibroker csv row
+func parseAmibrokerDate(date, clock string) (time.Time, error) {
+	dateLayout := "2006-01-02"
+	if len(date) == len("20060102") {
+		dateLayout = "20060102"
+	}
+	clockLayout := "15:04"
+	if len(clock) == len("15:04:05") {
+		clockLayout = "15:04:05"
+	}
+	return time.ParseInLocation(dateLayout+" "+clockLayout, date+" "+clock, Location)
+}
+
+// JSON - convert Quote struct to json string
+func (q Quote) JSON(indent bool) string {
 	var j []byte
+	q = q.outputDates()
 	if indent {
 		j, _ = json.MarshalIndent(q, "", "  ")
 	} else {
@@ -468,647 +1161,4496 @@ func (q Quotes) JSON(indent bool) string {
 }
 
 // WriteJSON - write Quote struct to json file
-func (q Quotes) WriteJSON(filename string, indent bool) error {
+func (q Quote) WriteJSON(filename string, indent bool) error {
 	if filename == "" {
-		filename = "quotes.json"
+		filename = q.Symbol + ".json"
 	}
-	jsn := q.JSON(indent)
-	return os.WriteFile(filename, []byte(jsn), 0644)
+	json := q.JSON(indent)
+	return os.WriteFile(filename, []byte(json), 0644)
+
 }
 
-// WriteHighstock - write Quote struct to json file in Highstock format
-func (q Quotes) WriteHighstock(filename string) error {
-	if filename == "" {
-		filename = "quotes.json"
+// NewQuoteFromJSON - parse json quote string into Quote structure
+func NewQuoteFromJSON(jsn string) (Quote, error) {
+	q := Quote{}
+	err := json.Unmarshal([]byte(jsn), &q)
+	if err != nil {
+		return q, err
 	}
-	hc := q.Highstock()
-	return os.WriteFile(filename, []byte(hc), 0644)
+	return q, nil
 }
 
-// NewQuotesFromJSON - parse json quote string into Quote structure
-func NewQuotesFromJSON(jsn string) (Quotes, error) {
-	quotes := Quotes{}
-	err := json.Unmarshal([]byte(jsn), &quotes)
-	if err != nil {
-		return quotes, err
+// CompactJSON - convert Quote struct to a compact json encoding for bandwidth
+// sensitive clients. The first date is unix seconds and each later one the
+// seconds since the bar before it, prices are integers in units of the quote's
+// precision (372.25 is 37225 at precision 2). Volume has its own precision, cut
+// back from the price precision until the largest volume fits, and a price too
+// large to store as an exact integer is an error
+func (q Quote) CompactJSON() ([]byte, error) {
+	precision := getPrecision(q.Symbol)
+	volumePrecision := precision
+	for _, v := range q.Volume {
+		for volumePrecision > 0 && math.Abs(v)*math.Pow10(volumePrecision) > compactMaxInt {
+			volumePrecision--
+		}
 	}
-	return quotes, nil
+	c := compactQuote{
+		Symbol:          q.Symbol,
+		Precision:       precision,
+		VolumePrecision: &volumePrecision,
+		Date:            make([]int64, len(q.Date)),
+	}
+	scale := math.Pow10(precision)
+	var err error
+	for _, col := range []struct {
+		dst    *[]int64
+		values []float64
+		scale  float64
+	}{{&c.Open, q.Open, scale}, {&c.High, q.High, scale}, {&c.Low, q.Low, scale},
+		{&c.Close, q.Close, scale}, {&c.Volume, q.Volume, math.Pow10(volumePrecision)}} {
+		if *col.dst, err = compactFloats(col.values, col.scale); err != nil {
+			return nil, err
+		}
+	}
+	var last int64
+	for bar, date := range q.Date {
+		c.Date[bar] = date.Unix() - last
+		last = date.Unix()
+	}
+	return json.Marshal(c)
 }
 
-// NewQuotesFromJSONFile - parse json quote string into Quote structure
-func NewQuotesFromJSONFile(filename string) (Quotes, error) {
-	jsn, err := os.ReadFile(filename)
-	if err != nil {
-		return Quotes{}, err
+// NewQuoteFromCompactJSON - parse CompactJSON quote into Quote structure
+func NewQuoteFromCompactJSON(data []byte) (Quote, error) {
+	var c compactQuote
+	if err := json.Unmarshal(data, &c); err != nil {
+		return NewQuote("", 0), err
 	}
-	return NewQuotesFromJSON(string(jsn))
+	bars := len(c.Date)
+	for _, col := range [][]int64{c.Open, c.High, c.Low, c.Close, c.Volume} {
+		if len(col) != bars {
+			return NewQuote("", 0), errors.New("compact json: columns differ in length")
+		}
+	}
+	volumePrecision := c.Precision
+	if c.VolumePrecision != nil {
+		volumePrecision = *c.VolumePrecision
+	}
+	for _, p := range []int{c.Precision, volumePrecision} {
+		if p < 0 || p > compactMaxPrecision {
+			return NewQuote("", 0), fmt.Errorf("compact json: precision %d out of range 0-%d", p, compactMaxPrecision)
+		}
+	}
+	scale := math.Pow10(c.Precision)
+	volumeScale := math.Pow10(volumePrecision)
+	q := NewQuote(c.Symbol, bars)
+	var date int64
+	for bar := 0; bar < bars; bar++ {
+		date += c.Date[bar]
+		q.Date[bar] = unixTime(date)
+		q.Open[bar] = float64(c.Open[bar]) / scale
+		q.High[bar] = float64(c.High[bar]) / scale
+		q.Low[bar] = float64(c.Low[bar]) / scale
+		q.Close[bar] = float64(c.Close[bar]) / scale
+		q.Volume[bar] = float64(c.Volume[bar]) / volumeScale
+	}
+	return q, nil
 }
 
-// NewQuoteFromYahoo - Yahoo historical prices for a symbol
-func NewQuoteFromYahoo(symbol, startDate, endDate string, period Period, adjustQuote bool) (Quote, error) {
+// compact json integers stay within what a float64, and so javascript, holds exactly
+const (
+	compactMaxInt       = 1 << 53
+	compactMaxPrecision = 15
+)
 
-	var resp *http.Response
+type compactQuote struct {
+	Symbol          string  `json:"symbol"`
+	Precision       int     `json:"precision"`
+	VolumePrecision *int    `json:"volume_precision,omitempty"`
+	Date            []int64 `json:"date"`
+	Open            []int64 `json:"open"`
+	High            []int64 `json:"high"`
+	Low             []int64 `json:"low"`
+	Close           []int64 `json:"close"`
+	Volume          []int64 `json:"volume"`
+}
 
-	if period != Daily {
-		Log.Printf("Yahoo intraday data no longer supported\n")
-		return NewQuote("", 0), errors.New("yahoo intraday data no longer supported")
+func compactFloats(values []float64, scale float64) ([]int64, error) {
+	ints := make([]int64, len(values))
+	for i, v := range values {
+		scaled := math.Round(v * scale)
+		if math.IsNaN(scaled) || math.Abs(scaled) > compactMaxInt {
+			return nil, fmt.Errorf("compact json: %v doesn't fit at scale %v", v, scale)
+		}
+		ints[i] = int64(scaled)
 	}
+	return ints, nil
+}
 
-	from := ParseDateString(startDate)
-	to := ParseDateString(endDate)
-
-	client := &http.Client{
-		Timeout: ClientTimeout,
+// NewQuoteFromJSONFile - parse json quote string into Quote structure
+func NewQuoteFromJSONFile(filename string) (Quote, error) {
+	jsn, err := os.ReadFile(filename)
+	if err != nil {
+		return NewQuote("", 0), err
 	}
+	return NewQuoteFromJSON(string(jsn))
+}
 
-	initReq, err := http.NewRequest("GET", "https://finance.yahoo.com", nil)
-	if err != nil {
-		return NewQuote("", 0), err
+// Dates - the underlying date slice, callers must treat it as read-only
+func (q Quote) Dates() []time.Time { return q.Date }
+
+// Opens - the underlying open slice, callers must treat it as read-only
+func (q Quote) Opens() []float64 { return q.Open }
+
+// Highs - the underlying high slice, callers must treat it as read-only
+func (q Quote) Highs() []float64 { return q.High }
+
+// Lows - the underlying low slice, callers must treat it as read-only
+func (q Quote) Lows() []float64 { return q.Low }
+
+// Closes - the underlying close slice, callers must treat it as read-only
+func (q Quote) Closes() []float64 { return q.Close }
+
+// Volumes - the underlying volume slice, callers must treat it as read-only
+func (q Quote) Volumes() []float64 { return q.Volume }
+
+// DateColumn - a copy of the date column that is safe to modify
+func (q Quote) DateColumn() []time.Time { return append([]time.Time(nil), q.Date...) }
+
+// OpenColumn - a copy of the open column that is safe to modify
+func (q Quote) OpenColumn() []float64 { return append([]float64(nil), q.Open...) }
+
+// HighColumn - a copy of the high column that is safe to modify
+func (q Quote) HighColumn() []float64 { return append([]float64(nil), q.High...) }
+
+// LowColumn - a copy of the low column that is safe to modify
+func (q Quote) LowColumn() []float64 { return append([]float64(nil), q.Low...) }
+
+// CloseColumn - a copy of the close column that is safe to modify
+func (q Quote) CloseColumn() []float64 { return append([]float64(nil), q.Close...) }
+
+// VolumeColumn - a copy of the volume column that is safe to modify
+func (q Quote) VolumeColumn() []float64 { return append([]float64(nil), q.Volume...) }
+
+// DatesCopy - same as DateColumn
+func (q Quote) DatesCopy() []time.Time { return q.DateColumn() }
+
+// OpensCopy - same as OpenColumn
+func (q Quote) OpensCopy() []float64 { return q.OpenColumn() }
+
+// HighsCopy - same as HighColumn
+func (q Quote) HighsCopy() []float64 { return q.HighColumn() }
+
+// LowsCopy - same as LowColumn
+func (q Quote) LowsCopy() []float64 { return q.LowColumn() }
+
+// ClosesCopy - same as CloseColumn
+func (q Quote) ClosesCopy() []float64 { return q.CloseColumn() }
+
+// VolumesCopy - same as VolumeColumn
+func (q Quote) VolumesCopy() []float64 { return q.VolumeColumn() }
+
+// Bar - the row at index i
+func (q Quote) Bar(i int) Bar {
+	return Bar{Date: q.Date[i], Open: q.Open[i], High: q.High[i], Low: q.Low[i], Close: q.Close[i], Volume: q.Volume[i]}
+}
+
+// Bars - copy of the quote as a slice of rows
+func (q Quote) Bars() []Bar {
+	bars := make([]Bar, len(q.Close))
+	for i := range bars {
+		bars[i] = q.Bar(i)
 	}
-	initReq.Header.Set("User-Agent", "Mozilla/5.0 (X11; U; Linux i686) Gecko/20071127 Firefox/2.0.0.11")
-	client.Do(initReq)
+	return bars
+}
 
-	url := fmt.Sprintf(
-		"https://query2.finance.yahoo.com/v8/finance/chart/%s?period1=%d&period2=%d&interval=1d&events=history&corsDomain=finance.yahoo.com",
-		symbol,
-		from.Unix(),
-		to.Unix())
-	resp, err = client.Get(url)
-	// Error getting response from the client.
-	if err != nil {
-		Log.Printf("Error: symbol '%s' not found\n", symbol)
-		return NewQuote("", 0), err
+// AsOf - the most recent bar dated at or before t, false if t is before the
+// first bar. Dates must be ascending
+func (q Quote) AsOf(t time.Time) (Bar, bool) {
+	// first bar after t, the one before it is the answer
+	i := sort.Search(len(q.Date), func(bar int) bool { return q.Date[bar].After(t) })
+	if i == 0 {
+		return Bar{}, false
 	}
-	defer resp.Body.Close()
-	// Read all bytes of the response body.
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		Log.Printf("Error: bad data for symbol '%s'\n", symbol)
-		return NewQuote("", 0), err
+	return q.Bar(i - 1), true
+}
+
+// ForEachBar - call fn with each row in order, without building a slice
+func (q Quote) ForEachBar(fn func(i int, b Bar)) {
+	for i := range q.Close {
+		fn(i, q.Bar(i))
 	}
-	// Unmarshal the bytes into a dynamic JSON object.
-	var jsonResponse map[string]interface{}
-	err = json.Unmarshal(respBody, &jsonResponse)
-	if err != nil {
-		Log.Printf("Error: bad data for symbol '%s'\n", symbol)
-		return NewQuote("", 0), err
+}
+
+// Range - high minus low for each bar
+func (q Quote) Range() []float64 {
+	r := make([]float64, len(q.Close))
+	for bar := range r {
+		r[bar] = q.High[bar] - q.Low[bar]
 	}
-	// Dynamically parse the tree of JSON to get the data we need.
-	chart, ok := jsonResponse["chart"].(map[string]interface{})
-	if !ok {
-		Log.Printf("Error: Invalid chart structure within JSON response")
-		return NewQuote("", 0), err
+	return r
+}
+
+// TrueRange - the greatest of high minus low and the distances from the
+// previous close to the high and low. The first bar has no previous close,
+// so its true range is its range.
+func (q Quote) TrueRange() []float64 {
+	tr := q.Range()
+	for bar := 1; bar < len(tr); bar++ {
+		prev := q.Close[bar-1]
+		tr[bar] = math.Max(tr[bar], math.Max(math.Abs(q.High[bar]-prev), math.Abs(q.Low[bar]-prev)))
 	}
-	result, ok := chart["result"].([]interface{})
-	if !ok || len(result) == 0 {
-		log.Fatal("Error: Invalid result structure within JSON response")
-		return NewQuote("", 0), err
+	return tr
+}
+
+// RollingVWAP - volume weighted average typical price over a trailing window
+// of bars. Bars before the window fills are NaN, and a window with no volume
+// carries the previous value forward.
+func (q Quote) RollingVWAP(window int) []float64 {
+	vwap := make([]float64, len(q.Close))
+	for bar := range q.Close {
+		if window < 1 || bar < window-1 {
+			vwap[bar] = math.NaN()
+			continue
+		}
+		var pv, vol float64
+		for i := bar - window + 1; i <= bar; i++ {
+			pv += (q.High[i] + q.Low[i] + q.Close[i]) / 3 * q.Volume[i]
+			vol += q.Volume[i]
+		}
+		if vol > 0 {
+			vwap[bar] = pv / vol
+		} else if bar > 0 {
+			vwap[bar] = vwap[bar-1]
+		} else {
+			vwap[bar] = math.NaN()
+		}
 	}
-	firstResult, ok := result[0].(map[string]interface{})
+	return vwap
+}
+
+// ZScore - the open, high, low, close or volume series standardized to mean 0
+// and standard deviation 1 over the whole quote, using the population standard
+// deviation. A series with no bars or no variance is an error
+func (q Quote) ZScore(field string) ([]float64, error) {
+	series, ok := map[string][]float64{"open": q.Open, "high": q.High, "low": q.Low, "close": q.Close, "volume": q.Volume}[field]
 	if !ok {
-		log.Fatal("Error: Invalid result[0] structure within JSON response")
-		return NewQuote("", 0), err
+		return nil, fmt.Errorf("invalid field '%s', must be open, high, low, close or volume", field)
 	}
-	timestamps, ok := firstResult["timestamp"].([]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid timestamp structure within JSON response")
-		return NewQuote("", 0), err
+	if len(series) == 0 {
+		return nil, fmt.Errorf("no %s values to standardize", field)
 	}
-	indicators, ok := firstResult["indicators"].(map[string]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid indicators structure within JSON response")
-		return NewQuote("", 0), err
+	var mean float64
+	for _, v := range series {
+		mean += v
 	}
-	quote, ok := indicators["quote"].([]interface{})
-	if !ok || len(quote) == 0 {
-		log.Fatal("Error: Invalid quote structure within JSON response")
-		return NewQuote("", 0), err
+	mean /= float64(len(series))
+	var variance float64
+	for _, v := range series {
+		variance += (v - mean) * (v - mean)
 	}
-	firstQuote, ok := quote[0].(map[string]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid quote[0] structure within JSON response")
-		return NewQuote("", 0), err
+	std := math.Sqrt(variance / float64(len(series)))
+	if std == 0 || math.IsNaN(std) {
+		return nil, fmt.Errorf("%s has no variance to standardize", field)
 	}
-	high, ok := firstQuote["high"].([]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid high structure within JSON response")
-		return NewQuote("", 0), err
+	z := make([]float64, len(series))
+	for i, v := range series {
+		z[i] = (v - mean) / std
 	}
-	low, ok := firstQuote["low"].([]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid low structure within JSON response")
-		return NewQuote("", 0), err
+	return z, nil
+}
+
+// CumulativeReturn - compounded close to close return since the first bar, so
+// 1 unit invested at the first close grows to 1+r. The first bar is 0, and a
+// bar following a non-positive close adds no return
+func (q Quote) CumulativeReturn() []float64 {
+	cum := make([]float64, len(q.Close))
+	growth := 1.0
+	for bar := 1; bar < len(cum); bar++ {
+		if prev := q.Close[bar-1]; prev > 0 {
+			growth *= q.Close[bar] / prev
+		}
+		cum[bar] = growth - 1
 	}
-	open, ok := firstQuote["open"].([]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid open structure within JSON response")
-		return NewQuote("", 0), err
+	return cum
+}
+
+// Drawdown - percent the compounded close is below its running peak, 0 at a
+// new high and 20 when 20% below it. The first bar is 0
+func (q Quote) Drawdown() []float64 {
+	dd := make([]float64, len(q.Close))
+	peak := 1.0
+	for bar, r := range q.CumulativeReturn() {
+		growth := 1 + r
+		if growth > peak {
+			peak = growth
+		}
+		dd[bar] = (1 - growth/peak) * 100
 	}
-	volume, ok := firstQuote["volume"].([]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid volume structure within JSON response")
-		return NewQuote("", 0), err
+	return dd
+}
+
+// RollingVolatility - sample standard deviation of the close to close log
+// returns over a trailing window of bars. Bars before the window fills are NaN.
+// With annualize the result is scaled by the square root of the bars per year,
+// taken from the average bar spacing so that daily stocks get about 252 and
+// daily crypto 365
+func (q Quote) RollingVolatility(window int, annualize bool) []float64 {
+	vol := make([]float64, len(q.Close))
+	scale := 1.0
+	if annualize && len(q.Date) > 1 {
+		spacing := q.Date[len(q.Date)-1].Sub(q.Date[0]) / time.Duration(len(q.Date)-1)
+		scale = math.Sqrt(float64(365.25*24*time.Hour) / float64(spacing))
 	}
-	close, ok := firstQuote["close"].([]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid close structure within JSON response")
-		return NewQuote("", 0), err
+	for bar := range vol {
+		if window < 2 || bar < window {
+			vol[bar] = math.NaN()
+			continue
+		}
+		var mean float64
+		for i := bar - window + 1; i <= bar; i++ {
+			mean += math.Log(q.Close[i] / q.Close[i-1])
+		}
+		mean /= float64(window)
+		var variance float64
+		for i := bar - window + 1; i <= bar; i++ {
+			d := math.Log(q.Close[i]/q.Close[i-1]) - mean
+			variance += d * d
+		}
+		vol[bar] = math.Sqrt(variance/float64(window-1)) * scale
 	}
-	adjCloseObj, ok := indicators["adjclose"].([]interface{})
-	if !ok || len(quote) == 0 {
-		log.Fatal("Error: Invalid adjclose structure within JSON response")
-		return NewQuote("", 0), err
+	return vol
+}
+
+// IndicatorFunc - a series derived from a quote, one value per bar and NaN
+// where there isn't enough history yet
+type IndicatorFunc func(Quote) []float64
+
+// Apply - the series fn derives from the quote, e.g. q.Apply(SMA(20))
+func (q Quote) Apply(fn func(Quote) []float64) []float64 {
+	return fn(q)
+}
+
+var (
+	indicatorsMu sync.RWMutex
+	indicators   = map[string]func(period int) IndicatorFunc{
+		"sma":  SMA,
+		"ema":  EMA,
+		"rsi":  RSI,
+		"vwap": func(period int) IndicatorFunc { return func(q Quote) []float64 { return q.RollingVWAP(period) } },
 	}
-	firstAdjClose, ok := adjCloseObj[0].(map[string]interface{})
-	if !ok {
-		log.Fatal("Error: Invalid adjclose[0] structure within JSON response")
-		return NewQuote("", 0), err
+)
+
+// RegisterIndicator - make an indicator available by name to Indicator, csv
+// columns and the cli. build returns the indicator for a lookback period
+func RegisterIndicator(name string, build func(period int) IndicatorFunc) {
+	indicatorsMu.Lock()
+	defer indicatorsMu.Unlock()
+	indicators[strings.ToLower(name)] = build
+}
+
+// Indicators - names of the registered indicators, sorted
+func Indicators() []string {
+	indicatorsMu.RLock()
+	defer indicatorsMu.RUnlock()
+	names := make([]string, 0, len(indicators))
+	for name := range indicators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Indicator - registered indicator named with its period appended, e.g. sma20 or rsi14
+func Indicator(spec string) (IndicatorFunc, error) {
+	name := strings.TrimRight(strings.ToLower(spec), "0123456789")
+	period, err := strconv.Atoi(spec[len(name):])
+	if err != nil || period < 1 {
+		return nil, fmt.Errorf("invalid indicator '%s', expected a name and period such as sma20", spec)
 	}
-	adjClose, ok := firstAdjClose["adjclose"].([]interface{})
+	indicatorsMu.RLock()
+	build, ok := indicators[name]
+	indicatorsMu.RUnlock()
 	if !ok {
-		log.Fatal("Error: Invalid adjclose inner structure within JSON response")
-		return NewQuote("", 0), err
+		return nil, fmt.Errorf("unknown indicator '%s'", name)
 	}
+	return build(period), nil
+}
 
-	quoteObj := NewQuote(symbol, len(timestamps))
-
-	for row := 0; row < len(timestamps); row++ {
-
-		o := open[row].(float64)
-		h := high[row].(float64)
-		l := low[row].(float64)
-		c := close[row].(float64)
-		a := adjClose[row].(float64)
-		v := volume[row].(float64)
+// nans - series of n NaN values
+func nans(n int) []float64 {
+	series := make([]float64, n)
+	for i := range series {
+		series[i] = math.NaN()
+	}
+	return series
+}
 
-		quoteObj.Date[row] = time.Unix(int64(timestamps[row].(float64)), 0)
+// SMA - simple moving average of the close over period bars
+func SMA(period int) IndicatorFunc {
+	return func(q Quote) []float64 {
+		sma := nans(len(q.Close))
+		var sum float64
+		for bar, c := range q.Close {
+			sum += c
+			if bar >= period {
+				sum -= q.Close[bar-period]
+			}
+			if bar >= period-1 {
+				sma[bar] = sum / float64(period)
+			}
+		}
+		return sma
+	}
+}
 
-		// Adjustment ratio
-		if adjustQuote {
-			quoteObj.Open[row] = o
-			quoteObj.High[row] = h
-			quoteObj.Low[row] = l
-			quoteObj.Close[row] = a
-		} else {
-			ratio := c / a
-			quoteObj.Open[row] = o * ratio
-			quoteObj.High[row] = h * ratio
-			quoteObj.Low[row] = l * ratio
-			quoteObj.Close[row] = c
+// EMA - exponential moving average of the close, seeded with the simple
+// average of the first period bars
+func EMA(period int) IndicatorFunc {
+	return func(q Quote) []float64 {
+		ema := SMA(period)(q)
+		k := 2 / float64(period+1)
+		for bar := period; bar < len(q.Close); bar++ {
+			ema[bar] = ema[bar-1] + k*(q.Close[bar]-ema[bar-1])
 		}
+		return ema
+	}
+}
 
-		quoteObj.Volume[row] = v
+// RSI - Wilder's relative strength index of the close over period bars
+func RSI(period int) IndicatorFunc {
+	return func(q Quote) []float64 {
+		rsi := nans(len(q.Close))
+		n := float64(period)
+		var gain, loss float64
+		for bar := 1; bar < len(q.Close); bar++ {
+			change := q.Close[bar] - q.Close[bar-1]
+			up, down := math.Max(change, 0), math.Max(-change, 0)
+			if bar <= period {
+				gain += up / n
+				loss += down / n
+			} else {
+				gain = (gain*(n-1) + up) / n
+				loss = (loss*(n-1) + down) / n
+			}
+			if bar < period {
+				continue
+			}
+			switch {
+			case gain == 0 && loss == 0:
+				rsi[bar] = 50
+			case loss == 0:
+				rsi[bar] = 100
+			default:
+				rsi[bar] = 100 - 100/(1+gain/loss)
+			}
+		}
+		return rsi
 	}
+}
 
-	return quoteObj, nil
+// Downsample - aggregate bars into at most maxPoints evenly sized buckets for
+// charting, each bucket keeping the first open, high/low extremes, last close
+// and total volume, dated at its first bar
+func (q Quote) Downsample(maxPoints int) Quote {
+	numrows := len(q.Close)
+	if maxPoints < 1 || numrows <= maxPoints {
+		return q
+	}
+	ds := NewQuote(q.Symbol, maxPoints)
+	for bucket := 0; bucket < maxPoints; bucket++ {
+		first := bucket * numrows / maxPoints
+		last := (bucket+1)*numrows/maxPoints - 1
+		ds.Date[bucket] = q.Date[first]
+		ds.Open[bucket] = q.Open[first]
+		ds.High[bucket] = q.High[first]
+		ds.Low[bucket] = q.Low[first]
+		ds.Close[bucket] = q.Close[last]
+		for bar := first; bar <= last; bar++ {
+			ds.High[bucket] = math.Max(ds.High[bucket], q.High[bar])
+			ds.Low[bucket] = math.Min(ds.Low[bucket], q.Low[bar])
+			ds.Volume[bucket] += q.Volume[bar]
+		}
+	}
+	return ds
 }
 
-/*
-func NewQuoteFromYahoo(symbol, startDate, endDate string, period Period, adjustQuote bool) (Quote, error) {
+// FillMissing - insert synthetic bars wherever a bar is missing at the
+// expected step. Method "linear" interpolates the close between the
+// surrounding bars, anything else ("ffill") repeats the previous close.
+// Synthetic bars have open=high=low=close and zero volume.
+func (q Quote) FillMissing(step Period, method string) Quote {
+	if periodDuration(step) == 0 || len(q.Close) < 2 {
+		return q
+	}
+	filled := NewQuote(q.Symbol, 0)
+	filled.Precision = q.Precision
+	add := func(date time.Time, open, high, low, close, volume float64) {
+		filled.Date = append(filled.Date, date)
+		filled.Open = append(filled.Open, open)
+		filled.High = append(filled.High, high)
+		filled.Low = append(filled.Low, low)
+		filled.Close = append(filled.Close, close)
+		filled.Volume = append(filled.Volume, volume)
+	}
+	for bar := range q.Close {
+		if bar > 0 {
+			prev := bar - 1
+			span := q.Date[bar].Sub(q.Date[prev]).Seconds()
+			for t := NextBarTime(q.Date[prev], step); t.Before(q.Date[bar]); t = NextBarTime(t, step) {
+				price := q.Close[prev]
+				if method == "linear" {
+					frac := t.Sub(q.Date[prev]).Seconds() / span
+					price += (q.Close[bar] - q.Close[prev]) * frac
+				}
+				add(t, price, price, price, price, 0)
+			}
+		}
+		add(q.Date[bar], q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar], q.Volume[bar])
+	}
+	return filled
+}
 
-	from := ParseDateString(startDate)
-	to := ParseDateString(endDate)
+// IsIndex - true for index symbols like ^GSPC, ^VIX (Yahoo) or ^spx (Stooq),
+// which have no traded volume of their own
+func IsIndex(symbol string) bool {
+	return strings.HasPrefix(symbol, "^")
+}
 
-	url := fmt.Sprintf(
-		"http://ichart.yahoo.com/table.csv?s=%s&a=%d&b=%d&c=%d&d=%d&e=%d&f=%d&g=%s&ignore=.csv",
-		symbol,
-		from.Month()-1, from.Day(), from.Year(),
-		to.Month()-1, to.Day(), to.Year(),
-		period)
-	resp, err := http.Get(url)
-	if err != nil {
-		Log.Printf("symbol '%s' not found\n", symbol)
-		return NewQuote("", 0), err
+// HasVolume - false for an index or when every bar has zero volume, e.g. forex quotes
+func (q Quote) HasVolume() bool {
+	if IsIndex(q.Symbol) {
+		return false
 	}
-	defer resp.Body.Close()
+	for _, v := range q.Volume {
+		if v != 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	var csvdata [][]string
-	reader := csv.NewReader(resp.Body)
-	csvdata, err = reader.ReadAll()
-	if err != nil {
-		Log.Printf("bad data for symbol '%s'\n", symbol)
-		return NewQuote("", 0), err
+// Validate - check the quote's integrity: every column the same length,
+// dates in ascending order without repeats, no NaN or infinite values, each
+// bar's high at or above and low at or below its open and close, and no
+// negative volume. The error describes the first bad bar and counts the rest
+func (q Quote) Validate() error {
+	n := len(q.Close)
+	for _, l := range []int{len(q.Date), len(q.Open), len(q.High), len(q.Low), len(q.Volume)} {
+		if l != n {
+			return fmt.Errorf("%s: columns have different lengths", q.Symbol)
+		}
+	}
+	var first error
+	bad := 0
+	for bar := 0; bar < n; bar++ {
+		problem := ""
+		o, h, l, c, v := q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar], q.Volume[bar]
+		switch {
+		case bar > 0 && !q.Date[bar].After(q.Date[bar-1]):
+			problem = "date not after the previous bar"
+		case math.IsNaN(o+h+l+c+v) || math.IsInf(o+h+l+c+v, 0):
+			problem = "NaN or infinite value"
+		case h < math.Max(o, c) || h < l:
+			problem = fmt.Sprintf("high %v below open, low or close", h)
+		case l > math.Min(o, c):
+			problem = fmt.Sprintf("low %v above open or close", l)
+		case v < 0:
+			problem = fmt.Sprintf("negative volume %v", v)
+		}
+		if problem == "" {
+			continue
+		}
+		bad++
+		if first == nil {
+			first = fmt.Errorf("%s: bar %d (%s): %s", q.Symbol, bar, q.Date[bar].Format("2006-01-02 15:04"), problem)
+		}
 	}
+	if bad > 1 {
+		return fmt.Errorf("%w, and %d more bad bars", first, bad-1)
+	}
+	return first
+}
 
-	numrows := len(csvdata) - 1
-	quote := NewQuote(symbol, numrows)
+// HasNonPositivePrices - true if any bar has a zero or negative open, high, low or close,
+// which breaks log returns (e.g. heavily split adjusted history)
+func (q Quote) HasNonPositivePrices() bool {
+	for bar := range q.Close {
+		if q.Open[bar] <= 0 || q.High[bar] <= 0 || q.Low[bar] <= 0 || q.Close[bar] <= 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	for row := 1; row < len(csvdata); row++ {
+// Split - a stock split on Date, Ratio new shares for each old one
+// (2 for a 2:1 split, 0.1 for a 1:10 reverse split)
+type Split struct {
+	Date  time.Time
+	Ratio float64
+}
 
-		// Parse row of data
-		d, _ := time.Parse("2006-01-02", csvdata[row][0])
-		o, _ := strconv.ParseFloat(csvdata[row][1], 64)
-		h, _ := strconv.ParseFloat(csvdata[row][2], 64)
-		l, _ := strconv.ParseFloat(csvdata[row][3], 64)
-		c, _ := strconv.ParseFloat(csvdata[row][4], 64)
-		v, _ := strconv.ParseFloat(csvdata[row][5], 64)
-		a, _ := strconv.ParseFloat(csvdata[row][6], 64)
+// DetectSplits - guess splits in an unadjusted quote from bar over bar close
+// ratios close to a round split ratio (2:1, 3:2, 10:1 or the reverse).
+// threshold is how far off the round ratio a move may be, 0.05 allows 5%.
+// A heuristic: a genuine 50% crash looks the same as a 2:1 split
+func (q Quote) DetectSplits(threshold float64) []Split {
+	var splits []Split
+	for bar := 1; bar < len(q.Close); bar++ {
+		if q.Close[bar-1] <= 0 || q.Close[bar] <= 0 {
+			continue
+		}
+		move := q.Close[bar-1] / q.Close[bar]
+		reverse := move < 1
+		if reverse {
+			move = 1 / move
+		}
+		ratio := math.Round(move)
+		if math.Abs(move-1.5) < math.Abs(move-ratio) {
+			ratio = 1.5
+		}
+		if ratio < 1.5 || math.Abs(move-ratio) > threshold*ratio {
+			continue
+		}
+		if reverse {
+			ratio = 1 / ratio
+		}
+		splits = append(splits, Split{Date: q.Date[bar], Ratio: ratio})
+	}
+	return splits
+}
 
-		// Adjustment factor
-		factor := 1.0
-		if adjustQuote {
-			factor = a / c
+// AdjustForSplits - copy of the quote with the bars before each split back
+// adjusted, prices divided by the split ratio and volume multiplied by it
+func (q Quote) AdjustForSplits(splits ...Split) Quote {
+	adj := q
+	adj.Date = q.DateColumn()
+	adj.Open = q.OpenColumn()
+	adj.High = q.HighColumn()
+	adj.Low = q.LowColumn()
+	adj.Close = q.CloseColumn()
+	adj.Volume = q.VolumeColumn()
+	for _, split := range splits {
+		if split.Ratio <= 0 {
+			continue
+		}
+		for bar := 0; bar < len(adj.Close) && adj.Date[bar].Before(split.Date); bar++ {
+			adj.Open[bar] /= split.Ratio
+			adj.High[bar] /= split.Ratio
+			adj.Low[bar] /= split.Ratio
+			adj.Close[bar] /= split.Ratio
+			adj.Volume[bar] *= split.Ratio
 		}
+	}
+	return adj
+}
 
-		// Append to quote
-		bar := numrows - row // reverse the order
-		quote.Date[bar] = d
-		quote.Open[bar] = o * factor
-		quote.High[bar] = h * factor
-		quote.Low[bar] = l * factor
-		quote.Close[bar] = c * factor
-		quote.Volume[bar] = v
+// QuoteStats - summary statistics for a Quote
+type QuoteStats struct {
+	Symbol         string
+	Start          time.Time
+	End            time.Time
+	Bars           int
+	MinClose       float64
+	MaxClose       float64
+	MeanClose      float64
+	TotalVolume    float64
+	ZeroVolumeBars int
+}
 
+// Describe - summary statistics for a quick sanity check of downloaded data
+func (q Quote) Describe() QuoteStats {
+	stats := QuoteStats{Symbol: q.Symbol, Bars: len(q.Close)}
+	if stats.Bars == 0 {
+		return stats
+	}
+	stats.Start = q.Date[0]
+	stats.End = q.Date[stats.Bars-1]
+	stats.MinClose = q.Close[0]
+	stats.MaxClose = q.Close[0]
+	var sum float64
+	for bar := range q.Close {
+		stats.MinClose = math.Min(stats.MinClose, q.Close[bar])
+		stats.MaxClose = math.Max(stats.MaxClose, q.Close[bar])
+		sum += q.Close[bar]
+		stats.TotalVolume += q.Volume[bar]
+		if q.Volume[bar] == 0 {
+			stats.ZeroVolumeBars++
+		}
 	}
+	stats.MeanClose = sum / float64(stats.Bars)
+	return stats
+}
 
-	return quote, nil
+// String - pretty print QuoteStats
+func (s QuoteStats) String() string {
+	precision := getPrecision(s.Symbol)
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("symbol:       %s\n", s.Symbol))
+	buffer.WriteString(fmt.Sprintf("bars:         %d\n", s.Bars))
+	if s.Bars > 0 {
+		buffer.WriteString(fmt.Sprintf("start:        %s\n", s.Start.Format("2006-01-02 15:04")))
+		buffer.WriteString(fmt.Sprintf("end:          %s\n", s.End.Format("2006-01-02 15:04")))
+		buffer.WriteString(fmt.Sprintf("min close:    %.*f\n", precision, s.MinClose))
+		buffer.WriteString(fmt.Sprintf("max close:    %.*f\n", precision, s.MaxClose))
+		buffer.WriteString(fmt.Sprintf("mean close:   %.*f\n", precision, s.MeanClose))
+		buffer.WriteString(fmt.Sprintf("total volume: %.*f\n", precision, s.TotalVolume))
+		buffer.WriteString(fmt.Sprintf("zero volume:  %d\n", s.ZeroVolumeBars))
+	}
+	return buffer.String()
 }
-*/
 
-// NewQuotesFromYahoo - create a list of prices from symbols in file
-func NewQuotesFromYahoo(filename, startDate, endDate string, period Period, adjustQuote bool) (Quotes, error) {
+// Crossings - bars where the close crosses level. An up-cross is returned as
+// the positive bar index and a down-cross as the negative one; bar 0 has no
+// previous close so it never crosses. A close exactly at level doesn't cross,
+// the cross is reported at the first bar that closes on the other side of the
+// last close that wasn't at level.
+func (q Quote) Crossings(level float64) []int {
+	var crossings []int
+	side := 0
+	for bar, c := range q.Close {
+		s := 0
+		if c > level {
+			s = 1
+		} else if c < level {
+			s = -1
+		}
+		if s == 0 {
+			continue
+		}
+		if side != 0 && s != side {
+			crossings = append(crossings, s*bar)
+		}
+		side = s
+	}
+	return crossings
+}
 
-	quotes := Quotes{}
-	inFile, err := os.Open(filename)
-	if err != nil {
-		return quotes, err
+// VolumeProfile - volume traded at each of buckets evenly spaced price levels
+// between the lowest low and highest high. Each bar's volume is spread over
+// its high-low range in proportion to how much of each level it covers.
+// Returns the level midpoints and the volume per level.
+func (q Quote) VolumeProfile(buckets int) (levels []float64, volumes []float64) {
+	if buckets < 1 || len(q.Close) == 0 {
+		return []float64{}, []float64{}
 	}
-	defer inFile.Close()
+	lo, hi := q.Low[0], q.High[0]
+	for bar := range q.Close {
+		lo = math.Min(lo, q.Low[bar])
+		hi = math.Max(hi, q.High[bar])
+	}
+	width := (hi - lo) / float64(buckets)
+
+	levels = make([]float64, buckets)
+	volumes = make([]float64, buckets)
+	for i := range levels {
+		levels[i] = lo + (float64(i)+0.5)*width
+	}
+
+	bucketOf := func(price float64) int {
+		if width == 0 {
+			return 0
+		}
+		return int(math.Min(float64(buckets-1), math.Floor((price-lo)/width)))
+	}
+
+	for bar := range q.Close {
+		low, high := q.Low[bar], q.High[bar]
+		if high <= low {
+			volumes[bucketOf(low)] += q.Volume[bar]
+			continue
+		}
+		for i := bucketOf(low); i <= bucketOf(high); i++ {
+			bottom := lo + float64(i)*width
+			overlap := math.Min(high, bottom+width) - math.Max(low, bottom)
+			if overlap > 0 {
+				volumes[i] += q.Volume[bar] * overlap / (high - low)
+			}
+		}
+	}
+	return levels, volumes
+}
+
+// VolumeBin - volume traded between PriceLow and PriceHigh
+type VolumeBin struct {
+	PriceLow  float64
+	PriceHigh float64
+	Volume    float64
+}
+
+// VolumeProfileBins - VolumeProfile as bins with their price bounds, from
+// the lowest low up, each bar's volume spread over the bins its range covers
+func (q Quote) VolumeProfileBins(bins int) []VolumeBin {
+	levels, volumes := q.VolumeProfile(bins)
+	if len(levels) == 0 {
+		return []VolumeBin{}
+	}
+	lo, hi := q.Low[0], q.High[0]
+	for bar := range q.Close {
+		lo = math.Min(lo, q.Low[bar])
+		hi = math.Max(hi, q.High[bar])
+	}
+	width := (hi - lo) / float64(bins)
+	profile := make([]VolumeBin, bins)
+	for i := range profile {
+		profile[i] = VolumeBin{PriceLow: lo + float64(i)*width, PriceHigh: lo + float64(i+1)*width, Volume: volumes[i]}
+	}
+	profile[bins-1].PriceHigh = hi
+	return profile
+}
+
+// InferPeriod - period of the bars from the most common gap between consecutive
+// dates, e.g. for a csv file whose period wasn't recorded. Gaps of 28 to 31 days
+// count as Monthly, 89 to 92 days as Quarterly and 365 or 366 days as Yearly,
+// and the gap must be within 10% of a period's length. Fewer
+// than 2 bars, or gaps too irregular for the most common one to cover at least
+// half of them, is an error
+func (q Quote) InferPeriod() (Period, error) {
+	if len(q.Date) < 2 {
+		return "", errors.New("need at least 2 bars to infer a period")
+	}
+	counts := map[time.Duration]int{}
+	for bar := 1; bar < len(q.Date); bar++ {
+		gap := q.Date[bar].Sub(q.Date[bar-1])
+		switch day := 24 * time.Hour; {
+		case gap >= 28*day && gap <= 31*day+time.Hour:
+			gap = periodDuration(Monthly)
+		case gap >= 89*day && gap <= 92*day+time.Hour:
+			gap = periodDuration(Quarterly)
+		case gap >= 365*day && gap <= 366*day+time.Hour:
+			gap = periodDuration(Yearly)
+		}
+		counts[gap]++
+	}
+	var modal time.Duration
+	most := 0
+	for gap, n := range counts {
+		if n > most || n == most && gap < modal {
+			modal, most = gap, n
+		}
+	}
+	if 2*most < len(q.Date)-1 {
+		return "", errors.New("bar dates are too irregular to infer a period")
+	}
+
+	var closest Period
+	off := time.Duration(math.MaxInt64)
+	for _, p := range []Period{Min1, Min3, Min5, Min15, Min30, Min60, Hour2, Hour4, Hour6, Hour8, Hour12, Daily, Day3, Weekly, Monthly, Quarterly, Yearly} {
+		d := periodDuration(p) - modal
+		if d < 0 {
+			d = -d
+		}
+		if d < off {
+			closest, off = p, d
+		}
+	}
+	if off > periodDuration(closest)/10 {
+		return "", fmt.Errorf("bar gap of %v doesn't match any period", modal)
+	}
+	return closest, nil
+}
+
+// Resample - aggregate bars into a coarser period, each bar dated at the
+// start of its period, with the first open, high/low extremes, last close
+// and total volume. Bars must be in ascending order.
+func (q Quote) Resample(period Period) (Quote, error) {
+	if periodDuration(period) == 0 {
+		return NewQuote("", 0), fmt.Errorf("can't resample to period '%s'", period)
+	}
+	rs := NewQuote(q.Symbol, 0)
+	rs.Precision = q.Precision
+	last := -1
+	for bar := range q.Close {
+		start := periodStart(q.Date[bar], period)
+		if last < 0 || !start.Equal(rs.Date[last]) {
+			rs.Date = append(rs.Date, start)
+			rs.Open = append(rs.Open, q.Open[bar])
+			rs.High = append(rs.High, q.High[bar])
+			rs.Low = append(rs.Low, q.Low[bar])
+			rs.Close = append(rs.Close, q.Close[bar])
+			rs.Volume = append(rs.Volume, q.Volume[bar])
+			last++
+			continue
+		}
+		rs.High[last] = math.Max(rs.High[last], q.High[bar])
+		rs.Low[last] = math.Min(rs.Low[last], q.Low[bar])
+		rs.Close[last] = q.Close[bar]
+		rs.Volume[last] += q.Volume[bar]
+	}
+	return rs, nil
+}
+
+// Merge - q plus the bars of other at times q has no bar for, in date order.
+// Where both have a bar for the same period q's is kept. Daily and longer bars
+// match on their calendar date, whatever time zone each source stamps them in
+func (q Quote) Merge(other Quote) Quote {
+	key := mergeKey(q, other)
+	have := make(map[int64]bool, len(q.Date))
+	for _, date := range q.Date {
+		have[key(date)] = true
+	}
+	bars := q.Bars()
+	for i := range other.Close {
+		if !have[key(other.Date[i])] {
+			bars = append(bars, other.Bar(i))
+		}
+	}
+	sort.SliceStable(bars, func(i, j int) bool { return bars[i].Date.Before(bars[j].Date) })
+
+	m := NewQuote(q.Symbol, len(bars))
+	m.Precision = q.Precision
+	for i, b := range bars {
+		m.Date[i], m.Open[i], m.High[i], m.Low[i], m.Close[i], m.Volume[i] = b.Date, b.Open, b.High, b.Low, b.Close, b.Volume
+	}
+	return m
+}
+
+// mergeKey - what makes two bars the same bar when merging. Sources stamp
+// daily and longer bars at midnight in different time zones, so those match
+// on the calendar date of the period start. Intraday bars match on the period
+// they fall in, and bars of quotes with no inferable period on the exact time
+func mergeKey(q, other Quote) func(time.Time) int64 {
+	period, err := q.InferPeriod()
+	if err != nil {
+		period, err = other.InferPeriod()
+	}
+	if err != nil {
+		return func(t time.Time) int64 { return t.UnixNano() }
+	}
+	if periodDuration(period) >= periodDuration(Daily) {
+		return func(t time.Time) int64 {
+			year, month, day := periodStart(t, period).Date()
+			return int64(year)*10000 + int64(month)*100 + int64(day)
+		}
+	}
+	return func(t time.Time) int64 { return periodStart(t, period).UnixNano() }
+}
+
+// MergePreferred - union of the bars of q and other in date order, for
+// stitching histories from two sources. Where both have a bar for the same
+// period, matched as in Merge, other's is kept if preferOther, q's otherwise.
+// The quotes must be for the same symbol
+func (q Quote) MergePreferred(other Quote, preferOther bool) (Quote, error) {
+	if q.Symbol != other.Symbol {
+		return NewQuote("", 0), fmt.Errorf("can't merge quotes for different symbols %s and %s", q.Symbol, other.Symbol)
+	}
+	if !preferOther {
+		return q.Merge(other), nil
+	}
+	m := other.Merge(q)
+	m.Precision = q.Precision
+	return m, nil
+}
+
+// Normalize - copy of the quote in the state the rest of the library assumes:
+// bars in ascending date order, one bar per date with the last of any
+// duplicates kept, and every column the same length, longer columns being
+// cut to the shortest. Every downloader returns normalized quotes
+func (q Quote) Normalize() Quote {
+	n := len(q.Date)
+	for _, col := range [][]float64{q.Open, q.High, q.Low, q.Close, q.Volume} {
+		if len(col) < n {
+			n = len(col)
+		}
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	// stable, so duplicates stay in their original order
+	sort.SliceStable(order, func(i, j int) bool { return q.Date[order[i]].Before(q.Date[order[j]]) })
+
+	norm := NewQuote(q.Symbol, 0)
+	norm.Precision = q.Precision
+	norm.Raw = q.Raw
+	for _, bar := range order {
+		last := len(norm.Date) - 1
+		if last < 0 || !norm.Date[last].Equal(q.Date[bar]) {
+			norm.Date = append(norm.Date, q.Date[bar])
+			norm.Open = append(norm.Open, q.Open[bar])
+			norm.High = append(norm.High, q.High[bar])
+			norm.Low = append(norm.Low, q.Low[bar])
+			norm.Close = append(norm.Close, q.Close[bar])
+			norm.Volume = append(norm.Volume, q.Volume[bar])
+			continue
+		}
+		norm.Date[last], norm.Open[last], norm.High[last] = q.Date[bar], q.Open[bar], q.High[bar]
+		norm.Low[last], norm.Close[last], norm.Volume[last] = q.Low[bar], q.Close[bar], q.Volume[bar]
+	}
+	return norm
+}
+
+// SplitByYear - the bars of each calendar year, in the dates' own location,
+// as separate quotes keyed by year
+func (q Quote) SplitByYear() map[int]Quote {
+	years := make(map[int]Quote)
+	for bar := range q.Close {
+		year := q.Date[bar].Year()
+		y, ok := years[year]
+		if !ok {
+			y = NewQuote(q.Symbol, 0)
+			y.Precision = q.Precision
+		}
+		y.Date = append(y.Date, q.Date[bar])
+		y.Open = append(y.Open, q.Open[bar])
+		y.High = append(y.High, q.High[bar])
+		y.Low = append(y.Low, q.Low[bar])
+		y.Close = append(y.Close, q.Close[bar])
+		y.Volume = append(y.Volume, q.Volume[bar])
+		years[year] = y
+	}
+	return years
+}
+
+// Hash - hex SHA-256 of the symbol and every bar, the same for quotes with
+// the same content whatever their slice capacity, time zone, precision or
+// raw response, so a cache can tell whether a download changed anything
+func (q Quote) Hash() string {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, int64(len(q.Symbol)))
+	h.Write([]byte(q.Symbol))
+	binary.Write(h, binary.BigEndian, int64(len(q.Close)))
+	for bar := range q.Close {
+		binary.Write(h, binary.BigEndian, q.Date[bar].UnixNano())
+		for _, v := range []float64{q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar], q.Volume[bar]} {
+			binary.Write(h, binary.BigEndian, math.Float64bits(v))
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// filter - copy of the quote keeping only the bars where keep is true
+func (q Quote) filter(keep func(bar int) bool) Quote {
+	f := NewQuote(q.Symbol, 0)
+	f.Precision = q.Precision
+	for bar := range q.Close {
+		if !keep(bar) {
+			continue
+		}
+		f.Date = append(f.Date, q.Date[bar])
+		f.Open = append(f.Open, q.Open[bar])
+		f.High = append(f.High, q.High[bar])
+		f.Low = append(f.Low, q.Low[bar])
+		f.Close = append(f.Close, q.Close[bar])
+		f.Volume = append(f.Volume, q.Volume[bar])
+	}
+	return f
+}
+
+// Tail - the last n bars of the quote, all of them if it has fewer
+func (q Quote) Tail(n int) Quote {
+	first := len(q.Close) - n
+	return q.filter(func(bar int) bool { return bar >= first })
+}
+
+// EveryN - keep the bars at indices 0, n, 2n, ... to thin a dense quote for
+// charting. Unlike Resample this is decimation, not OHLC aggregation: the
+// highs, lows and volume of the skipped bars are dropped. n below 1 returns
+// an empty quote.
+func (q Quote) EveryN(n int) Quote {
+	if n < 1 {
+		return q.filter(func(bar int) bool { return false })
+	}
+	return q.filter(func(bar int) bool { return bar%n == 0 })
+}
+
+// BetweenHours - keep only bars whose time of day in loc falls within the
+// daily window [start, end), e.g. "09:30", "16:00" for the regular US session.
+// A nil loc uses Location. Invalid times return an empty quote.
+func (q Quote) BetweenHours(start, end string, loc *time.Location) Quote {
+	from, err := time.Parse("15:04", start)
+	if err != nil {
+		Log.Printf("invalid start time '%s'\n", start)
+		return NewQuote(q.Symbol, 0)
+	}
+	to, err := time.Parse("15:04", end)
+	if err != nil {
+		Log.Printf("invalid end time '%s'\n", end)
+		return NewQuote(q.Symbol, 0)
+	}
+	if loc == nil {
+		loc = Location
+	}
+	first := from.Hour()*60 + from.Minute()
+	last := to.Hour()*60 + to.Minute()
+	return q.filter(func(bar int) bool {
+		t := q.Date[bar].In(loc)
+		minute := t.Hour()*60 + t.Minute()
+		return minute >= first && minute < last
+	})
+}
+
+// Weekdays - drop bars that fall on a Saturday or Sunday
+func (q Quote) Weekdays() Quote {
+	return q.filter(func(bar int) bool {
+		day := q.Date[bar].Weekday()
+		return day != time.Saturday && day != time.Sunday
+	})
+}
+
+// SessionDaily - daily bars built only from the intraday bars inside the
+// session window [open, close) in the exchange's loc, e.g. "09:30", "16:00"
+// in America/New_York. Bars are grouped by loc's calendar day, so DST changes
+// don't move bars between days, and each daily bar is dated at midnight of
+// that day in Location like other daily quotes.
+func (q Quote) SessionDaily(loc *time.Location, open, close string) Quote {
+	if loc == nil {
+		loc = Location
+	}
+	session := q.BetweenHours(open, close, loc)
+	for bar := range session.Date {
+		session.Date[bar] = session.Date[bar].In(loc)
+	}
+	daily, _ := session.Resample(Daily)
+	for bar, date := range daily.Date {
+		year, month, day := date.Date()
+		daily.Date[bar] = time.Date(year, month, day, 0, 0, 0, 0, Location)
+	}
+	return daily
+}
+
+// BarsFromTrades - build OHLCV bars from a trade tape by bucketing each
+// trade (timestamp, price, size) into its period. Trades need not be sorted.
+// An unsupported period returns an empty quote.
+func BarsFromTrades(symbol string, ts []time.Time, price, size []float64, period Period) Quote {
+	n := len(ts)
+	if len(price) < n {
+		n = len(price)
+	}
+	if len(size) < n {
+		n = len(size)
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return ts[order[i]].Before(ts[order[j]]) })
+
+	if periodDuration(period) == 0 {
+		Log.Printf("can't build bars for period '%s'\n", period)
+		return NewQuote(symbol, 0)
+	}
+	bars := NewQuote(symbol, 0)
+	push := func(b Bar) {
+		bars.Date = append(bars.Date, b.Date)
+		bars.Open = append(bars.Open, b.Open)
+		bars.High = append(bars.High, b.High)
+		bars.Low = append(bars.Low, b.Low)
+		bars.Close = append(bars.Close, b.Close)
+		bars.Volume = append(bars.Volume, b.Volume)
+	}
+	acc := tradeBar{period: period}
+	for _, i := range order {
+		if bar, done := acc.add(ts[i], price[i], size[i]); done {
+			push(bar)
+		}
+	}
+	if bar, open := acc.flush(); open {
+		push(bar)
+	}
+	return bars
+}
+
+// tradeBar - accumulates trades into the OHLCV bar of their period, shared by
+// BarsFromTrades and the streaming feeds
+type tradeBar struct {
+	period Period
+	bar    Bar
+	open   bool
+}
+
+// add - fold a trade into the open bar. A trade of a later period completes
+// the open bar, which is returned with done set, and opens the next one
+func (b *tradeBar) add(t time.Time, price, size float64) (bar Bar, done bool) {
+	start := periodStart(t, b.period)
+	if b.open && start.After(b.bar.Date) {
+		bar, done = b.flush()
+	}
+	if !b.open {
+		b.bar = Bar{Date: start, Open: price, High: price, Low: price}
+		b.open = true
+	}
+	b.bar.High = math.Max(b.bar.High, price)
+	b.bar.Low = math.Min(b.bar.Low, price)
+	b.bar.Close = price
+	b.bar.Volume += size
+	return bar, done
+}
+
+// flush - close and return the open bar, open is false if there was none
+func (b *tradeBar) flush() (bar Bar, open bool) {
+	bar, open = b.bar, b.open
+	b.bar, b.open = Bar{}, false
+	return bar, open
+}
+
+// CSV - convert Quotes structure to csv string
+func (q Quotes) CSV() string {
+
+	var buffer bytes.Buffer
+
+	// every symbol shares the volume column, an index leaves it empty
+	buffer.WriteString(csvJoin("symbol", "datetime", "open", "high", "low", "close", "volume"))
+
+	for sym := 0; sym < len(q); sym++ {
+		quote := q[sym]
+		precision := getPrecision(quote.Symbol)
+		layout := quote.csvLayout()
+		for bar := range quote.Close {
+			buffer.WriteString(quote.Symbol + FieldSeparator + quote.csvLine(bar, precision, layout, true))
+		}
+	}
+
+	return buffer.String()
+}
+
+// Highstock - convert Quotes structure to Highstock json format
+func (q Quotes) Highstock() string {
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString("{")
+
+	for sym := 0; sym < len(q); sym++ {
+		quote := q[sym]
+		precision := getPrecision(quote.Symbol)
+		buffer.WriteString(fmt.Sprintf("\"%s\":[\n", quote.Symbol))
+		for bar := range quote.Close {
+			comma := ","
+			if bar == len(quote.Close)-1 {
+				comma = ""
+			}
+			str := fmt.Sprintf("[%d,%.*f,%.*f,%.*f,%.*f,%.*f]%s\n",
+				quote.Date[bar].UnixNano()/1000000, precision, quote.Open[bar], precision, quote.High[bar], precision, quote.Low[bar], precision, quote.Close[bar], precision, quote.Volume[bar], comma)
+			buffer.WriteString(str)
+		}
+		if sym < len(q)-1 {
+			buffer.WriteString("],\n")
+		} else {
+			buffer.WriteString("]\n")
+		}
+	}
+
+	buffer.WriteString("}")
+
+	return buffer.String()
+}
+
+// Amibroker - convert Quotes structure to csv string
+func (q Quotes) Amibroker() string {
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString("symbol,date,time,open,high,low,close,volume\n")
+
+	for sym := 0; sym < len(q); sym++ {
+		quote := q[sym]
+		precision := getPrecision(quote.Symbol)
+		for bar := range quote.Close {
+			str := fmt.Sprintf("%s,%s,%s,%.*f,%.*f,%.*f,%.*f,%.*f\n",
+				quote.Symbol, outputTime(quote.Date[bar]).Format("2006-01-02"), outputTime(quote.Date[bar]).Format("15:04"), precision, quote.Open[bar], precision, quote.High[bar], precision, quote.Low[bar], precision, quote.Close[bar], precision, quote.Volume[bar])
+			buffer.WriteString(str)
+		}
+	}
+
+	return buffer.String()
+}
+
+// WriteCSV - write Quotes structure to file
+func (q Quotes) WriteCSV(filename string) error {
+	if filename == "" {
+		filename = "quotes.csv"
+	}
+	csv := q.CSV()
+	ba := []byte(csv)
+	return os.WriteFile(filename, ba, 0644)
+}
+
+// WriteAmibroker - write Quotes structure to file
+func (q Quotes) WriteAmibroker(filename string) error {
+	if filename == "" {
+		filename = "quotes.csv"
+	}
+	csv := q.Amibroker()
+	ba := []byte(csv)
+	return os.WriteFile(filename, ba, 0644)
+}
+
+// NewQuotesFromCSV - parse csv quote string into Quotes array, sorted by symbol
+func NewQuotesFromCSV(csv string) (Quotes, error) {
+
+	tmp := csvLines(csv)
+
+	// group rows by symbol
+	var symbols []string
+	rows := make(map[string][][]string)
+	for idx := 1; idx < len(tmp); idx++ {
+		line := csvSplit(tmp[idx])
+		if len(line) != 7 {
+			continue
+		}
+		if _, ok := rows[line[0]]; !ok {
+			symbols = append(symbols, line[0])
+		}
+		rows[line[0]] = append(rows[line[0]], line)
+	}
+
+	quotes := Quotes{}
+	for _, sym := range symbols {
+		q := NewQuote(sym, len(rows[sym]))
+		for bar, line := range rows[sym] {
+			q.Date[bar], _ = parseCSVDate(line[1])
+			q.Open[bar], _ = parseCSVFloat(line[2])
+			q.High[bar], _ = parseCSVFloat(line[3])
+			q.Low[bar], _ = parseCSVFloat(line[4])
+			q.Close[bar], _ = parseCSVFloat(line[5])
+			q.Volume[bar], _ = parseCSVFloat(line[6])
+		}
+		quotes = append(quotes, q)
+	}
+	quotes.SortBySymbol()
+	return quotes, nil
+}
+
+// NewQuotesFromCSVStream - parse csv quotes from a reader into Quotes array,
+// sorted by symbol, a line at a time so huge files aren't held in memory
+func NewQuotesFromCSVStream(r io.Reader) (Quotes, error) {
+
+	quotes := Quotes{}
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for row := 0; scanner.Scan(); row++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if row == 0 {
+			continue
+		}
+		line := csvSplit(text)
+		if len(line) != 7 {
+			continue
+		}
+		sym, ok := index[line[0]]
+		if !ok {
+			sym = len(quotes)
+			index[line[0]] = sym
+			quotes = append(quotes, NewQuote(line[0], 0))
+		}
+		q := &quotes[sym]
+		var b Bar
+		b.Date, _ = parseCSVDate(line[1])
+		b.Open, _ = parseCSVFloat(line[2])
+		b.High, _ = parseCSVFloat(line[3])
+		b.Low, _ = parseCSVFloat(line[4])
+		b.Close, _ = parseCSVFloat(line[5])
+		b.Volume, _ = parseCSVFloat(line[6])
+		q.Date = append(q.Date, b.Date)
+		q.Open = append(q.Open, b.Open)
+		q.High = append(q.High, b.High)
+		q.Low = append(q.Low, b.Low)
+		q.Close = append(q.Close, b.Close)
+		q.Volume = append(q.Volume, b.Volume)
+	}
+	if err := scanner.Err(); err != nil {
+		return Quotes{}, err
+	}
+	quotes.SortBySymbol()
+	return quotes, nil
+}
+
+// SortBySymbol - sort quotes in place by symbol
+func (q Quotes) SortBySymbol() {
+	sort.SliceStable(q, func(i, j int) bool { return q[i].Symbol < q[j].Symbol })
+}
+
+// SortByFirstDate - sort quotes in place by the date of their first bar,
+// quotes without any bars go last
+func (q Quotes) SortByFirstDate() {
+	sort.SliceStable(q, func(i, j int) bool {
+		if len(q[i].Date) == 0 || len(q[j].Date) == 0 {
+			return len(q[j].Date) == 0 && len(q[i].Date) > 0
+		}
+		return q[i].Date[0].Before(q[j].Date[0])
+	})
+}
+
+// NewQuotesFromCSVFile - parse csv quote file into Quotes array
+func NewQuotesFromCSVFile(filename string) (Quotes, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Quotes{}, err
+	}
+	defer f.Close()
+	return NewQuotesFromCSVStream(f)
+}
+
+// JSON - convert Quotes struct to json string
+func (q Quotes) JSON(indent bool) string {
+	var j []byte
+	out := make(Quotes, len(q))
+	for sym := range q {
+		out[sym] = q[sym].outputDates()
+	}
+	q = out
+	if indent {
+		j, _ = json.MarshalIndent(q, "", "  ")
+	} else {
+		j, _ = json.Marshal(q)
+	}
+	return string(j)
+}
+
+// WriteJSON - write Quote struct to json file
+func (q Quotes) WriteJSON(filename string, indent bool) error {
+	if filename == "" {
+		filename = "quotes.json"
+	}
+	jsn := q.JSON(indent)
+	return os.WriteFile(filename, []byte(jsn), 0644)
+}
+
+// WriteHighstock - write Quote struct to json file in Highstock format
+func (q Quotes) WriteHighstock(filename string) error {
+	if filename == "" {
+		filename = "quotes.json"
+	}
+	hc := q.Highstock()
+	return os.WriteFile(filename, []byte(hc), 0644)
+}
+
+// GroupBy - bucket quotes by a key, e.g. sector or first letter of the symbol,
+// keeping their original order within each bucket
+func (q Quotes) GroupBy(key func(Quote) string) map[string]Quotes {
+	groups := make(map[string]Quotes)
+	for _, quote := range q {
+		k := key(quote)
+		groups[k] = append(groups[k], quote)
+	}
+	return groups
+}
+
+// Flatten - join parts of one symbol's history (e.g. files split by year)
+// back into a single time sorted quote. Bars repeated at the same time are
+// kept once, from the earliest part. Quotes for different symbols can't be
+// combined into one and return an error
+func (q Quotes) Flatten() (Quote, error) {
+	if len(q) == 0 {
+		return NewQuote("", 0), nil
+	}
+	flat := q[0].Merge(Quote{})
+	for _, quote := range q[1:] {
+		if quote.Symbol != flat.Symbol {
+			return NewQuote("", 0), fmt.Errorf("can't flatten quotes for different symbols %s and %s", flat.Symbol, quote.Symbol)
+		}
+		flat = flat.Merge(quote)
+	}
+	return flat, nil
+}
+
+// AlignDates - trim every quote to the dates present in all of them, so bar i
+// refers to the same time in each quote
+func (q Quotes) AlignDates() Quotes {
+	counts := make(map[int64]int)
+	for _, quote := range q {
+		seen := make(map[int64]bool, len(quote.Date))
+		for _, d := range quote.Date {
+			t := d.UnixNano()
+			if !seen[t] {
+				seen[t] = true
+				counts[t]++
+			}
+		}
+	}
+	aligned := make(Quotes, 0, len(q))
+	for _, quote := range q {
+		seen := make(map[int64]bool, len(quote.Date))
+		aligned = append(aligned, quote.filter(func(bar int) bool {
+			t := quote.Date[bar].UnixNano()
+			if seen[t] || counts[t] != len(q) {
+				return false
+			}
+			seen[t] = true
+			return true
+		}))
+	}
+	return aligned
+}
+
+// PadTo - copy of the quote with one bar for each of dates, in their order,
+// for lining up symbols with different histories without losing any. Dates q
+// has no bar for get fill, e.g. math.NaN() or 0, for every price and the
+// volume. Bars of q at times not in dates are left out
+func (q Quote) PadTo(dates []time.Time, fill float64) Quote {
+	index := make(map[int64]int, len(q.Date))
+	for bar, d := range q.Date {
+		index[d.UnixNano()] = bar
+	}
+	p := NewQuote(q.Symbol, len(dates))
+	p.Precision = q.Precision
+	for i, d := range dates {
+		p.Date[i] = d
+		if bar, ok := index[d.UnixNano()]; ok {
+			p.Open[i], p.High[i], p.Low[i], p.Close[i], p.Volume[i] = q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar], q.Volume[bar]
+		} else {
+			p.Open[i], p.High[i], p.Low[i], p.Close[i], p.Volume[i] = fill, fill, fill, fill, fill
+		}
+	}
+	return p
+}
+
+// Index - combine quotes into one synthetic "INDEX" quote over their common
+// dates. Each symbol is rebased so its first close is 100 and the index prices
+// are the weighted average of the rebased prices, volume is the sum. A nil
+// weights map weights every symbol equally, otherwise only the symbols in the
+// map are used and the weights are scaled to sum to one
+func (q Quotes) Index(weights map[string]float64) (Quote, error) {
+	index := NewQuote("INDEX", 0)
+	index.Precision = 2
+	if len(q) == 0 {
+		return index, errors.New("no quotes to index")
+	}
+
+	var members Quotes
+	var w []float64
+	if weights == nil {
+		members = q
+		for range q {
+			w = append(w, 1)
+		}
+	} else {
+		for symbol, weight := range weights {
+			if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+				return index, fmt.Errorf("invalid weight %v for %s", weight, symbol)
+			}
+			found := false
+			for _, quote := range q {
+				if quote.Symbol == symbol {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return index, fmt.Errorf("no quote for weighted symbol %s", symbol)
+			}
+		}
+		for _, quote := range q {
+			if weight, ok := weights[quote.Symbol]; ok && weight > 0 {
+				members = append(members, quote)
+				w = append(w, weight)
+			}
+		}
+	}
+	total := 0.0
+	for _, weight := range w {
+		total += weight
+	}
+	if total <= 0 {
+		return index, errors.New("index weights must sum to more than zero")
+	}
+
+	aligned := members.AlignDates()
+	bars := len(aligned[0].Close)
+	if bars == 0 {
+		return index, errors.New("quotes have no dates in common")
+	}
+	index = NewQuote("INDEX", bars)
+	index.Precision = 2
+	copy(index.Date, aligned[0].Date)
+	for i, quote := range aligned {
+		base := quote.Close[0]
+		if base == 0 {
+			return NewQuote("INDEX", 0), fmt.Errorf("%s has a zero close on %s, can't rebase", quote.Symbol, quote.Date[0].Format("2006-01-02"))
+		}
+		scale := 100 * w[i] / total / base
+		for bar := range index.Close {
+			index.Open[bar] += quote.Open[bar] * scale
+			index.High[bar] += quote.High[bar] * scale
+			index.Low[bar] += quote.Low[bar] * scale
+			index.Close[bar] += quote.Close[bar] * scale
+			index.Volume[bar] += quote.Volume[bar]
+		}
+	}
+	return index, nil
+}
+
+// NewQuotesFromJSON - parse json quote string into Quote structure
+func NewQuotesFromJSON(jsn string) (Quotes, error) {
+	quotes := Quotes{}
+	err := json.Unmarshal([]byte(jsn), &quotes)
+	if err != nil {
+		return quotes, err
+	}
+	return quotes, nil
+}
+
+// NewQuotesFromJSONFile - parse json quote string into Quote structure
+func NewQuotesFromJSONFile(filename string) (Quotes, error) {
+	jsn, err := os.ReadFile(filename)
+	if err != nil {
+		return Quotes{}, err
+	}
+	return NewQuotesFromJSON(string(jsn))
+}
+
+// ChartPNG - a png candlestick chart of the quote with a volume panel below
+// it, for a quick look that downloaded data is sane. Prices are ticked down
+// the right side and dates along the bottom in a small built in pixel font.
+// When there are more bars than fit, neighbouring bars are merged with
+// Downsample so that no two candles share a pixel column
+func (q Quote) ChartPNG(width, height int) ([]byte, error) {
+	if len(q.Close) == 0 {
+		return nil, errors.New("chart: quote has no bars")
+	}
+	if width < 32 || height < 32 {
+		return nil, fmt.Errorf("chart: %dx%d is too small", width, height)
+	}
+
+	var (
+		background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+		border     = color.RGBA{0xd0, 0xd0, 0xd0, 0xff}
+		grid       = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+		axis       = color.RGBA{0x40, 0x40, 0x40, 0xff}
+		up         = color.RGBA{0x26, 0xa6, 0x9a, 0xff}
+		down       = color.RGBA{0xef, 0x53, 0x50, 0xff}
+	)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill := func(x0, y0, x1, y1 int, c color.Color) {
+		draw.Draw(img, image.Rect(x0, y0, x1, y1), &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+	scale := 1 + height/500
+	text := func(x, y int, s string) {
+		for i, r := range s {
+			for row, bits := range chartFont[r] {
+				for col := 0; col < 3; col++ {
+					if bits&(4>>col) != 0 {
+						px, py := x+(4*i+col)*scale, y+row*scale
+						fill(px, py, px+scale, py+scale, axis)
+					}
+				}
+			}
+		}
+	}
+	fill(0, 0, width, height, background)
+
+	lo, hi, maxVol := q.Low[0], q.High[0], 0.0
+	for bar := range q.Close {
+		lo = math.Min(lo, q.Low[bar])
+		hi = math.Max(hi, q.High[bar])
+		maxVol = math.Max(maxVol, q.Volume[bar])
+	}
+	if hi == lo {
+		hi, lo = hi+1, lo-1
+	}
+	ticks, decimals := chartTicks(lo, hi)
+	labels, widest := make([]string, len(ticks)), 0
+	for i, tick := range ticks {
+		labels[i] = strconv.FormatFloat(tick, 'f', decimals, 64)
+		if len(labels[i]) > widest {
+			widest = len(labels[i])
+		}
+	}
+
+	// price panel over the top three quarters, volume below, price labels to
+	// the right and date labels underneath
+	const margin, tickLen = 4, 3
+	gap := 4 * scale // between a tick and its label, so the tick isn't read as a minus
+	plotLeft, plotRight := margin, width-margin-tickLen-gap-4*scale*widest
+	bottom := tickLen + 2 + 5*scale + margin
+	priceTop, priceBottom := margin, margin+(height-2*margin-bottom)*3/4
+	volTop, volBottom := priceBottom+margin, height-bottom
+	if plotRight-plotLeft < 8 || volBottom-volTop < 4 {
+		return nil, fmt.Errorf("chart: %dx%d is too small", width, height)
+	}
+	fill(plotLeft-1, priceTop-1, plotRight+1, priceBottom+1, border)
+	fill(plotLeft, priceTop, plotRight, priceBottom, background)
+	fill(plotLeft-1, volTop-1, plotRight+1, volBottom+1, border)
+	fill(plotLeft, volTop, plotRight, volBottom, background)
+
+	y := func(price float64) int {
+		return priceTop + int((hi-price)/(hi-lo)*float64(priceBottom-priceTop-1))
+	}
+	for i, tick := range ticks {
+		ty := y(tick)
+		fill(plotLeft, ty, plotRight, ty+1, grid)
+		fill(plotRight+1, ty, plotRight+1+tickLen, ty+1, axis)
+		ly := ty - 5*scale/2
+		ly = max(0, min(ly, height-5*scale))
+		text(plotRight+1+tickLen+gap, ly, labels[i])
+	}
+
+	// a candle and a pixel of space for each bar
+	plotW := plotRight - plotLeft
+	q = q.Downsample(plotW / 2)
+	step := float64(plotW) / float64(len(q.Close))
+	body := int(step * 0.7)
+	if body < 1 {
+		body = 1
+	}
+	x := func(bar int) int {
+		return plotLeft + int((float64(bar)+0.5)*step)
+	}
+
+	layout := "2006-01-02"
+	for _, date := range q.Date {
+		if date.Hour() != 0 || date.Minute() != 0 {
+			layout = "01-02 15:04"
+			break
+		}
+	}
+	labelW := 4 * scale * len(layout)
+	dates := min(len(q.Close), max(1, plotW/(labelW+4*margin)))
+	for i, next := 0, 0; i < dates; i++ {
+		bar := i * len(q.Close) / dates
+		tx := x(bar)
+		lx := max(0, min(tx-labelW/2, width-labelW))
+		if lx < next {
+			continue // the first label, pushed right to fit, overlaps this one
+		}
+		next = lx + labelW + margin
+		fill(tx, volBottom+1, tx+1, volBottom+1+tickLen, axis)
+		text(lx, volBottom+tickLen+2, q.Date[bar].Format(layout))
+	}
+
+	for bar := range q.Close {
+		c := up
+		if q.Close[bar] < q.Open[bar] {
+			c = down
+		}
+		cx := x(bar)
+		left := cx - body/2
+
+		fill(cx, y(q.High[bar]), cx+1, y(q.Low[bar])+1, c)
+		top, bottom := y(math.Max(q.Open[bar], q.Close[bar])), y(math.Min(q.Open[bar], q.Close[bar]))
+		fill(left, top, left+body, bottom+1, c)
+
+		if maxVol > 0 {
+			h := int(q.Volume[bar] / maxVol * float64(volBottom-volTop))
+			fill(left, volBottom-h, left+body, volBottom, c)
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// chartTicks - round price levels about a fifth of [lo, hi] apart, 1, 2 or 5
+// times a power of ten, and the decimals their labels need
+func chartTicks(lo, hi float64) ([]float64, int) {
+	want := (hi - lo) / 5
+	step := math.Pow(10, math.Floor(math.Log10(want)))
+	for _, m := range []float64{2, 2.5, 2} {
+		if step >= want {
+			break
+		}
+		step *= m
+	}
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step) - 1e-9))
+	}
+	var ticks []float64
+	pow := math.Pow(10, float64(decimals))
+	for i := math.Ceil(lo / step); i*step <= hi+step*1e-9; i++ {
+		tick := math.Round(i*step*pow) / pow
+		if tick == 0 {
+			tick = 0 // not -0
+		}
+		ticks = append(ticks, tick)
+	}
+	return ticks, decimals
+}
+
+// chartFont - 3x5 pixel glyphs for the chart labels, one byte per row with
+// the leftmost pixel in bit 2
+var chartFont = map[rune][5]byte{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'-': {0, 0, 7, 0, 0},
+	'.': {0, 0, 0, 0, 2},
+	':': {0, 2, 0, 2, 0},
+}
+
+// WriteChartPNG - write a ChartPNG candlestick chart to a png file
+func (q Quote) WriteChartPNG(filename string, width, height int) error {
+	if filename == "" {
+		filename = q.Symbol + ".png"
+	}
+	chart, err := q.ChartPNG(width, height)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, chart, 0644)
+}
+
+// SourceSpec - one source for NewQuoteMultiSource. Name is a source as used
+// by SupportedPeriods, Token the api token for the tiingo and eodhd sources,
+// Pool, when set, the tokens tiingo daily downloads rotate through and Adjust
+// whether yahoo prices are adjusted. Fetch, when set, is used instead of Name
+type SourceSpec struct {
+	Name   string
+	Token  string
+	Pool   *TokenPool
+	Adjust bool
+	Fetch  func(symbol, startDate, endDate string, period Period) (Quote, error)
+}
+
+func (s SourceSpec) download(symbol, startDate, endDate string, period Period) (Quote, error) {
+	return s.Download(symbol, ParseDateString(startDate), ParseDateString(endDate), period)
+}
+
+// Download - historical prices for a symbol from the source, for callers that
+// pick the source at run time
+func (s SourceSpec) Download(symbol string, from, to time.Time, period Period) (Quote, error) {
+	startDate, endDate := sourceDate(from), sourceDate(to)
+	if s.Fetch != nil {
+		return s.Fetch(symbol, startDate, endDate, period)
+	}
+	switch s.Name {
+	case "yahoo":
+		return NewQuoteFromYahoo(symbol, startDate, endDate, period, s.Adjust)
+	case "tiingo":
+		if s.Pool != nil {
+			return NewQuoteFromTiingoPool(symbol, startDate, endDate, s.Pool)
+		}
+		return NewQuoteFromTiingo(symbol, startDate, endDate, s.Token)
+	case "tiingo-crypto":
+		return NewQuoteFromTiingoCrypto(symbol, startDate, endDate, period, s.Token)
+	case "tiingo-fx":
+		return NewQuoteFromTiingoFX(symbol, startDate, endDate, period, s.Token)
+	case "coinbase":
+		return NewQuoteFromCoinbase(symbol, startDate, endDate, period)
+	case "coinbase-advanced":
+		return NewQuoteFromCoinbaseAdvanced(symbol, startDate, endDate, period)
+	case "deribit":
+		return NewQuoteFromDeribit(symbol, startDate, endDate, period)
+	case "gateio":
+		return NewQuoteFromGateIO(symbol, from, to, period)
+	case "bybit":
+		return NewQuoteFromBybit(symbol, from, to, period)
+	case "eodhd":
+		return NewQuoteFromEODHD(symbol, startDate, endDate, period, s.Token)
+	case "kraken":
+		return NewQuoteFromKraken(symbol, from, to, period)
+	case "mexc":
+		return NewQuoteFromMEXC(symbol, from, to, period)
+	}
+	return NewQuote("", 0), fmt.Errorf("invalid source '%s'", s.Name)
+}
+
+// sourceDate - t as a date string for the sources that take one, with the
+// time in UTC when it isn't midnight so ParseDateString gives t back
+func sourceDate(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+// NewQuoteMultiSource - historical prices for a symbol stitched together from
+// several sources in priority order. Each source fills the times the ones
+// before it have no bar for, so an older history from one can be extended with
+// recent data from another. Failing sources are skipped, the error is only
+// returned when none of them had any bars
+func NewQuoteMultiSource(symbol, startDate, endDate string, period Period, sources []SourceSpec) (Quote, error) {
+
+	merged := NewQuote(symbol, 0)
+	var errs []error
+	for i, source := range sources {
+		if i > 0 {
+			SleepDelay()
+		}
+		q, err := source.download(symbol, startDate, endDate, period)
+		if err != nil {
+			Log.Printf("%s: error downloading %s: %v\n", source.Name, symbol, err)
+			errs = append(errs, err)
+			continue
+		}
+		if len(merged.Close) == 0 {
+			merged.Precision = q.Precision
+		}
+		merged = merged.Merge(q)
+	}
+	if len(merged.Close) == 0 && len(errs) > 0 {
+		return merged, errors.Join(errs...)
+	}
+	return merged, nil
+}
+
+// tiingoTestURL - tiingo endpoint CheckSource uses to verify a token
+var tiingoTestURL = "https://api.tiingo.com/api/test"
+
+// symbols CheckSource downloads a few days of from each keyless source
+var checkSymbols = map[string]string{
+	"yahoo":             "spy",
+	"coinbase":          "BTC-USD",
+	"coinbase-advanced": "BTC-USD",
+	"deribit":           "BTC-PERPETUAL",
+	"gateio":            "BTC_USDT",
+	"bybit":             "BTCUSDT",
+	"eodhd":             "AAPL.US",
+	"kraken":            "XBTUSD",
+	"mexc":              "BTCUSDT",
+}
+
+// CheckSource - make a single cheap request to check a source is reachable
+// and, for the tiingo and eodhd sources, that token is accepted. Run it before a big
+// download so a bad token shows up before the first of thousands of symbols
+func CheckSource(source, token string) error {
+	switch source {
+	case "tiingo", "tiingo-crypto", "tiingo-fx":
+		return checkTiingo(token)
+	case "eodhd":
+		if token == "" {
+			return errors.New("eodhd requires a token")
+		}
+	}
+	symbol, ok := checkSymbols[source]
+	if !ok {
+		return fmt.Errorf("invalid source '%s'", source)
+	}
+	end := time.Now()
+	start := end.AddDate(0, 0, -7)
+	q, err := SourceSpec{Name: source, Token: token}.download(symbol, start.Format("2006-01-02"), end.Format("2006-01-02"), Daily)
+	if err != nil {
+		return fmt.Errorf("%s check failed: %v", source, err)
+	}
+	if len(q.Close) == 0 {
+		return fmt.Errorf("%s check returned no bars for %s", source, symbol)
+	}
+	return nil
+}
+
+func checkTiingo(token string) error {
+	if token == "" {
+		return errors.New("tiingo requires a token")
+	}
+	req, _ := http.NewRequest("GET", tiingoTestURL, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
+	resp, err := newClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("tiingo unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// a bad token gets {"detail": "Invalid token."}
+	var status struct {
+		Detail string `json:"detail"`
+	}
+	contents, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(contents, &status)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return errTiingoLimit
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || status.Detail != "":
+		if status.Detail == "" {
+			status.Detail = resp.Status
+		}
+		return fmt.Errorf("tiingo rejected the token: %s", status.Detail)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("tiingo error: %s", resp.Status)
+	}
+	return nil
+}
+
+// NormalizeSymbol - map a canonical symbol to the ticker format a source expects
+//
+// Canonical symbols use a "." share class separator (BRK.B) and a "/" pair
+// separator (BTC/USD). Symbols already in a source's native format are
+// returned unchanged, so it is safe to call more than once.
+func NormalizeSymbol(source, symbol string) string {
+	symbol = strings.TrimSpace(symbol)
+	switch source {
+	case "yahoo":
+		// keep exchange suffixes (VOD.L) but convert share classes (BRK.B)
+		if i := strings.LastIndex(symbol, "."); i > 0 && strings.Contains("AaBb", symbol[i+1:]) && len(symbol[i+1:]) == 1 {
+			symbol = symbol[:i] + "-" + symbol[i+1:]
+		}
+		symbol = strings.Replace(symbol, "/", "-", -1)
+	case "tiingo":
+		symbol = strings.NewReplacer(".", "-", "/", "-").Replace(symbol)
+	case "tiingo-crypto", "tiingo-fx":
+		symbol = strings.ToLower(strings.NewReplacer("/", "", "-", "", "_", "").Replace(symbol))
+	case "coinbase", "coinbase-advanced":
+		symbol = strings.ToUpper(strings.NewReplacer("/", "-", "_", "-").Replace(symbol))
+	case "deribit":
+		symbol = strings.ToUpper(symbol)
+	case "gateio":
+		symbol = strings.ToUpper(strings.NewReplacer("/", "_", "-", "_").Replace(symbol))
+	case "bybit", "binance", "mexc":
+		symbol = strings.ToUpper(strings.NewReplacer("/", "", "-", "", "_", "").Replace(symbol))
+	case "eodhd":
+		// exchange suffixes (VOD.LSE), US when there is none (BRK.B is BRK-B.US)
+		symbol = strings.ToUpper(strings.Replace(symbol, "/", "-", -1))
+		if i := strings.LastIndex(symbol, "."); i > 0 && len(symbol[i+1:]) == 1 && strings.Contains("AB", symbol[i+1:]) {
+			symbol = symbol[:i] + "-" + symbol[i+1:]
+		}
+		if !strings.Contains(symbol, ".") {
+			symbol += ".US"
+		}
+	}
+	return symbol
+}
+
+// NewQuoteFromYahoo - Yahoo historical prices for a symbol
+func NewQuoteFromYahoo(symbol, startDate, endDate string, period Period, adjustQuote bool) (Quote, error) {
+
+	var resp *http.Response
+	began := time.Now()
+
+	symbol = NormalizeSymbol("yahoo", symbol)
+
+	if err := checkPeriod("yahoo", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	client := newClient()
+
+	initReq, err := http.NewRequest("GET", "https://finance.yahoo.com", nil)
+	if err != nil {
+		return NewQuote("", 0), err
+	}
+	initReq.Header.Set("User-Agent", pickRandomUserAgent())
+	client.Do(initReq)
+
+	url := fmt.Sprintf(
+		"https://query2.finance.yahoo.com/v8/finance/chart/%s?period1=%d&period2=%d&interval=1d&events=history&corsDomain=finance.yahoo.com",
+		symbol,
+		from.Unix(),
+		to.Unix())
+	resp, err = client.Get(url)
+	// Error getting response from the client.
+	if err != nil {
+		Log.Printf("Error: symbol '%s' not found\n", symbol)
+		return NewQuote("", 0), err
+	}
+	defer resp.Body.Close()
+	// Read all bytes of the response body.
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		Log.Printf("Error: bad data for symbol '%s'\n", symbol)
+		return NewQuote("", 0), err
+	}
+	saveRaw("yahoo", symbol, respBody)
+	if resp.StatusCode == http.StatusNotFound {
+		Log.Printf("Error: symbol '%s' not found\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	}
+	quoteObj, err := parseYahooChart(symbol, respBody, adjustQuote)
+	if err != nil {
+		return NewQuote("", 0), err
+	}
+	if KeepRaw {
+		quoteObj.Raw = respBody
+	}
+
+	quoteObj = limitBars(quoteObj.Normalize(), Limit)
+	logBars(symbol, len(quoteObj.Close), began)
+	return quoteObj, nil
+}
+
+// parseYahooChart - parse a Yahoo chart api response. Bars without a close
+// are skipped, and missing opens, highs and lows fall back to the close and
+// missing volume to zero, as happens for indexes like ^GSPC and ^VIX
+func parseYahooChart(symbol string, respBody []byte, adjustQuote bool) (Quote, error) {
+	// Unmarshal the bytes into a dynamic JSON object.
+	var jsonResponse map[string]interface{}
+	err := json.Unmarshal(respBody, &jsonResponse)
+	if err != nil {
+		Log.Printf("Error: bad data for symbol '%s'\n", symbol)
+		return NewQuote("", 0), err
+	}
+	// Dynamically parse the tree of JSON to get the data we need.
+	chart, ok := jsonResponse["chart"].(map[string]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid chart structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid chart structure within JSON response for symbol '%s'", symbol)
+	}
+	result, ok := chart["result"].([]interface{})
+	if !ok || len(result) == 0 {
+		Log.Printf("Error: Invalid result structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid result structure within JSON response for symbol '%s'", symbol)
+	}
+	firstResult, ok := result[0].(map[string]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid result[0] structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid result[0] structure within JSON response for symbol '%s'", symbol)
+	}
+	timestamps, ok := firstResult["timestamp"].([]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid timestamp structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid timestamp structure within JSON response for symbol '%s'", symbol)
+	}
+	indicators, ok := firstResult["indicators"].(map[string]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid indicators structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid indicators structure within JSON response for symbol '%s'", symbol)
+	}
+	quote, ok := indicators["quote"].([]interface{})
+	if !ok || len(quote) == 0 {
+		Log.Printf("Error: Invalid quote structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid quote structure within JSON response for symbol '%s'", symbol)
+	}
+	firstQuote, ok := quote[0].(map[string]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid quote[0] structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid quote[0] structure within JSON response for symbol '%s'", symbol)
+	}
+	high, ok := firstQuote["high"].([]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid high structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid high structure within JSON response for symbol '%s'", symbol)
+	}
+	low, ok := firstQuote["low"].([]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid low structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid low structure within JSON response for symbol '%s'", symbol)
+	}
+	open, ok := firstQuote["open"].([]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid open structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid open structure within JSON response for symbol '%s'", symbol)
+	}
+	// indexes can come without any volume
+	volume, _ := firstQuote["volume"].([]interface{})
+	close, ok := firstQuote["close"].([]interface{})
+	if !ok {
+		Log.Printf("Error: Invalid close structure within JSON response for symbol '%s'\n", symbol)
+		return NewQuote("", 0), fmt.Errorf("invalid close structure within JSON response for symbol '%s'", symbol)
+	}
+	// indexes can come without adjusted closes, use the closes
+	adjClose := close
+	if adjCloseObj, ok := indicators["adjclose"].([]interface{}); ok && len(adjCloseObj) > 0 {
+		if firstAdjClose, ok := adjCloseObj[0].(map[string]interface{}); ok {
+			if a, ok := firstAdjClose["adjclose"].([]interface{}); ok && len(a) == len(close) {
+				adjClose = a
+			}
+		}
+	}
+
+	for _, column := range [][]interface{}{high, low, open, close, volume} {
+		if column != nil && len(column) != len(timestamps) {
+			Log.Printf("Error: Invalid column length within JSON response for symbol '%s'\n", symbol)
+			return NewQuote("", 0), fmt.Errorf("invalid column length within JSON response for symbol '%s'", symbol)
+		}
+	}
+
+	quoteObj := NewQuote(symbol, 0)
+	for row := 0; row < len(timestamps); row++ {
+
+		ts, tok := timestamps[row].(float64)
+		c, cok := close[row].(float64)
+		a, aok := adjClose[row].(float64)
+		if !tok || !cok || !aok {
+			continue
+		}
+		o := yahooValue(open[row], c)
+		h := yahooValue(high[row], c)
+		l := yahooValue(low[row], c)
+		v := 0.0
+		if volume != nil {
+			v = yahooValue(volume[row], 0)
+		}
+
+		// Adjustment ratio
+		if adjustQuote {
+			c = a
+		} else {
+			ratio := c / a
+			o, h, l = o*ratio, h*ratio, l*ratio
+		}
+
+		quoteObj.Date = append(quoteObj.Date, unixTime(int64(ts)))
+		quoteObj.Open = append(quoteObj.Open, o)
+		quoteObj.High = append(quoteObj.High, h)
+		quoteObj.Low = append(quoteObj.Low, l)
+		quoteObj.Close = append(quoteObj.Close, c)
+		quoteObj.Volume = append(quoteObj.Volume, v)
+	}
+	return quoteObj, nil
+}
+
+// yahooValue - a Yahoo chart number, or def when it's null
+func yahooValue(v interface{}, def float64) float64 {
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	return def
+}
+
+/*
+func NewQuoteFromYahoo(symbol, startDate, endDate string, period Period, adjustQuote bool) (Quote, error) {
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	url := fmt.Sprintf(
+		"http://ichart.yahoo.com/table.csv?s=%s&a=%d&b=%d&c=%d&d=%d&e=%d&f=%d&g=%s&ignore=.csv",
+		symbol,
+		from.Month()-1, from.Day(), from.Year(),
+		to.Month()-1, to.Day(), to.Year(),
+		period)
+	resp, err := http.Get(url)
+	if err != nil {
+		Log.Printf("symbol '%s' not found\n", symbol)
+		return NewQuote("", 0), err
+	}
+	defer resp.Body.Close()
+
+	var csvdata [][]string
+	reader := csv.NewReader(resp.Body)
+	csvdata, err = reader.ReadAll()
+	if err != nil {
+		Log.Printf("bad data for symbol '%s'\n", symbol)
+		return NewQuote("", 0), err
+	}
+
+	numrows := len(csvdata) - 1
+	quote := NewQuote(symbol, numrows)
+
+	for row := 1; row < len(csvdata); row++ {
+
+		// Parse row of data
+		d, _ := time.Parse("2006-01-02", csvdata[row][0])
+		o, _ := strconv.ParseFloat(csvdata[row][1], 64)
+		h, _ := strconv.ParseFloat(csvdata[row][2], 64)
+		l, _ := strconv.ParseFloat(csvdata[row][3], 64)
+		c, _ := strconv.ParseFloat(csvdata[row][4], 64)
+		v, _ := strconv.ParseFloat(csvdata[row][5], 64)
+		a, _ := strconv.ParseFloat(csvdata[row][6], 64)
+
+		// Adjustment factor
+		factor := 1.0
+		if adjustQuote {
+			factor = a / c
+		}
+
+		// Append to quote
+		bar := numrows - row // reverse the order
+		quote.Date[bar] = d
+		quote.Open[bar] = o * factor
+		quote.High[bar] = h * factor
+		quote.Low[bar] = l * factor
+		quote.Close[bar] = c * factor
+		quote.Volume[bar] = v
+
+	}
+
+	return quote, nil
+}
+*/
+
+// NewQuotesFromYahoo - create a list of prices from symbols in file
+func NewQuotesFromYahoo(filename, startDate, endDate string, period Period, adjustQuote bool) (Quotes, error) {
+
+	quotes := Quotes{}
+	inFile, err := os.Open(filename)
+	if err != nil {
+		return quotes, err
+	}
+	defer inFile.Close()
+	scanner := bufio.NewScanner(inFile)
+	scanner.Split(bufio.ScanLines)
+
+	failed, total := 0, 0
+	for scanner.Scan() {
+		sym := scanner.Text()
+		total++
+		quote, err := NewQuoteFromYahoo(sym, startDate, endDate, period, adjustQuote)
+		if err == nil {
+			quotes = append(quotes, quote)
+		} else {
+			failed++
+			Log.Println("error downloading " + sym)
+		}
+		SleepDelay()
+	}
+	return quotes, batchError(failed, total)
+}
+
+// NewQuotesFromYahooSyms - create a list of prices from symbols in string array
+func NewQuotesFromYahooSyms(symbols []string, startDate, endDate string, period Period, adjustQuote bool) (Quotes, error) {
+	quotes, _, err := NewQuotesFromYahooSymsWithErrors(symbols, startDate, endDate, period, adjustQuote)
+	return quotes, err
+}
+
+// NewQuotesFromYahooSymsWithErrors - same as NewQuotesFromYahooSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromYahooSymsWithErrors(symbols []string, startDate, endDate string, period Period, adjustQuote bool) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromYahoo(symbol, startDate, endDate, period, adjustQuote)
+	})
+}
+
+// errTiingoLimit - token has run over its request allocation
+var errTiingoLimit = errors.New("tiingo request limit reached")
+
+// TokenPool - set of Tiingo api tokens used in turn as each one hits its rate limit
+type TokenPool struct {
+	mu     sync.Mutex
+	tokens []string
+	next   int
+}
+
+// NewTokenPool - new TokenPool from a comma separated list of tokens
+func NewTokenPool(tokens string) *TokenPool {
+	pool := &TokenPool{}
+	for _, token := range strings.Split(tokens, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			pool.tokens = append(pool.tokens, token)
+		}
+	}
+	return pool
+}
+
+// Token - token currently in use
+func (p *TokenPool) Token() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[p.next]
+}
+
+// Len - number of tokens in the pool
+func (p *TokenPool) Len() int {
+	return len(p.tokens)
+}
+
+// move on from a rate limited token, unless another caller already has
+func (p *TokenPool) rotate(limited string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.tokens) > 0 && p.tokens[p.next] == limited {
+		p.next = (p.next + 1) % len(p.tokens)
+	}
+}
+
+// TiingoColumns - have tiingo daily downloads that only need adjusted prices
+// request just the adjusted columns, shrinking the responses, and Raw, of
+// large pulls. The downloaded quotes are the same (default=false)
+var TiingoColumns bool
+
+// the columns requested with TiingoColumns
+const tiingoAdjustedColumns = "date,adjOpen,adjHigh,adjLow,adjClose,volume"
+
+// tiingoDailyURL - tiingo end of day prices endpoint
+var tiingoDailyURL = "https://api.tiingo.com/tiingo/daily"
+
+// tiingoCryptoURL - tiingo crypto endpoint, prices and the list of tickers
+var tiingoCryptoURL = "https://api.tiingo.com/tiingo/crypto"
+
+func tiingoDaily(symbol string, from, to time.Time, token string) (Quote, error) {
+	columns := ""
+	if TiingoColumns {
+		columns = tiingoAdjustedColumns
+	}
+	adjusted, _, err := tiingoDailyBoth(symbol, from, to, token, columns)
+	return adjusted, err
+}
+
+// TiingoChunkDays - longest date range requested from tiingo at once. Longer
+// daily and crypto downloads are split into chunks of this many days that are
+// joined back together, avoiding plan limits and timeouts (0 disables)
+var TiingoChunkDays = 3650
+
+// tiingoChunks - [from, to] split into TiingoChunkDays ranges. Each chunk starts
+// on the day the one before it ends, tiingoJoin drops the repeated bars
+func tiingoChunks(from, to time.Time) [][2]time.Time {
+	var chunks [][2]time.Time
+	start := from
+	for TiingoChunkDays > 0 {
+		end := start.AddDate(0, 0, TiingoChunkDays)
+		if !end.Before(to) {
+			break
+		}
+		chunks = append(chunks, [2]time.Time{start, end})
+		start = end
+	}
+	return append(chunks, [2]time.Time{start, to})
+}
+
+// tiingoJoin - q followed by the bars of the next chunk after its last date,
+// raw responses one json document per chunk, newline separated
+func tiingoJoin(q, next Quote) Quote {
+	bar := 0
+	if n := len(q.Date); n > 0 {
+		for bar < len(next.Date) && !next.Date[bar].After(q.Date[n-1]) {
+			bar++
+		}
+	}
+	q.Date = append(q.Date, next.Date[bar:]...)
+	q.Open = append(q.Open, next.Open[bar:]...)
+	q.High = append(q.High, next.High[bar:]...)
+	q.Low = append(q.Low, next.Low[bar:]...)
+	q.Close = append(q.Close, next.Close[bar:]...)
+	q.Volume = append(q.Volume, next.Volume[bar:]...)
+	if KeepRaw {
+		q.Raw = append(append(q.Raw, '\n'), next.Raw...)
+	}
+	return q
+}
+
+// tiingoDailyBoth - adjusted and unadjusted prices from tiingo daily responses,
+// one per chunk of the date range
+func tiingoDailyBoth(symbol string, from, to time.Time, token, columns string) (Quote, Quote, error) {
+
+	began := time.Now()
+	symbol = NormalizeSymbol("tiingo", symbol)
+
+	var quote, raw Quote
+	for i, chunk := range tiingoChunks(from, to) {
+		if i > 0 {
+			SleepDelay()
+		}
+		q, r, err := tiingoDailyFetch(symbol, chunk[0], chunk[1], token, columns)
+		if err != nil {
+			return NewQuote("", 0), NewQuote("", 0), err
+		}
+		if i == 0 {
+			quote, raw = q, r
+		} else {
+			quote, raw = tiingoJoin(quote, q), tiingoJoin(raw, r)
+		}
+	}
+
+	if quote.HasNonPositivePrices() {
+		Log.Printf("warning: tiingo symbol '%s' has zero or negative adjusted prices\n", symbol)
+	}
+
+	quote, raw = limitBars(quote.Normalize(), Limit), limitBars(raw.Normalize(), Limit)
+	logBars(symbol, len(quote.Close), began)
+	return quote, raw, nil
+}
+
+// tiingoDailyFetch - adjusted and unadjusted prices from one tiingo daily
+// response, with only the given comma separated columns when set
+func tiingoDailyFetch(symbol string, from, to time.Time, token, columns string) (Quote, Quote, error) {
+
+	type tquote struct {
+		AdjClose    float64 `json:"adjClose"`
+		AdjHigh     float64 `json:"adjHigh"`
+		AdjLow      float64 `json:"adjLow"`
+		AdjOpen     float64 `json:"adjOpen"`
+		AdjVolume   float64 `json:"adjVolume"`
+		Close       float64 `json:"close"`
+		Date        string  `json:"date"`
+		DivCash     float64 `json:"divCash"`
+		High        float64 `json:"high"`
+		Low         float64 `json:"low"`
+		Open        float64 `json:"open"`
+		SplitFactor float64 `json:"splitFactor"`
+		Volume      float64 `json:"volume"`
+	}
+
+	var tiingo []tquote
+
+	url := fmt.Sprintf(
+		"%s/%s/prices?startDate=%s&endDate=%s",
+		tiingoDailyURL,
+		symbol,
+		url.QueryEscape(from.Format("2006-1-2")),
+		url.QueryEscape(to.Format("2006-1-2")))
+	if columns != "" {
+		url += "&columns=" + columns
+	}
+
+	client := newClient()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
+	resp, err := client.Do(req)
+
+	if err != nil {
+		Log.Printf("tiingo error: %v\n", err)
+		return NewQuote("", 0), NewQuote("", 0), err
+	}
+	defer resp.Body.Close()
+
+	var contents []byte
+	if resp.StatusCode == http.StatusOK {
+		contents, _ = io.ReadAll(resp.Body)
+		saveRaw("tiingo", symbol, contents)
+		err = json.Unmarshal(contents, &tiingo)
+		if err != nil {
+			if strings.Contains(string(contents), "request allocation") {
+				Log.Printf("tiingo error: %s\n", contents)
+				return NewQuote("", 0), NewQuote("", 0), errTiingoLimit
+			}
+			Log.Printf("tiingo error: %v\n", err)
+			return NewQuote("", 0), NewQuote("", 0), err
+		}
+	} else if resp.StatusCode == http.StatusTooManyRequests {
+		Log.Printf("tiingo error: %s\n", resp.Status)
+		return NewQuote("", 0), NewQuote("", 0), errTiingoLimit
+	} else if resp.StatusCode == http.StatusNotFound {
+		Log.Printf("symbol '%s' not found\n", symbol)
+		return NewQuote("", 0), NewQuote("", 0), fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	} else {
+		Log.Printf("tiingo error: %s\n", resp.Status)
+		return NewQuote("", 0), NewQuote("", 0), statusError("tiingo", symbol, resp)
+	}
+
+	numrows := len(tiingo)
+	quote := NewQuote(symbol, numrows)
+	raw := NewQuote(symbol, numrows)
+	if KeepRaw {
+		quote.Raw = contents
+		raw.Raw = contents
+	}
+
+	for bar := 0; bar < numrows; bar++ {
+		quote.Date[bar], _ = time.ParseInLocation("2006-01-02", tiingo[bar].Date[0:10], Location)
+		quote.Open[bar] = tiingo[bar].AdjOpen
+		quote.High[bar] = tiingo[bar].AdjHigh
+		quote.Low[bar] = tiingo[bar].AdjLow
+		quote.Close[bar] = tiingo[bar].AdjClose
+		quote.Volume[bar] = float64(tiingo[bar].Volume)
+
+		raw.Date[bar] = quote.Date[bar]
+		raw.Open[bar] = tiingo[bar].Open
+		raw.High[bar] = tiingo[bar].High
+		raw.Low[bar] = tiingo[bar].Low
+		raw.Close[bar] = tiingo[bar].Close
+		raw.Volume[bar] = tiingo[bar].Volume
+	}
+	return quote, raw, nil
+}
+
+type tiingoCryptoPrice struct {
+	TradesDone     float64 `json:"tradesDone"`
+	Close          float64 `json:"close"`
+	VolumeNotional float64 `json:"volumeNotional"`
+	Low            float64 `json:"low"`
+	Open           float64 `json:"open"`
+	Date           string  `json:"date"` // "2017-12-19T00:00:00Z"
+	High           float64 `json:"high"`
+	Volume         float64 `json:"volume"`
+}
+
+type tiingoCryptoData struct {
+	Ticker        string              `json:"ticker"`
+	BaseCurrency  string              `json:"baseCurrency"`
+	QuoteCurrency string              `json:"quoteCurrency"`
+	PriceData     []tiingoCryptoPrice `json:"priceData"`
+}
+
+// tiingoResampleFreq - tiingo crypto resampleFreq for a period
+func tiingoResampleFreq(period Period) string {
+	switch period {
+	case Min1:
+		return "1min"
+	case Min3:
+		return "3min"
+	case Min5:
+		return "5min"
+	case Min15:
+		return "15min"
+	case Min30:
+		return "30min"
+	case Min60:
+		return "1hour"
+	case Hour2:
+		return "2hour"
+	case Hour4:
+		return "4hour"
+	case Hour6:
+		return "6hour"
+	case Hour8:
+		return "8hour"
+	case Hour12:
+		return "12hour"
+	case Day3:
+		return "3day"
+	case Weekly:
+		return "7day"
+	case Monthly:
+		return "30day"
+	}
+	return "1day"
+}
+
+// tiingoCryptoFetch - request one or more comma separated tickers from the tiingo crypto endpoint
+func tiingoCryptoFetch(tickers string, from, to time.Time, resampleFreq, token string) ([]tiingoCryptoData, []byte, error) {
+
+	var crypto []tiingoCryptoData
+
+	url := fmt.Sprintf(
+		"%s/prices?tickers=%s&startDate=%s&endDate=%s&resampleFreq=%s",
+		tiingoCryptoURL,
+		tickers,
+		url.QueryEscape(from.Format("2006-1-2")),
+		url.QueryEscape(to.Format("2006-1-2")),
+		url.QueryEscape(resampleFreq))
+
+	client := newClient()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
+	resp, err := client.Do(req)
+
+	if err != nil {
+		Log.Printf("symbol '%s' not found\n", tickers)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		Log.Printf("tiingo crypto error: %s\n", resp.Status)
+		return nil, nil, statusError("tiingo-crypto", tickers, resp)
+	}
+
+	contents, _ := io.ReadAll(resp.Body)
+	saveRaw("tiingo-crypto", tickers, contents)
+	err = json.Unmarshal(contents, &crypto)
+	if err != nil {
+		Log.Printf("tiingo crypto symbol '%s' error: %v\n", tickers, err)
+		return nil, nil, err
+	}
+	return crypto, contents, nil
+}
+
+// tiingoCryptoQuote - convert one element of a tiingo crypto response to a quote
+func tiingoCryptoQuote(symbol string, data tiingoCryptoData) Quote {
+
+	numrows := len(data.PriceData)
+	quote := NewQuote(symbol, numrows)
+
+	for bar := 0; bar < numrows; bar++ {
+		date, _ := time.Parse(time.RFC3339, data.PriceData[bar].Date)
+		quote.Date[bar] = date.In(Location)
+		quote.Open[bar] = data.PriceData[bar].Open
+		quote.High[bar] = data.PriceData[bar].High
+		quote.Low[bar] = data.PriceData[bar].Low
+		quote.Close[bar] = data.PriceData[bar].Close
+		quote.Volume[bar] = data.PriceData[bar].Volume
+	}
+	return quote
+}
+
+func tiingoCrypto(symbol string, from, to time.Time, resampleFreq, token string) (Quote, error) {
+
+	began := time.Now()
+	symbol = NormalizeSymbol("tiingo-crypto", symbol)
+
+	var quote Quote
+	found := false
+	for i, chunk := range tiingoChunks(from, to) {
+		if i > 0 {
+			SleepDelay()
+		}
+		crypto, contents, err := tiingoCryptoFetch(symbol, chunk[0], chunk[1], resampleFreq, token)
+		if err != nil {
+			return NewQuote("", 0), err
+		}
+		q := NewQuote(symbol, 0)
+		if len(crypto) > 0 {
+			q = tiingoCryptoQuote(symbol, crypto[0])
+			found = true
+		}
+		if KeepRaw {
+			q.Raw = contents
+		}
+		if i == 0 {
+			quote = q
+		} else {
+			quote = tiingoJoin(quote, q)
+		}
+	}
+	if !found {
+		Log.Printf("tiingo crypto symbol '%s' No data returned", symbol)
+		return NewQuote("", 0), fmt.Errorf("%w: tiingo crypto returned no data for %s", ErrSymbolNotFound, symbol)
+	}
+
+	quote = limitBars(quote.Normalize(), Limit)
+	logBars(symbol, len(quote.Close), began)
+	return quote, nil
+}
+
+// NewQuoteFromTiingo - Tiingo daily historical prices for a symbol
+func NewQuoteFromTiingo(symbol, startDate, endDate string, token string) (Quote, error) {
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	return tiingoDaily(symbol, from, to, token)
+}
+
+// NewQuoteBothFromTiingo - Tiingo daily adjusted and unadjusted historical prices
+// for a symbol, parsed from a single request
+func NewQuoteBothFromTiingo(symbol, startDate, endDate string, token string) (adjusted, unadjusted Quote, err error) {
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	return tiingoDailyBoth(symbol, from, to, token, "")
+}
+
+// NewQuoteFromTiingoPool - Tiingo daily historical prices for a symbol,
+// rotating through the pool's tokens when one hits its rate limit
+func NewQuoteFromTiingoPool(symbol, startDate, endDate string, pool *TokenPool) (Quote, error) {
+
+	if pool.Len() == 0 {
+		return NewQuote("", 0), errors.New("no tiingo tokens in pool")
+	}
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	for try := 0; try < pool.Len(); try++ {
+		token := pool.Token()
+		quote, err := tiingoDaily(symbol, from, to, token)
+		if err != errTiingoLimit {
+			return quote, err
+		}
+		pool.rotate(token)
+	}
+	return NewQuote("", 0), fmt.Errorf("all %d tiingo tokens are rate limited", pool.Len())
+}
+
+// NewQuoteFromTiingoFX - Tiingo forex historical prices for a pair (eurusd),
+// fx prices have no volume so it is always zero
+func NewQuoteFromTiingoFX(symbol, startDate, endDate string, period Period, token string) (Quote, error) {
+
+	began := time.Now()
+	symbol = NormalizeSymbol("tiingo-fx", symbol)
+
+	if err := checkPeriod("tiingo-fx", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	url := fmt.Sprintf(
+		"https://api.tiingo.com/tiingo/fx/%s/prices?startDate=%s&endDate=%s&resampleFreq=%s",
+		symbol,
+		url.QueryEscape(from.Format("2006-1-2")),
+		url.QueryEscape(to.Format("2006-1-2")),
+		tiingoResampleFreq(period))
+
+	client := newClient()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
+	resp, err := client.Do(req)
+
+	if err != nil {
+		Log.Printf("tiingo fx error: %v\n", err)
+		return NewQuote("", 0), err
+	}
+	defer resp.Body.Close()
+
+	contents, _ := io.ReadAll(resp.Body)
+	saveRaw("tiingo-fx", symbol, contents)
+	if resp.StatusCode != http.StatusOK {
+		Log.Printf("tiingo fx error: %s\n", resp.Status)
+		return NewQuote("", 0), statusError("tiingo fx", symbol, resp)
+	}
+
+	quote, err := parseTiingoFX(symbol, contents)
+	if err != nil {
+		Log.Printf("tiingo fx symbol '%s' error: %v\n", symbol, err)
+		return NewQuote("", 0), err
+	}
+	if KeepRaw {
+		quote.Raw = contents
+	}
+
+	quote = limitBars(quote.Normalize(), Limit)
+	logBars(symbol, len(quote.Close), began)
+	return quote, nil
+}
+
+// parseTiingoFX - tiingo fx prices are a list of bars without volume
+func parseTiingoFX(symbol string, contents []byte) (Quote, error) {
+
+	type fxPrice struct {
+		Date  string  `json:"date"` // "2019-06-24T00:00:00.000Z"
+		Open  float64 `json:"open"`
+		High  float64 `json:"high"`
+		Low   float64 `json:"low"`
+		Close float64 `json:"close"`
+	}
+
+	var fx []fxPrice
+	if err := json.Unmarshal(contents, &fx); err != nil {
+		return NewQuote("", 0), err
+	}
+
+	quote := NewQuote(symbol, len(fx))
+	for bar := range fx {
+		date, _ := time.Parse(time.RFC3339, fx[bar].Date)
+		quote.Date[bar] = date.In(Location)
+		quote.Open[bar] = fx[bar].Open
+		quote.High[bar] = fx[bar].High
+		quote.Low[bar] = fx[bar].Low
+		quote.Close[bar] = fx[bar].Close
+	}
+	return quote, nil
+}
+
+// NewQuotesFromTiingoFXSyms - create a list of prices from symbols in string array
+func NewQuotesFromTiingoFXSyms(symbols []string, startDate, endDate string, period Period, token string) (Quotes, error) {
+	quotes, _, err := NewQuotesFromTiingoFXSymsWithErrors(symbols, startDate, endDate, period, token)
+	return quotes, err
+}
+
+// NewQuotesFromTiingoFXSymsWithErrors - same as NewQuotesFromTiingoFXSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromTiingoFXSymsWithErrors(symbols []string, startDate, endDate string, period Period, token string) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromTiingoFX(symbol, startDate, endDate, period, token)
+	})
+}
+
+// NewQuoteFromTiingoCrypto - Tiingo crypto historical prices for a symbol
+func NewQuoteFromTiingoCrypto(symbol, startDate, endDate string, period Period, token string) (Quote, error) {
+
+	if err := checkPeriod("tiingo-crypto", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	return tiingoCrypto(symbol, from, to, tiingoResampleFreq(period), token)
+}
+
+// NewQuoteFromTiingoCryptoFreq - Tiingo crypto historical prices for a symbol
+// at any tiingo resampleFreq, e.g. "90min" or "2day", for intervals without a Period
+func NewQuoteFromTiingoCryptoFreq(symbol, startDate, endDate, resampleFreq, token string) (Quote, error) {
+
+	if strings.TrimSpace(resampleFreq) == "" {
+		return NewQuote("", 0), errors.New("tiingo crypto resampleFreq is empty")
+	}
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	return tiingoCrypto(symbol, from, to, strings.TrimSpace(resampleFreq), token)
+}
+
+// NewQuotesFromTiingoSyms - create a list of prices from symbols in string array
+func NewQuotesFromTiingoSyms(symbols []string, startDate, endDate string, token string) (Quotes, error) {
+	quotes, _, err := NewQuotesFromTiingoSymsWithErrors(symbols, startDate, endDate, token)
+	return quotes, err
+}
+
+// NewQuotesFromTiingoSymsWithErrors - same as NewQuotesFromTiingoSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromTiingoSymsWithErrors(symbols []string, startDate, endDate string, token string) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromTiingo(symbol, startDate, endDate, token)
+	})
+}
+
+// NewQuotesFromTiingoSymsContext - same as NewQuotesFromTiingoSyms, but stops
+// starting new symbol downloads once ctx is done and returns the quotes
+// collected so far with an error wrapping ctx.Err()
+func NewQuotesFromTiingoSymsContext(ctx context.Context, symbols []string, startDate, endDate string, token string) (Quotes, error) {
+	quotes, _, err := downloadSymsContext(ctx, symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromTiingo(symbol, startDate, endDate, token)
+	})
+	return quotes, err
+}
+
+// NewQuotesFromTiingoSymsWithDeadline - same as NewQuotesFromTiingoSyms, but
+// stops starting new symbol downloads once deadline passes and returns the
+// quotes collected so far with an error wrapping context.DeadlineExceeded
+func NewQuotesFromTiingoSymsWithDeadline(symbols []string, startDate, endDate string, token string, deadline time.Time) (Quotes, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	return NewQuotesFromTiingoSymsContext(ctx, symbols, startDate, endDate, token)
+}
+
+// NewQuotesFromTiingoPoolSyms - create a list of prices from symbols in string array,
+// rotating through the pool's tokens when one hits its rate limit
+func NewQuotesFromTiingoPoolSyms(symbols []string, startDate, endDate string, pool *TokenPool) (Quotes, error) {
+	quotes, _, err := NewQuotesFromTiingoPoolSymsWithErrors(symbols, startDate, endDate, pool)
+	return quotes, err
+}
+
+// NewQuotesFromTiingoPoolSymsWithErrors - same as NewQuotesFromTiingoPoolSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromTiingoPoolSymsWithErrors(symbols []string, startDate, endDate string, pool *TokenPool) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromTiingoPool(symbol, startDate, endDate, pool)
+	})
+}
+
+// NewQuotesFromTiingoCryptoBatch - create a list of prices from symbols in string array
+// using a single tiingo request for the whole list
+func NewQuotesFromTiingoCryptoBatch(symbols []string, startDate, endDate string, period Period, token string) (Quotes, error) {
+	quotes, _, err := NewQuotesFromTiingoCryptoBatchWithErrors(symbols, startDate, endDate, period, token)
+	return quotes, err
+}
+
+// NewQuotesFromTiingoCryptoBatchWithErrors - same as NewQuotesFromTiingoCryptoBatch, also
+// returning the error of each symbol that failed, every symbol when the request itself failed
+func NewQuotesFromTiingoCryptoBatchWithErrors(symbols []string, startDate, endDate string, period Period, token string) (Quotes, map[string]error, error) {
+
+	errs := map[string]error{}
+	if err := checkPeriod("tiingo-crypto", period); err != nil {
+		Log.Println(err)
+		for _, symbol := range symbols {
+			errs[symbol] = err
+		}
+		return Quotes{}, errs, err
+	}
+
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
+
+	tickers := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		tickers[i] = NormalizeSymbol("tiingo-crypto", symbol)
+	}
+
+	began := time.Now()
+	quotes := Quotes{}
+	found := map[string]int{} // index in quotes
+	for i, chunk := range tiingoChunks(from, to) {
+		if i > 0 {
+			SleepDelay()
+		}
+		crypto, contents, err := tiingoCryptoFetch(strings.Join(tickers, ","), chunk[0], chunk[1], tiingoResampleFreq(period), token)
+		if err != nil {
+			for _, symbol := range symbols {
+				errs[symbol] = err
+			}
+			return Quotes{}, errs, err
+		}
+		for _, data := range crypto {
+			quote := tiingoCryptoQuote(strings.ToLower(data.Ticker), data)
+			if KeepRaw {
+				quote.Raw = contents
+			}
+			if at, ok := found[quote.Symbol]; ok {
+				quotes[at] = tiingoJoin(quotes[at], quote)
+				continue
+			}
+			found[quote.Symbol] = len(quotes)
+			quotes = append(quotes, quote)
+		}
+	}
+	for i := range quotes {
+		quotes[i] = limitBars(quotes[i].Normalize(), Limit)
+		logBars(quotes[i].Symbol, len(quotes[i].Close), began)
+	}
+
+	// report any tickers tiingo didn't return
+	failed := 0
+	for i, ticker := range tickers {
+		if _, ok := found[ticker]; !ok {
+			failed++
+			errs[symbols[i]] = fmt.Errorf("%w: tiingo returned no data for %s", ErrSymbolNotFound, ticker)
+			Log.Println("error downloading " + ticker)
+		}
+	}
+	return quotes, errs, batchError(failed, len(tickers))
+}
+
+// NewQuotesFromTiingoCryptoSyms - create a list of prices from symbols in string array
+func NewQuotesFromTiingoCryptoSyms(symbols []string, startDate, endDate string, period Period, token string) (Quotes, error) {
+	quotes, _, err := NewQuotesFromTiingoCryptoSymsWithErrors(symbols, startDate, endDate, period, token)
+	return quotes, err
+}
+
+// NewQuotesFromTiingoCryptoSymsWithErrors - same as NewQuotesFromTiingoCryptoSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromTiingoCryptoSymsWithErrors(symbols []string, startDate, endDate string, period Period, token string) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromTiingoCrypto(symbol, startDate, endDate, period, token)
+	})
+}
+
+// CoinbaseBaseURL - Coinbase exchange api host, e.g. to point at the sandbox
+var CoinbaseBaseURL = "https://api.exchange.coinbase.com"
+
+// CoinbaseMaxBars - maximum number of bars requested per Coinbase page, values
+// outside 1 to 300, the most Coinbase returns, mean 300 (default=200)
+var CoinbaseMaxBars = 200
+
+// coinbasePageBars - CoinbaseMaxBars, or 300 when it is out of range
+func coinbasePageBars() int {
+	if CoinbaseMaxBars < 1 || CoinbaseMaxBars > 300 {
+		return 300
+	}
+	return CoinbaseMaxBars
+}
+
+// CoinbaseRequestsPerSecond - limit on Coinbase requests, shared by every
+// download including concurrent ones (default=5, 0 for no limit)
+var CoinbaseRequestsPerSecond = 5.0
+
+var coinbaseLimiter rateLimiter
+
+// rateLimiter - spaces requests from any number of goroutines evenly
+type rateLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait - block until the next free slot at perSecond requests a second
+func (l *rateLimiter) wait(perSecond float64) {
+	if perSecond <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	slot := l.next
+	l.next = l.next.Add(time.Duration(float64(time.Second) / perSecond))
+	l.mu.Unlock()
+	time.Sleep(time.Until(slot))
+}
+
+// coinbaseGranularities - candle sizes in seconds the Coinbase exchange api has
+var coinbaseGranularities = map[Period]int{
+	Min1:  60,
+	Min5:  5 * 60,
+	Min15: 15 * 60,
+	Min60: 60 * 60,
+	Hour6: 6 * 60 * 60,
+	Daily: 24 * 60 * 60,
+}
+
+// coinbaseResampled - coinbase periods without native candles and the finer
+// native period they are resampled from
+var coinbaseResampled = map[Period]Period{
+	Min30:   Min15,
+	Hour2:   Min60,
+	Hour4:   Min60,
+	Hour8:   Min60,
+	Hour12:  Hour6,
+	Weekly:  Daily,
+	Monthly: Daily,
+}
+
+// NewQuoteFromCoinbase - Coinbase Pro historical prices for a symbol. The api
+// only has 1m, 5m, 15m, 1h, 6h and daily candles, the other supported periods
+// are resampled from finer ones
+func NewQuoteFromCoinbase(symbol, startDate, endDate string, period Period) (Quote, error) {
+
+	symbol = NormalizeSymbol("coinbase", symbol)
+
+	if err := checkPeriod("coinbase", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	if base, ok := coinbaseResampled[period]; ok {
+		// enough finer bars for Limit resampled ones
+		limit := 0
+		if Limit > 0 {
+			limit = (Limit + 1) * int(periodDuration(period)/periodDuration(base)+1)
+		}
+		q, err := coinbaseCandles(symbol, startDate, endDate, base, limit)
+		if err != nil {
+			return q, err
+		}
+		q, err = q.Resample(period)
+		return limitBars(q, Limit), err
+	}
+	return coinbaseCandles(symbol, startDate, endDate, period, Limit)
+}
+
+// coinbaseCandles - coinbase candles for a native granularity, the last limit
+// of them unless limit is 0
+func coinbaseCandles(symbol, startDate, endDate string, period Period, limit int) (Quote, error) {
+
+	start := ParseDateString(startDate) //.In(time.Now().Location())
+	end := ParseDateString(endDate)     //.In(time.Now().Location())
+
+	granularity := coinbaseGranularities[period] // seconds
+
+	var step = time.Second * time.Duration(granularity)
+
+	return pagedBars(symbol, start, end, step, coinbasePageBars(), limit, func(startBar, endBar time.Time) (Quote, []byte, error) {
+
+		url := fmt.Sprintf(
+			"%s/products/%s/candles?start=%s&end=%s&granularity=%d",
+			CoinbaseBaseURL,
+			symbol,
+			url.QueryEscape(startBar.Format(time.RFC3339)),
+			url.QueryEscape(endBar.Format(time.RFC3339)),
+			granularity)
+
+		coinbaseLimiter.wait(CoinbaseRequestsPerSecond)
+		client := newClient()
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := client.Do(req)
+
+		if err != nil {
+			Log.Printf("coinbase error: %v\n", err)
+			return NewQuote("", 0), nil, err
+		}
+		defer resp.Body.Close()
+
+		contents, _ := io.ReadAll(resp.Body)
+		saveRaw("coinbase", symbol, contents)
+		if resp.StatusCode != http.StatusOK {
+			err = statusError("coinbase", symbol, resp)
+			Log.Printf("coinbase error: %v\n", err)
+			return NewQuote("", 0), nil, err
+		}
+
+		type cb [6]float64
+		var bars []cb
+		err = json.Unmarshal(contents, &bars)
+		if err != nil {
+			Log.Printf("coinbase error: %v\n", err)
+		}
+
+		numrows := len(bars)
+		q := NewQuote(symbol, numrows)
+
+		//Log.Printf("numrows=%d, bars=%v\n", numrows, bars)
+
+		for row := 0; row < numrows; row++ {
+			bar := numrows - 1 - row // reverse the order
+			q.Date[bar] = unixTime(int64(bars[row][0]))
+			q.Low[bar] = bars[row][1]
+			q.High[bar] = bars[row][2]
+			q.Open[bar] = bars[row][3]
+			q.Close[bar] = bars[row][4]
+			q.Volume[bar] = bars[row][5]
+		}
+		return q, contents, nil
+	})
+}
+
+// pagedBars - download [start, end] in pages of at most maxBars bars,
+// fetch returns one page of bars in ascending order and its raw response.
+// fetch paces its own requests, coinbase with its rate limiter and the other
+// sources with SleepDelay
+func pagedBars(symbol string, start, end time.Time, step time.Duration, maxBars, limit int, fetch func(startBar, endBar time.Time) (Quote, []byte, error)) (Quote, error) {
+
+	began := time.Now()
+	if maxBars < 1 {
+		return NewQuote("", 0), fmt.Errorf("%s: pages of %d bars, must be at least 1", symbol, maxBars)
+	}
+
+	// don't request pages before the last limit bars, with a bar to spare
+	from := start
+	span := time.Duration(limit+1) * step
+	if limit > 0 && end.Add(-span).After(start) {
+		from = end.Add(-span)
+	}
+
+	quote, err := fetchPages(symbol, from, end, step, maxBars, fetch)
+	if err != nil {
+		return NewQuote("", 0), err
+	}
+
+	// weekends, nights and halts leave fewer bars than the span suggests,
+	// keep paging backwards over twice the span until there are limit bars
+	for limit > 0 && len(quote.Close) < limit && from.After(start) {
+		to := from.Add(-step)
+		span *= 2
+		from = to.Add(-span)
+		if from.Before(start) {
+			from = start
+		}
+		earlier, err := fetchPages(symbol, from, to, step, maxBars, fetch)
+		if err != nil {
+			return NewQuote("", 0), err
+		}
+		raw := append(earlier.Raw, quote.Raw...)
+		quote = appendBars(earlier, quote)
+		quote.Raw = raw
+	}
+
+	quote = limitBars(quote.Normalize(), limit)
+	logBars(symbol, len(quote.Close), began)
+	return quote, nil
+}
+
+// appendBars - the bars of q followed by the bars of more, q's symbol and raw response
+func appendBars(q, more Quote) Quote {
+	q.Date = append(q.Date, more.Date...)
+	q.Low = append(q.Low, more.Low...)
+	q.High = append(q.High, more.High...)
+	q.Open = append(q.Open, more.Open...)
+	q.Close = append(q.Close, more.Close...)
+	q.Volume = append(q.Volume, more.Volume...)
+	return q
+}
+
+// fetchPages - the bars in [start, end], one fetch per maxBars bars
+func fetchPages(symbol string, start, end time.Time, step time.Duration, maxBars int, fetch func(startBar, endBar time.Time) (Quote, []byte, error)) (Quote, error) {
+
+	var quote Quote
+	quote.Symbol = symbol
+
+	startBar := start
+	endBar := startBar.Add(time.Duration(maxBars) * step)
+
+	if endBar.After(end) {
+		endBar = end
+	}
+
+	//Log.Printf("startBar=%v, endBar=%v\n", startBar, endBar)
+
+	for startBar.Before(end) {
+
+		q, contents, err := fetch(startBar, endBar)
+		if err != nil {
+			return NewQuote("", 0), err
+		}
+
+		quote = appendBars(quote, q)
+		if KeepRaw {
+			// one json document per page, newline separated
+			quote.Raw = append(append(quote.Raw, contents...), '\n')
+		}
+
+		startBar = endBar.Add(step)
+		endBar = startBar.Add(time.Duration(maxBars) * step)
+
+	}
+	return quote, nil
+}
+
+// NewQuoteFromCoinbaseAdvanced - Coinbase Advanced Trade historical prices for a symbol
+func NewQuoteFromCoinbaseAdvanced(symbol, startDate, endDate string, period Period) (Quote, error) {
+
+	symbol = NormalizeSymbol("coinbase-advanced", symbol)
+
+	if err := checkPeriod("coinbase-advanced", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	start := ParseDateString(startDate)
+	end := ParseDateString(endDate)
+
+	var granularity string
+	switch period {
+	case Min1:
+		granularity = "ONE_MINUTE"
+	case Min5:
+		granularity = "FIVE_MINUTE"
+	case Min15:
+		granularity = "FIFTEEN_MINUTE"
+	case Min30:
+		granularity = "THIRTY_MINUTE"
+	case Min60:
+		granularity = "ONE_HOUR"
+	case Hour2:
+		granularity = "TWO_HOUR"
+	case Hour4:
+		granularity = "FOUR_HOUR"
+	case Hour6:
+		granularity = "SIX_HOUR"
+	default:
+		granularity = "ONE_DAY"
+	}
+
+	type candle struct {
+		Start  string `json:"start"`
+		Low    string `json:"low"`
+		High   string `json:"high"`
+		Open   string `json:"open"`
+		Close  string `json:"close"`
+		Volume string `json:"volume"`
+	}
+
+	type candles struct {
+		Candles []candle `json:"candles"`
+	}
+
+	maxBars := 300
+
+	return pagedBars(symbol, start, end, periodDuration(period), maxBars, Limit, func(startBar, endBar time.Time) (Quote, []byte, error) {
+
+		url := fmt.Sprintf(
+			"https://api.coinbase.com/api/v3/brokerage/market/products/%s/candles?start=%d&end=%d&granularity=%s",
+			symbol,
+			startBar.Unix(),
+			endBar.Unix(),
+			granularity)
+
+		coinbaseLimiter.wait(CoinbaseRequestsPerSecond)
+		client := newClient()
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := client.Do(req)
+
+		if err != nil {
+			Log.Printf("coinbase error: %v\n", err)
+			return NewQuote("", 0), nil, err
+		}
+		defer resp.Body.Close()
+
+		contents, _ := io.ReadAll(resp.Body)
+		saveRaw("coinbase-advanced", symbol, contents)
+		if resp.StatusCode != http.StatusOK {
+			err = statusError("coinbase-advanced", symbol, resp)
+			Log.Printf("coinbase error: %v\n", err)
+			return NewQuote("", 0), nil, err
+		}
+
+		var cb candles
+		err = json.Unmarshal(contents, &cb)
+		if err != nil {
+			Log.Printf("coinbase error: %v\n", err)
+		}
+
+		numrows := len(cb.Candles)
+		q := NewQuote(symbol, numrows)
+
+		for row := 0; row < numrows; row++ {
+			bar := numrows - 1 - row // reverse the order
+			start, _ := strconv.ParseInt(cb.Candles[row].Start, 10, 64)
+			q.Date[bar] = unixTime(start)
+			q.Low[bar], _ = strconv.ParseFloat(cb.Candles[row].Low, 64)
+			q.High[bar], _ = strconv.ParseFloat(cb.Candles[row].High, 64)
+			q.Open[bar], _ = strconv.ParseFloat(cb.Candles[row].Open, 64)
+			q.Close[bar], _ = strconv.ParseFloat(cb.Candles[row].Close, 64)
+			q.Volume[bar], _ = strconv.ParseFloat(cb.Candles[row].Volume, 64)
+		}
+		return q, contents, nil
+	})
+}
+
+// NewQuotesFromCoinbaseAdvancedSyms - create a list of prices from symbols in string array
+func NewQuotesFromCoinbaseAdvancedSyms(symbols []string, startDate, endDate string, period Period) (Quotes, error) {
+	quotes, _, err := NewQuotesFromCoinbaseAdvancedSymsWithErrors(symbols, startDate, endDate, period)
+	return quotes, err
+}
+
+// NewQuotesFromCoinbaseAdvancedSymsWithErrors - same as NewQuotesFromCoinbaseAdvancedSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromCoinbaseAdvancedSymsWithErrors(symbols []string, startDate, endDate string, period Period) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromCoinbaseAdvanced(symbol, startDate, endDate, period)
+	})
+}
+
+// NewQuotesFromCoinbase - create a list of prices from symbols in file
+func NewQuotesFromCoinbase(filename, startDate, endDate string, period Period) (Quotes, error) {
+
+	quotes := Quotes{}
+	inFile, err := os.Open(filename)
+	if err != nil {
+		return quotes, err
+	}
+	defer inFile.Close()
 	scanner := bufio.NewScanner(inFile)
 	scanner.Split(bufio.ScanLines)
 
-	for scanner.Scan() {
-		sym := scanner.Text()
-		quote, err := NewQuoteFromYahoo(sym, startDate, endDate, period, adjustQuote)
-		if err == nil {
-			quotes = append(quotes, quote)
+	failed, total := 0, 0
+	for scanner.Scan() {
+		sym := scanner.Text()
+		total++
+		quote, err := NewQuoteFromCoinbase(sym, startDate, endDate, period)
+		if err == nil {
+			quotes = append(quotes, quote)
+		} else {
+			failed++
+			Log.Println("error downloading " + sym)
+		}
+		SleepDelay()
+	}
+	return quotes, batchError(failed, total)
+}
+
+// NewQuotesFromCoinbaseSyms - create a list of prices from symbols in string array
+func NewQuotesFromCoinbaseSyms(symbols []string, startDate, endDate string, period Period) (Quotes, error) {
+	quotes, _, err := NewQuotesFromCoinbaseSymsWithErrors(symbols, startDate, endDate, period)
+	return quotes, err
+}
+
+// NewQuotesFromCoinbaseSymsWithErrors - same as NewQuotesFromCoinbaseSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromCoinbaseSymsWithErrors(symbols []string, startDate, endDate string, period Period) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromCoinbase(symbol, startDate, endDate, period)
+	})
+}
+
+// NewQuotesFromCoinbaseConcurrent - create a list of prices from symbols in file,
+// downloading up to workers symbols at once, see NewQuotesFromCoinbaseSymsConcurrent
+func NewQuotesFromCoinbaseConcurrent(filename, startDate, endDate string, period Period, workers int) (Quotes, error) {
+	symbols, err := NewSymbolsFromFile(filename)
+	if err != nil {
+		return Quotes{}, err
+	}
+	return NewQuotesFromCoinbaseSymsConcurrent(symbols, startDate, endDate, period, workers)
+}
+
+// NewQuotesFromCoinbaseSymsConcurrent - create a list of prices from symbols in string
+// array, downloading up to workers symbols at once. Each symbol still pages through
+// its range in turn, all requests share the CoinbaseRequestsPerSecond limit, and
+// the quotes keep the order of symbols
+func NewQuotesFromCoinbaseSymsConcurrent(symbols []string, startDate, endDate string, period Period, workers int) (Quotes, error) {
+	quotes, _, err := NewQuotesFromCoinbaseSymsConcurrentWithErrors(symbols, startDate, endDate, period, workers)
+	return quotes, err
+}
+
+// NewQuotesFromCoinbaseSymsConcurrentWithErrors - same as NewQuotesFromCoinbaseSymsConcurrent,
+// also returning the download error of each symbol that failed so just those can be retried
+func NewQuotesFromCoinbaseSymsConcurrentWithErrors(symbols []string, startDate, endDate string, period Period, workers int) (Quotes, map[string]error, error) {
+	return downloadSymsConcurrent(symbols, workers, func(symbol string) (Quote, error) {
+		return NewQuoteFromCoinbase(symbol, startDate, endDate, period)
+	})
+}
+
+// downloadSymsConcurrent - downloadSyms with up to workers fetches running at
+// once and no delay between them, quotes in the order of symbols
+func downloadSymsConcurrent(symbols []string, workers int, fetch func(symbol string) (Quote, error)) (Quotes, map[string]error, error) {
+
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]Quote, len(symbols))
+	errs := make([]error, len(symbols))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = fetchRetry(symbols[i], fetch)
+			}
+		}()
+	}
+	for i := range symbols {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	quotes := Quotes{}
+	failed := map[string]error{}
+	for i, symbol := range symbols {
+		if errs[i] != nil {
+			failed[symbol] = errs[i]
+			Log.Println("error downloading " + symbol)
+			continue
+		}
+		quotes = append(quotes, results[i])
+	}
+	return quotes, failed, batchError(len(symbols)-len(quotes), len(symbols))
+}
+
+// NewQuoteFromDeribit - Deribit historical prices for a futures/options instrument
+func NewQuoteFromDeribit(symbol, startDate, endDate string, period Period) (Quote, error) {
+
+	began := time.Now()
+	symbol = NormalizeSymbol("deribit", symbol)
+
+	if err := checkPeriod("deribit", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	start := ParseDateString(startDate)
+	end := ParseDateString(endDate)
+
+	var resolution string
+	switch period {
+	case Min1:
+		resolution = "1"
+	case Min3:
+		resolution = "3"
+	case Min5:
+		resolution = "5"
+	case Min15:
+		resolution = "15"
+	case Min30:
+		resolution = "30"
+	case Min60:
+		resolution = "60"
+	case Hour2:
+		resolution = "120"
+	case Hour6:
+		resolution = "360"
+	case Hour12:
+		resolution = "720"
+	default:
+		resolution = "1D"
+	}
+
+	type deribitResult struct {
+		Status string    `json:"status"`
+		Ticks  []int64   `json:"ticks"`
+		Open   []float64 `json:"open"`
+		High   []float64 `json:"high"`
+		Low    []float64 `json:"low"`
+		Close  []float64 `json:"close"`
+		Volume []float64 `json:"volume"`
+	}
+
+	type deribitResponse struct {
+		Result deribitResult `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+			Data    struct {
+				Param string `json:"param"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+
+	quote := NewQuote(symbol, 0)
+
+	maxBars := 5000
+	step := periodDuration(period)
+
+	startBar := start
+	for startBar.Before(end) {
+
+		endBar := startBar.Add(time.Duration(maxBars) * step)
+		if endBar.After(end) {
+			endBar = end
+		}
+
+		url := fmt.Sprintf(
+			"https://www.deribit.com/api/v2/public/get_tradingview_chart_data?instrument_name=%s&start_timestamp=%d&end_timestamp=%d&resolution=%s",
+			symbol,
+			startBar.UnixNano()/1000000,
+			endBar.UnixNano()/1000000,
+			resolution)
+
+		client := newClient()
+		resp, err := client.Get(url)
+		if err != nil {
+			Log.Printf("deribit error: %v\n", err)
+			return NewQuote("", 0), err
+		}
+		contents, _ := io.ReadAll(resp.Body)
+		saveRaw("deribit", symbol, contents)
+		resp.Body.Close()
+
+		var deribit deribitResponse
+		err = json.Unmarshal(contents, &deribit)
+		if err != nil {
+			Log.Printf("deribit error: %v\n", err)
+			return NewQuote("", 0), err
+		}
+		if deribit.Error != nil {
+			Log.Printf("deribit error: %s\n", deribit.Error.Message)
+			if deribit.Error.Data.Param == "instrument_name" || strings.Contains(deribit.Error.Message, "not_found") {
+				return NewQuote("", 0), fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+			}
+			return NewQuote("", 0), fmt.Errorf("deribit error: %s", deribit.Error.Message)
+		}
+
+		result := deribit.Result
+		for bar := range result.Ticks {
+			date := time.Unix(0, result.Ticks[bar]*int64(time.Millisecond)).In(Location)
+			// pages share their boundary bar
+			if len(quote.Date) > 0 && !date.After(quote.Date[len(quote.Date)-1]) {
+				continue
+			}
+			quote.Date = append(quote.Date, date)
+			quote.Open = append(quote.Open, result.Open[bar])
+			quote.High = append(quote.High, result.High[bar])
+			quote.Low = append(quote.Low, result.Low[bar])
+			quote.Close = append(quote.Close, result.Close[bar])
+			quote.Volume = append(quote.Volume, result.Volume[bar])
+		}
+		if KeepRaw {
+			quote.Raw = append(append(quote.Raw, contents...), '\n')
+		}
+
+		startBar = endBar
+		SleepDelay()
+	}
+
+	quote = limitBars(quote.Normalize(), Limit)
+	logBars(symbol, len(quote.Close), began)
+	return quote, nil
+}
+
+// NewQuotesFromDeribitSyms - create a list of prices from symbols in string array
+func NewQuotesFromDeribitSyms(symbols []string, startDate, endDate string, period Period) (Quotes, error) {
+	quotes, _, err := NewQuotesFromDeribitSymsWithErrors(symbols, startDate, endDate, period)
+	return quotes, err
+}
+
+// NewQuotesFromDeribitSymsWithErrors - same as NewQuotesFromDeribitSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromDeribitSymsWithErrors(symbols []string, startDate, endDate string, period Period) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromDeribit(symbol, startDate, endDate, period)
+	})
+}
+
+// GateIOMaxBars - number of candles requested per gate.io page
+var GateIOMaxBars = 1000
+
+// NewQuoteFromGateIO - Gate.io spot historical prices for a currency pair (BTC_USDT)
+func NewQuoteFromGateIO(symbol string, from, to time.Time, period Period) (Quote, error) {
+
+	symbol = NormalizeSymbol("gateio", symbol)
+
+	if err := checkPeriod("gateio", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	var interval string
+	switch period {
+	case Min1:
+		interval = "1m"
+	case Min5:
+		interval = "5m"
+	case Min15:
+		interval = "15m"
+	case Min30:
+		interval = "30m"
+	case Min60:
+		interval = "1h"
+	case Hour4:
+		interval = "4h"
+	case Hour8:
+		interval = "8h"
+	case Weekly:
+		interval = "7d"
+	case Monthly:
+		interval = "30d"
+	default:
+		interval = "1d"
+	}
+
+	return pagedBars(symbol, from, to, periodDuration(period), GateIOMaxBars-1, Limit, func(startBar, endBar time.Time) (Quote, []byte, error) {
+
+		SleepDelay()
+		url := fmt.Sprintf(
+			"https://api.gateio.ws/api/v4/spot/candlesticks?currency_pair=%s&interval=%s&from=%d&to=%d",
+			symbol,
+			interval,
+			startBar.Unix(),
+			endBar.Unix())
+
+		client := newClient()
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+
+		if err != nil {
+			Log.Printf("gateio error: %v\n", err)
+			return NewQuote("", 0), nil, err
+		}
+		defer resp.Body.Close()
+
+		contents, _ := io.ReadAll(resp.Body)
+		saveRaw("gateio", symbol, contents)
+		q, err := parseGateIOCandles(symbol, contents)
+		if err != nil {
+			Log.Printf("gateio error: %v\n", err)
+			return NewQuote("", 0), nil, err
+		}
+		return q, contents, nil
+	})
+}
+
+// parseGateIOCandles - gate.io candles are arrays of strings in ascending order,
+// [timestamp, quote volume, close, high, low, open, base volume, closed].
+// Volume is the base volume, the same unit as every other source
+func parseGateIOCandles(symbol string, contents []byte) (Quote, error) {
+
+	var candles [][]string
+	if err := json.Unmarshal(contents, &candles); err != nil {
+		var gerr struct {
+			Label   string `json:"label"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(contents, &gerr) == nil && gerr.Label != "" {
+			if gerr.Label == "INVALID_CURRENCY_PAIR" {
+				return NewQuote("", 0), fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+			}
+			return NewQuote("", 0), fmt.Errorf("%s: %s", gerr.Label, gerr.Message)
+		}
+		return NewQuote("", 0), err
+	}
+
+	q := NewQuote(symbol, len(candles))
+	for bar, candle := range candles {
+		if len(candle) < 7 {
+			return NewQuote("", 0), fmt.Errorf("gateio candle %d has %d fields", bar, len(candle))
+		}
+		ts, _ := strconv.ParseInt(candle[0], 10, 64)
+		q.Date[bar] = unixTime(ts)
+		q.Volume[bar], _ = strconv.ParseFloat(candle[6], 64)
+		q.Close[bar], _ = strconv.ParseFloat(candle[2], 64)
+		q.High[bar], _ = strconv.ParseFloat(candle[3], 64)
+		q.Low[bar], _ = strconv.ParseFloat(candle[4], 64)
+		q.Open[bar], _ = strconv.ParseFloat(candle[5], 64)
+	}
+	return q, nil
+}
+
+// NewQuotesFromGateIOSyms - create a list of prices from symbols in string array
+func NewQuotesFromGateIOSyms(symbols []string, from, to time.Time, period Period) (Quotes, error) {
+	quotes, _, err := NewQuotesFromGateIOSymsWithErrors(symbols, from, to, period)
+	return quotes, err
+}
+
+// NewQuotesFromGateIOSymsWithErrors - same as NewQuotesFromGateIOSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromGateIOSymsWithErrors(symbols []string, from, to time.Time, period Period) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromGateIO(symbol, from, to, period)
+	})
+}
+
+// BybitMaxBars - number of candles requested per bybit page
+var BybitMaxBars = 1000
+
+// NewQuoteFromBybit - Bybit spot historical prices for a symbol (BTCUSDT)
+func NewQuoteFromBybit(symbol string, from, to time.Time, period Period) (Quote, error) {
+
+	symbol = NormalizeSymbol("bybit", symbol)
+
+	if err := checkPeriod("bybit", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	var interval string
+	switch period {
+	case Min1:
+		interval = "1"
+	case Min3:
+		interval = "3"
+	case Min5:
+		interval = "5"
+	case Min15:
+		interval = "15"
+	case Min30:
+		interval = "30"
+	case Min60:
+		interval = "60"
+	case Hour2:
+		interval = "120"
+	case Hour4:
+		interval = "240"
+	case Hour6:
+		interval = "360"
+	case Hour12:
+		interval = "720"
+	case Weekly:
+		interval = "W"
+	case Monthly:
+		interval = "M"
+	default:
+		interval = "D"
+	}
+
+	return pagedBars(symbol, from, to, periodDuration(period), BybitMaxBars-1, Limit, func(startBar, endBar time.Time) (Quote, []byte, error) {
+
+		SleepDelay()
+		url := fmt.Sprintf(
+			"https://api.bybit.com/v5/market/kline?category=spot&symbol=%s&interval=%s&start=%d&end=%d&limit=%d",
+			symbol,
+			interval,
+			startBar.UnixMilli(),
+			endBar.UnixMilli(),
+			BybitMaxBars)
+
+		client := newClient()
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := client.Do(req)
+
+		if err != nil {
+			Log.Printf("bybit error: %v\n", err)
+			return NewQuote("", 0), nil, err
+		}
+		defer resp.Body.Close()
+
+		contents, _ := io.ReadAll(resp.Body)
+		saveRaw("bybit", symbol, contents)
+		q, err := parseBybitKlines(symbol, contents)
+		if err != nil {
+			Log.Printf("bybit error: %v\n", err)
+			return NewQuote("", 0), nil, err
 		}
-		time.Sleep(Delay * time.Millisecond)
-	}
-	return quotes, nil
+		return q, contents, nil
+	})
 }
 
-// NewQuotesFromYahooSyms - create a list of prices from symbols in string array
-func NewQuotesFromYahooSyms(symbols []string, startDate, endDate string, period Period, adjustQuote bool) (Quotes, error) {
+// parseBybitKlines - bybit klines are newest first arrays of strings,
+// [start ms, open, high, low, close, volume, turnover]
+func parseBybitKlines(symbol string, contents []byte) (Quote, error) {
 
-	quotes := Quotes{}
-	for _, symbol := range symbols {
-		quote, err := NewQuoteFromYahoo(symbol, startDate, endDate, period, adjustQuote)
-		if err == nil {
-			quotes = append(quotes, quote)
+	var bybit struct {
+		RetCode int    `json:"retCode"`
+		RetMsg  string `json:"retMsg"`
+		Result  struct {
+			List [][]string `json:"list"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(contents, &bybit); err != nil {
+		return NewQuote("", 0), err
+	}
+	if bybit.RetCode != 0 {
+		// 10001 is any bad parameter, "Not supported symbols" for an unknown one
+		if bybit.RetCode == 10001 && strings.Contains(strings.ToLower(bybit.RetMsg), "symbol") {
+			return NewQuote("", 0), fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
 		}
-		time.Sleep(Delay * time.Millisecond)
+		return NewQuote("", 0), fmt.Errorf("bybit error: %s", bybit.RetMsg)
 	}
-	return quotes, nil
+
+	numrows := len(bybit.Result.List)
+	q := NewQuote(symbol, numrows)
+	for row, kline := range bybit.Result.List {
+		if len(kline) < 6 {
+			return NewQuote("", 0), fmt.Errorf("bybit kline %d has %d fields", row, len(kline))
+		}
+		bar := numrows - 1 - row // reverse the order
+		ms, _ := strconv.ParseInt(kline[0], 10, 64)
+		q.Date[bar] = time.UnixMilli(ms).In(Location)
+		q.Open[bar], _ = strconv.ParseFloat(kline[1], 64)
+		q.High[bar], _ = strconv.ParseFloat(kline[2], 64)
+		q.Low[bar], _ = strconv.ParseFloat(kline[3], 64)
+		q.Close[bar], _ = strconv.ParseFloat(kline[4], 64)
+		q.Volume[bar], _ = strconv.ParseFloat(kline[5], 64)
+	}
+	return q, nil
 }
 
-func tiingoDaily(symbol string, from, to time.Time, token string) (Quote, error) {
+// NewQuotesFromBybitSyms - create a list of prices from symbols in string array
+func NewQuotesFromBybitSyms(symbols []string, from, to time.Time, period Period) (Quotes, error) {
+	quotes, _, err := NewQuotesFromBybitSymsWithErrors(symbols, from, to, period)
+	return quotes, err
+}
 
-	type tquote struct {
-		AdjClose    float64 `json:"adjClose"`
-		AdjHigh     float64 `json:"adjHigh"`
-		AdjLow      float64 `json:"adjLow"`
-		AdjOpen     float64 `json:"adjOpen"`
-		AdjVolume   float64 `json:"adjVolume"`
-		Close       float64 `json:"close"`
-		Date        string  `json:"date"`
-		DivCash     float64 `json:"divCash"`
-		High        float64 `json:"high"`
-		Low         float64 `json:"low"`
-		Open        float64 `json:"open"`
-		SplitFactor float64 `json:"splitFactor"`
-		Volume      float64 `json:"volume"`
-	}
+// NewQuotesFromBybitSymsWithErrors - same as NewQuotesFromBybitSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromBybitSymsWithErrors(symbols []string, from, to time.Time, period Period) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromBybit(symbol, from, to, period)
+	})
+}
 
-	var tiingo []tquote
+// MEXCBaseURL - MEXC spot api host
+var MEXCBaseURL = "https://api.mexc.com"
 
-	url := fmt.Sprintf(
-		"https://api.tiingo.com/tiingo/daily/%s/prices?startDate=%s&endDate=%s",
-		symbol,
-		url.QueryEscape(from.Format("2006-1-2")),
-		url.QueryEscape(to.Format("2006-1-2")))
+// MEXCMaxBars - number of candles requested per mexc page
+var MEXCMaxBars = 1000
 
-	client := &http.Client{Timeout: ClientTimeout}
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
-	resp, err := client.Do(req)
+// NewQuoteFromMEXC - MEXC spot historical prices for a symbol (BTCUSDT)
+func NewQuoteFromMEXC(symbol string, from, to time.Time, period Period) (Quote, error) {
 
-	if err != nil {
-		Log.Printf("tiingo error: %v\n", err)
+	symbol = NormalizeSymbol("mexc", symbol)
+
+	if err := checkPeriod("mexc", period); err != nil {
+		Log.Println(err)
 		return NewQuote("", 0), err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
+	var interval string
+	switch period {
+	case Min1:
+		interval = "1m"
+	case Min5:
+		interval = "5m"
+	case Min15:
+		interval = "15m"
+	case Min30:
+		interval = "30m"
+	case Min60:
+		interval = "60m"
+	case Hour4:
+		interval = "4h"
+	case Weekly:
+		interval = "1W"
+	case Monthly:
+		interval = "1M"
+	default:
+		interval = "1d"
+	}
+
+	return pagedBars(symbol, from, to, periodDuration(period), MEXCMaxBars-1, Limit, func(startBar, endBar time.Time) (Quote, []byte, error) {
+
+		SleepDelay()
+		url := fmt.Sprintf(
+			"%s/api/v3/klines?symbol=%s&interval=%s&startTime=%d&endTime=%d&limit=%d",
+			MEXCBaseURL,
+			symbol,
+			interval,
+			startBar.UnixMilli(),
+			endBar.UnixMilli(),
+			MEXCMaxBars)
+
+		client := newClient()
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := client.Do(req)
+
+		if err != nil {
+			Log.Printf("mexc error: %v\n", err)
+			return NewQuote("", 0), nil, err
+		}
+		defer resp.Body.Close()
+
 		contents, _ := io.ReadAll(resp.Body)
-		err = json.Unmarshal(contents, &tiingo)
+		saveRaw("mexc", symbol, contents)
+		q, err := parseBinanceStyleKlines(contents)
 		if err != nil {
-			Log.Printf("tiingo error: %v\n", err)
-			return NewQuote("", 0), err
+			Log.Printf("mexc error: %v\n", err)
+			if strings.Contains(err.Error(), "Invalid symbol") {
+				err = fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+			}
+			return NewQuote("", 0), nil, err
+		}
+		q.Symbol = symbol
+		return q, contents, nil
+	})
+}
+
+// parseBinanceStyleKlines - klines in Binance's layout, shared by exchanges
+// that copied its api (MEXC): oldest first arrays of [open time ms, open,
+// high, low, close, volume, ...], prices as strings or numbers. An error
+// object ({"code":-1121,"msg":"Invalid symbol."}) is returned as an error
+func parseBinanceStyleKlines(raw []byte) (Quote, error) {
+
+	var klines [][]interface{}
+	if err := json.Unmarshal(raw, &klines); err != nil {
+		var apiErr struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if json.Unmarshal(raw, &apiErr) == nil && apiErr.Msg != "" {
+			return NewQuote("", 0), fmt.Errorf("kline error %d: %s", apiErr.Code, apiErr.Msg)
 		}
-	} else if resp.StatusCode == http.StatusNotFound {
-		Log.Printf("symbol '%s' not found\n", symbol)
 		return NewQuote("", 0), err
 	}
 
-	numrows := len(tiingo)
-	quote := NewQuote(symbol, numrows)
+	q := NewQuote("", len(klines))
+	for bar, kline := range klines {
+		if len(kline) < 6 {
+			return NewQuote("", 0), fmt.Errorf("kline %d has %d fields", bar, len(kline))
+		}
+		var values [6]float64
+		for i := range values {
+			switch v := kline[i].(type) {
+			case float64:
+				values[i] = v
+			case string:
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return NewQuote("", 0), fmt.Errorf("kline %d field %d: %v", bar, i, err)
+				}
+				values[i] = f
+			default:
+				return NewQuote("", 0), fmt.Errorf("kline %d field %d is not a number", bar, i)
+			}
+		}
+		q.Date[bar] = time.UnixMilli(int64(values[0])).In(Location)
+		q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar], q.Volume[bar] = values[1], values[2], values[3], values[4], values[5]
+	}
+	return q, nil
+}
 
-	for bar := 0; bar < numrows; bar++ {
-		quote.Date[bar], _ = time.Parse("2006-01-02", tiingo[bar].Date[0:10])
-		quote.Open[bar] = tiingo[bar].AdjOpen
-		quote.High[bar] = tiingo[bar].AdjHigh
-		quote.Low[bar] = tiingo[bar].AdjLow
-		quote.Close[bar] = tiingo[bar].AdjClose
-		quote.Volume[bar] = float64(tiingo[bar].Volume)
+// NewQuotesFromMEXCSyms - create a list of prices from symbols in string array
+func NewQuotesFromMEXCSyms(symbols []string, from, to time.Time, period Period) (Quotes, error) {
+	quotes, _, err := NewQuotesFromMEXCSymsWithErrors(symbols, from, to, period)
+	return quotes, err
+}
+
+// NewQuotesFromMEXCSymsWithErrors - same as NewQuotesFromMEXCSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromMEXCSymsWithErrors(symbols []string, from, to time.Time, period Period) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromMEXC(symbol, from, to, period)
+	})
+}
+
+// KrakenBaseURL - Kraken api host
+var KrakenBaseURL = "https://api.kraken.com"
+
+// kraken pair keys (XXBTZUSD) by key, altname (XBTUSD) and wsname (XBT/USD),
+// loaded from AssetPairs on first use
+var (
+	krakenPairs   map[string]string
+	krakenPairsMu sync.Mutex
+)
+
+// krakenPair - the AssetPairs key of a kraken pair given as its key, altname
+// or wsname, also accepting BTC for XBT (BTC/USD, BTCUSD)
+func krakenPair(symbol string) (string, error) {
+	krakenPairsMu.Lock()
+	defer krakenPairsMu.Unlock()
+
+	if krakenPairs == nil {
+		pairs, err := getKrakenPairs()
+		if err != nil {
+			return "", err
+		}
+		krakenPairs = pairs
 	}
 
-	return quote, nil
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	for _, s := range []string{symbol, strings.Replace(symbol, "BTC", "XBT", 1)} {
+		if key, ok := krakenPairs[s]; ok {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("%w: kraken has no pair %s", ErrSymbolNotFound, symbol)
 }
 
-func tiingoCrypto(symbol string, from, to time.Time, period Period, token string) (Quote, error) {
+// getKrakenPairs - map of every form of a kraken pair name to its AssetPairs key
+func getKrakenPairs() (map[string]string, error) {
 
-	resampleFreq := "1day"
-	switch period {
-	case Min1:
-		resampleFreq = "1min"
-	case Min3:
-		resampleFreq = "3min"
-	case Min5:
-		resampleFreq = "5min"
-	case Min15:
-		resampleFreq = "15min"
-	case Min30:
-		resampleFreq = "30min"
-	case Min60:
-		resampleFreq = "1hour"
-	case Hour2:
-		resampleFreq = "2hour"
-	case Hour4:
-		resampleFreq = "4hour"
-	case Hour6:
-		resampleFreq = "6hour"
-	case Hour8:
-		resampleFreq = "8hour"
-	case Hour12:
-		resampleFreq = "12hour"
-	case Daily:
-		resampleFreq = "1day"
+	resp, err := newClient().Get(KrakenBaseURL + "/0/public/AssetPairs")
+	if err != nil {
+		Log.Printf("kraken error: %v\n", err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	type priceData struct {
-		TradesDone     float64 `json:"tradesDone"`
-		Close          float64 `json:"close"`
-		VolumeNotional float64 `json:"volumeNotional"`
-		Low            float64 `json:"low"`
-		Open           float64 `json:"open"`
-		Date           string  `json:"date"` // "2017-12-19T00:00:00Z"
-		High           float64 `json:"high"`
-		Volume         float64 `json:"volume"`
+	var kraken struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			Altname string `json:"altname"`
+			Wsname  string `json:"wsname"`
+		} `json:"result"`
+	}
+	contents, _ := io.ReadAll(resp.Body)
+	if err = json.Unmarshal(contents, &kraken); err != nil {
+		return nil, err
+	}
+	if len(kraken.Error) > 0 {
+		return nil, fmt.Errorf("kraken error: %s", strings.Join(kraken.Error, ", "))
 	}
 
-	type cryptoData struct {
-		Ticker        string      `json:"ticker"`
-		BaseCurrency  string      `json:"baseCurrency"`
-		QuoteCurrency string      `json:"quoteCurrency"`
-		PriceData     []priceData `json:"priceData"`
+	pairs := make(map[string]string, 3*len(kraken.Result))
+	for key, pair := range kraken.Result {
+		for _, name := range []string{key, pair.Altname, pair.Wsname} {
+			if name != "" {
+				pairs[strings.ToUpper(name)] = key
+			}
+		}
 	}
+	return pairs, nil
+}
 
-	var crypto []cryptoData
+// NewQuoteFromKraken - Kraken spot historical prices for a pair, given as
+// its AssetPairs key (XXBTZUSD), altname (XBTUSD) or wsname (XBT/USD).
+// Kraken only serves the most recent 720 bars of each period
+func NewQuoteFromKraken(symbol string, from, to time.Time, period Period) (Quote, error) {
 
-	url := fmt.Sprintf(
-		"https://api.tiingo.com/tiingo/crypto/prices?tickers=%s&startDate=%s&endDate=%s&resampleFreq=%s",
-		symbol,
-		url.QueryEscape(from.Format("2006-1-2")),
-		url.QueryEscape(to.Format("2006-1-2")),
-		resampleFreq)
+	began := time.Now()
 
-	client := &http.Client{Timeout: ClientTimeout}
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
-	resp, err := client.Do(req)
+	if err := checkPeriod("kraken", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
 
+	pair, err := krakenPair(symbol)
 	if err != nil {
-		Log.Printf("symbol '%s' not found\n", symbol)
+		Log.Println(err)
+		return NewQuote("", 0), err
+	}
+
+	url := fmt.Sprintf(
+		"%s/0/public/OHLC?pair=%s&interval=%d&since=%d",
+		KrakenBaseURL,
+		pair,
+		int(periodDuration(period)/time.Minute),
+		from.Unix()-1)
+
+	resp, err := newClient().Get(url)
+	if err != nil {
+		Log.Printf("kraken error: %v\n", err)
 		return NewQuote("", 0), err
 	}
 	defer resp.Body.Close()
 
 	contents, _ := io.ReadAll(resp.Body)
-	err = json.Unmarshal(contents, &crypto)
+	saveRaw("kraken", pair, contents)
+	q, err := parseKrakenOHLC(pair, contents)
 	if err != nil {
-		Log.Printf("tiingo crypto symbol '%s' error: %v\n", symbol, err)
+		Log.Printf("kraken error: %v\n", err)
 		return NewQuote("", 0), err
 	}
-	if len(crypto) < 1 {
-		Log.Printf("tiingo crypto symbol '%s' No data returned", symbol)
-		return NewQuote("", 0), err
+	q = q.filter(func(bar int) bool { return !q.Date[bar].Before(from) && !q.Date[bar].After(to) })
+	if KeepRaw {
+		q.Raw = contents
 	}
 
-	numrows := len(crypto[0].PriceData)
-	quote := NewQuote(symbol, numrows)
+	q = limitBars(q.Normalize(), Limit)
+	logBars(pair, len(q.Close), began)
+	return q, nil
+}
 
-	for bar := 0; bar < numrows; bar++ {
-		quote.Date[bar], _ = time.Parse(time.RFC3339, crypto[0].PriceData[bar].Date)
-		quote.Open[bar] = crypto[0].PriceData[bar].Open
-		quote.High[bar] = crypto[0].PriceData[bar].High
-		quote.Low[bar] = crypto[0].PriceData[bar].Low
-		quote.Close[bar] = crypto[0].PriceData[bar].Close
-		quote.Volume[bar] = float64(crypto[0].PriceData[bar].Volume)
+// parseKrakenOHLC - kraken ohlc rows are oldest first,
+// [time, "open", "high", "low", "close", "vwap", "volume", count]
+func parseKrakenOHLC(pair string, contents []byte) (Quote, error) {
+
+	var kraken struct {
+		Error  []string                   `json:"error"`
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(contents, &kraken); err != nil {
+		return NewQuote("", 0), err
+	}
+	if len(kraken.Error) > 0 {
+		if strings.Join(kraken.Error, "") == "EQuery:Unknown asset pair" {
+			return NewQuote("", 0), fmt.Errorf("%w: %s", ErrSymbolNotFound, pair)
+		}
+		return NewQuote("", 0), fmt.Errorf("kraken error: %s", strings.Join(kraken.Error, ", "))
 	}
 
-	return quote, nil
-}
+	var rows [][]interface{}
+	if err := json.Unmarshal(kraken.Result[pair], &rows); err != nil {
+		return NewQuote("", 0), fmt.Errorf("kraken pair '%s' missing from response", pair)
+	}
 
-// NewQuoteFromTiingo - Tiingo daily historical prices for a symbol
-func NewQuoteFromTiingo(symbol, startDate, endDate string, token string) (Quote, error) {
+	q := NewQuote(pair, len(rows))
+	for bar, row := range rows {
+		if len(row) < 7 {
+			return NewQuote("", 0), fmt.Errorf("kraken row %d has %d fields", bar, len(row))
+		}
+		ts, _ := row[0].(float64)
+		q.Date[bar] = unixTime(int64(ts))
+		for i, field := range []*float64{&q.Open[bar], &q.High[bar], &q.Low[bar], &q.Close[bar]} {
+			str, _ := row[i+1].(string)
+			*field, _ = strconv.ParseFloat(str, 64)
+		}
+		str, _ := row[6].(string)
+		q.Volume[bar], _ = strconv.ParseFloat(str, 64)
+	}
+	return q, nil
+}
 
-	from := ParseDateString(startDate)
-	to := ParseDateString(endDate)
+// NewQuotesFromKrakenSyms - create a list of prices from symbols in string array
+func NewQuotesFromKrakenSyms(symbols []string, from, to time.Time, period Period) (Quotes, error) {
+	quotes, _, err := NewQuotesFromKrakenSymsWithErrors(symbols, from, to, period)
+	return quotes, err
+}
 
-	return tiingoDaily(symbol, from, to, token)
+// NewQuotesFromKrakenSymsWithErrors - same as NewQuotesFromKrakenSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromKrakenSymsWithErrors(symbols []string, from, to time.Time, period Period) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromKraken(symbol, from, to, period)
+	})
 }
 
-// NewQuoteFromTiingoCrypto - Tiingo crypto historical prices for a symbol
-func NewQuoteFromTiingoCrypto(symbol, startDate, endDate string, period Period, token string) (Quote, error) {
+// EODHDBaseURL - EOD Historical Data api host
+var EODHDBaseURL = "https://eodhd.com"
 
-	from := ParseDateString(startDate)
-	to := ParseDateString(endDate)
+// EODHDMaxBars - intraday bars requested at once, eodhd caps a request at
+// 120 days of 1m bars, 600 days of 5m bars and 7200 days of 1h bars
+var EODHDMaxBars = 120 * 24 * 60
 
-	return tiingoCrypto(symbol, from, to, period, token)
-}
+// NewQuoteFromEODHD - EOD Historical Data prices for a symbol (AAPL.US, VOD.LSE).
+// Daily, weekly and monthly prices are split and dividend adjusted using
+// adjusted_close, intraday prices are as traded
+func NewQuoteFromEODHD(symbol, startDate, endDate string, period Period, apiKey string) (Quote, error) {
 
-// NewQuotesFromTiingoSyms - create a list of prices from symbols in string array
-func NewQuotesFromTiingoSyms(symbols []string, startDate, endDate string, token string) (Quotes, error) {
+	symbol = NormalizeSymbol("eodhd", symbol)
 
-	quotes := Quotes{}
-	for _, symbol := range symbols {
-		quote, err := NewQuoteFromTiingo(symbol, startDate, endDate, token)
-		if err == nil {
-			quotes = append(quotes, quote)
-		} else {
-			Log.Println("error downloading " + symbol)
-		}
-		time.Sleep(Delay * time.Millisecond)
+	if err := checkPeriod("eodhd", period); err != nil {
+		Log.Println(err)
+		return NewQuote("", 0), err
 	}
-	return quotes, nil
-}
 
-// NewQuotesFromTiingoCryptoSyms - create a list of prices from symbols in string array
-func NewQuotesFromTiingoCryptoSyms(symbols []string, startDate, endDate string, period Period, token string) (Quotes, error) {
+	from := ParseDateString(startDate)
+	to := ParseDateString(endDate)
 
-	quotes := Quotes{}
-	for _, symbol := range symbols {
-		quote, err := NewQuoteFromTiingoCrypto(symbol, startDate, endDate, period, token)
-		if err == nil {
-			quotes = append(quotes, quote)
-		} else {
-			Log.Println("error downloading " + symbol)
+	switch period {
+	case Daily, Weekly, Monthly:
+		began := time.Now()
+		url := fmt.Sprintf(
+			"%s/api/eod/%s?from=%s&to=%s&period=%s&fmt=json&api_token=%s",
+			EODHDBaseURL,
+			symbol,
+			from.Format("2006-01-02"),
+			to.Format("2006-01-02"),
+			period,
+			url.QueryEscape(apiKey))
+		contents, err := eodhdGet(url, symbol)
+		if err != nil {
+			return NewQuote("", 0), err
+		}
+		q, err := parseEODHD(symbol, contents)
+		if err != nil {
+			Log.Printf("eodhd error: %v\n", err)
+			return NewQuote("", 0), err
 		}
-		time.Sleep(Delay * time.Millisecond)
+		if KeepRaw {
+			q.Raw = contents
+		}
+		q = limitBars(q.Normalize(), Limit)
+		logBars(symbol, len(q.Close), began)
+		return q, nil
 	}
-	return quotes, nil
-}
 
-// NewQuoteFromCoinbase - Coinbase Pro historical prices for a symbol
-func NewQuoteFromCoinbase(symbol, startDate, endDate string, period Period) (Quote, error) {
+	interval := map[Period]string{Min1: "1m", Min5: "5m", Min60: "1h"}[period]
+	return pagedBars(symbol, from, to, periodDuration(period), EODHDMaxBars, Limit, func(startBar, endBar time.Time) (Quote, []byte, error) {
 
-	start := ParseDateString(startDate) //.In(time.Now().Location())
-	end := ParseDateString(endDate)     //.In(time.Now().Location())
+		SleepDelay()
+		url := fmt.Sprintf(
+			"%s/api/intraday/%s?interval=%s&from=%d&to=%d&fmt=json&api_token=%s",
+			EODHDBaseURL,
+			symbol,
+			interval,
+			startBar.Unix(),
+			endBar.Unix(),
+			url.QueryEscape(apiKey))
+		contents, err := eodhdGet(url, symbol)
+		if err != nil {
+			return NewQuote("", 0), nil, err
+		}
+		q, err := parseEODHDIntraday(symbol, contents)
+		if err != nil {
+			Log.Printf("eodhd error: %v\n", err)
+		}
+		return q, contents, err
+	})
+}
 
-	var granularity int // seconds
+// eodhdGet - body of an eodhd api request, an error unless it succeeded
+func eodhdGet(url, symbol string) ([]byte, error) {
+	resp, err := newClient().Get(url)
+	if err != nil {
+		Log.Printf("eodhd error: %v\n", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	switch period {
-	case Min1:
-		granularity = 60
-	case Min5:
-		granularity = 5 * 60
-	case Min15:
-		granularity = 15 * 60
-	case Min30:
-		granularity = 30 * 60
-	case Min60:
-		granularity = 60 * 60
-	case Daily:
-		granularity = 24 * 60 * 60
-	case Weekly:
-		granularity = 7 * 24 * 60 * 60
-	default:
-		granularity = 24 * 60 * 60
+	contents, _ := io.ReadAll(resp.Body)
+	saveRaw("eodhd", symbol, contents)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		Log.Printf("symbol '%s' not found\n", symbol)
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	case resp.StatusCode != http.StatusOK:
+		Log.Printf("eodhd error: %s %s\n", resp.Status, contents)
+		return nil, statusError("eodhd", symbol, resp)
 	}
+	return contents, nil
+}
 
-	var quote Quote
-	quote.Symbol = symbol
+// parseEODHD - eodhd end of day prices, oldest first, with prices adjusted by
+// the ratio of adjusted_close to close
+func parseEODHD(symbol string, contents []byte) (Quote, error) {
+
+	var rows []struct {
+		Date          string  `json:"date"`
+		Open          float64 `json:"open"`
+		High          float64 `json:"high"`
+		Low           float64 `json:"low"`
+		Close         float64 `json:"close"`
+		AdjustedClose float64 `json:"adjusted_close"`
+		Volume        float64 `json:"volume"`
+	}
+	if err := json.Unmarshal(contents, &rows); err != nil {
+		return NewQuote("", 0), err
+	}
 
-	maxBars := 200
-	var step = time.Second * time.Duration(granularity)
+	q := NewQuote(symbol, len(rows))
+	for bar, row := range rows {
+		date, err := time.ParseInLocation("2006-01-02", row.Date, Location)
+		if err != nil {
+			return NewQuote("", 0), err
+		}
+		ratio := 1.0
+		if row.Close != 0 && row.AdjustedClose != 0 {
+			ratio = row.AdjustedClose / row.Close
+		}
+		q.Date[bar] = date
+		q.Open[bar] = row.Open * ratio
+		q.High[bar] = row.High * ratio
+		q.Low[bar] = row.Low * ratio
+		q.Close[bar] = row.Close * ratio
+		q.Volume[bar] = row.Volume
+	}
+	return q, nil
+}
 
-	startBar := start
-	endBar := startBar.Add(time.Duration(maxBars) * step)
+// parseEODHDIntraday - eodhd intraday prices, oldest first, dated by unix timestamp
+func parseEODHDIntraday(symbol string, contents []byte) (Quote, error) {
 
-	if endBar.After(end) {
-		endBar = end
+	var rows []struct {
+		Timestamp int64   `json:"timestamp"`
+		Open      float64 `json:"open"`
+		High      float64 `json:"high"`
+		Low       float64 `json:"low"`
+		Close     float64 `json:"close"`
+		Volume    float64 `json:"volume"`
+	}
+	if err := json.Unmarshal(contents, &rows); err != nil {
+		return NewQuote("", 0), err
 	}
 
-	//Log.Printf("startBar=%v, endBar=%v\n", startBar, endBar)
+	q := NewQuote(symbol, len(rows))
+	for bar, row := range rows {
+		q.Date[bar] = unixTime(row.Timestamp)
+		q.Open[bar] = row.Open
+		q.High[bar] = row.High
+		q.Low[bar] = row.Low
+		q.Close[bar] = row.Close
+		q.Volume[bar] = row.Volume
+	}
+	return q, nil
+}
 
-	for startBar.Before(end) {
+// Dividend - a cash dividend of Amount per share going ex on Date
+type Dividend struct {
+	Date   time.Time
+	Amount float64
+}
 
-		url := fmt.Sprintf(
-			"https://api.exchange.coinbase.com/products/%s/candles?start=%s&end=%s&granularity=%d",
-			symbol,
-			url.QueryEscape(startBar.Format(time.RFC3339)),
-			url.QueryEscape(endBar.Format(time.RFC3339)),
-			granularity)
+// NewSplitsFromEODHD - EOD Historical Data splits of a symbol between two dates
+func NewSplitsFromEODHD(symbol, startDate, endDate, apiKey string) ([]Split, error) {
 
-		client := &http.Client{Timeout: ClientTimeout}
-		req, _ := http.NewRequest("GET", url, nil)
-		resp, err := client.Do(req)
+	var rows []struct {
+		Date  string `json:"date"`
+		Split string `json:"split"` // "4.000000/1.000000"
+	}
+	if err := eodhdEvents("splits", symbol, startDate, endDate, apiKey, &rows); err != nil {
+		return nil, err
+	}
 
+	splits := make([]Split, 0, len(rows))
+	for _, row := range rows {
+		date, err := time.ParseInLocation("2006-01-02", row.Date, Location)
 		if err != nil {
-			Log.Printf("coinbase error: %v\n", err)
-			return NewQuote("", 0), err
+			return nil, err
 		}
-		defer resp.Body.Close()
-
-		contents, _ := io.ReadAll(resp.Body)
-
-		type cb [6]float64
-		var bars []cb
-		err = json.Unmarshal(contents, &bars)
-		if err != nil {
-			Log.Printf("coinbase error: %v\n", err)
+		newShares, oldShares, ok := strings.Cut(row.Split, "/")
+		n, err1 := strconv.ParseFloat(newShares, 64)
+		o, err2 := strconv.ParseFloat(oldShares, 64)
+		if !ok || err1 != nil || err2 != nil || o == 0 {
+			return nil, fmt.Errorf("eodhd: invalid split '%s'", row.Split)
 		}
+		splits = append(splits, Split{Date: date, Ratio: n / o})
+	}
+	return splits, nil
+}
 
-		numrows := len(bars)
-		q := NewQuote(symbol, numrows)
+// NewDividendsFromEODHD - EOD Historical Data dividends of a symbol between
+// two dates, split adjusted
+func NewDividendsFromEODHD(symbol, startDate, endDate, apiKey string) ([]Dividend, error) {
 
-		//Log.Printf("numrows=%d, bars=%v\n", numrows, bars)
+	var rows []struct {
+		Date  string  `json:"date"`
+		Value float64 `json:"value"`
+	}
+	if err := eodhdEvents("div", symbol, startDate, endDate, apiKey, &rows); err != nil {
+		return nil, err
+	}
 
-		for row := 0; row < numrows; row++ {
-			bar := numrows - 1 - row // reverse the order
-			q.Date[bar] = time.Unix(int64(bars[row][0]), 0)
-			q.Low[bar] = bars[row][1]
-			q.High[bar] = bars[row][2]
-			q.Open[bar] = bars[row][3]
-			q.Close[bar] = bars[row][4]
-			q.Volume[bar] = bars[row][5]
+	dividends := make([]Dividend, 0, len(rows))
+	for _, row := range rows {
+		date, err := time.ParseInLocation("2006-01-02", row.Date, Location)
+		if err != nil {
+			return nil, err
 		}
-		quote.Date = append(quote.Date, q.Date...)
-		quote.Low = append(quote.Low, q.Low...)
-		quote.High = append(quote.High, q.High...)
-		quote.Open = append(quote.Open, q.Open...)
-		quote.Close = append(quote.Close, q.Close...)
-		quote.Volume = append(quote.Volume, q.Volume...)
-
-		time.Sleep(time.Second)
-		startBar = endBar.Add(step)
-		endBar = startBar.Add(time.Duration(maxBars) * step)
-
+		dividends = append(dividends, Dividend{Date: date, Amount: row.Value})
 	}
-
-	return quote, nil
+	return dividends, nil
 }
 
-// NewQuotesFromCoinbase - create a list of prices from symbols in file
-func NewQuotesFromCoinbase(filename, startDate, endDate string, period Period) (Quotes, error) {
-
-	quotes := Quotes{}
-	inFile, err := os.Open(filename)
+// eodhdEvents - decode the splits or div api response for a symbol into rows
+func eodhdEvents(kind, symbol, startDate, endDate, apiKey string, rows interface{}) error {
+	symbol = NormalizeSymbol("eodhd", symbol)
+	url := fmt.Sprintf(
+		"%s/api/%s/%s?from=%s&to=%s&fmt=json&api_token=%s",
+		EODHDBaseURL,
+		kind,
+		symbol,
+		ParseDateString(startDate).Format("2006-01-02"),
+		ParseDateString(endDate).Format("2006-01-02"),
+		url.QueryEscape(apiKey))
+	contents, err := eodhdGet(url, symbol)
 	if err != nil {
-		return quotes, err
+		return err
 	}
-	defer inFile.Close()
-	scanner := bufio.NewScanner(inFile)
-	scanner.Split(bufio.ScanLines)
+	return json.Unmarshal(contents, rows)
+}
 
-	for scanner.Scan() {
-		sym := scanner.Text()
-		quote, err := NewQuoteFromCoinbase(sym, startDate, endDate, period)
-		if err == nil {
-			quotes = append(quotes, quote)
-		} else {
-			Log.Println("error downloading " + sym)
-		}
-		time.Sleep(Delay * time.Millisecond)
-	}
-	return quotes, nil
+// NewQuotesFromEODHDSyms - create a list of prices from symbols in string array
+func NewQuotesFromEODHDSyms(symbols []string, startDate, endDate string, period Period, apiKey string) (Quotes, error) {
+	quotes, _, err := NewQuotesFromEODHDSymsWithErrors(symbols, startDate, endDate, period, apiKey)
+	return quotes, err
 }
 
-// NewQuotesFromCoinbaseSyms - create a list of prices from symbols in string array
-func NewQuotesFromCoinbaseSyms(symbols []string, startDate, endDate string, period Period) (Quotes, error) {
+// NewQuotesFromEODHDSymsWithErrors - same as NewQuotesFromEODHDSyms, also returning the
+// download error of each symbol that failed so just those can be retried
+func NewQuotesFromEODHDSymsWithErrors(symbols []string, startDate, endDate string, period Period, apiKey string) (Quotes, map[string]error, error) {
+	return downloadSyms(symbols, func(symbol string) (Quote, error) {
+		return NewQuoteFromEODHD(symbol, startDate, endDate, period, apiKey)
+	})
+}
+
+// downloadSyms - fetch each symbol in turn, collecting the quotes that
+// downloaded and the error of each symbol that didn't
+func downloadSyms(symbols []string, fetch func(symbol string) (Quote, error)) (Quotes, map[string]error, error) {
+	return downloadSymsContext(context.Background(), symbols, fetch)
+}
+
+// downloadSymsContext - downloadSyms that stops starting new symbols once ctx
+// is done, returning what was collected and an error wrapping the ctx error.
+// A download already running when ctx ends is allowed to finish
+func downloadSymsContext(ctx context.Context, symbols []string, fetch func(symbol string) (Quote, error)) (Quotes, map[string]error, error) {
 
 	quotes := Quotes{}
-	for _, symbol := range symbols {
-		quote, err := NewQuoteFromCoinbase(symbol, startDate, endDate, period)
+	errs := map[string]error{}
+	failed := 0
+	for i, symbol := range symbols {
+		if err := ctx.Err(); err != nil {
+			return quotes, errs, fmt.Errorf("stopped after %d of %d symbols: %w", i, len(symbols), err)
+		}
+		quote, err := fetchRetry(symbol, fetch)
 		if err == nil {
 			quotes = append(quotes, quote)
 		} else {
+			failed++
+			errs[symbol] = err
 			Log.Println("error downloading " + symbol)
 		}
-		time.Sleep(Delay * time.Millisecond)
+		SleepDelay()
 	}
-	return quotes, nil
+	return quotes, errs, batchError(failed, len(symbols))
+}
+
+// fetchRetry - fetch a symbol, trying again up to Retries times unless the
+// error won't go away by asking again
+func fetchRetry(symbol string, fetch func(symbol string) (Quote, error)) (Quote, error) {
+	quote, err := fetch(symbol)
+	for try := 0; try < Retries && err != nil && !permanentError(err); try++ {
+		Log.Printf("retrying %s: %v\n", symbol, err)
+		SleepDelay()
+		quote, err = fetch(symbol)
+	}
+	return quote, err
+}
+
+// permanentError - a download error that retrying can't fix
+func permanentError(err error) bool {
+	return errors.Is(err, ErrSymbolNotFound) || errors.Is(err, ErrUnsupportedPeriod) || errors.Is(err, ErrUnauthorized)
+}
+
+// batchError - summarize failed symbols from a batch download, nil if none failed
+func batchError(failed, total int) error {
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d symbols failed", failed, total)
 }
 
 // NewEtfList - download a list of etf symbols to an array of strings
@@ -1116,21 +5658,52 @@ func NewEtfList() ([]string, error) {
 
 	var symbols []string
 
+	infos, err := newEtfInfo()
+	if err != nil {
+		return symbols, err
+	}
+	for _, info := range infos {
+		symbols = append(symbols, info.Symbol)
+	}
+	return symbols, nil
+}
+
+// etf listing exchange codes in otherlisted.txt
+var etfExchanges = map[string]string{
+	"A": "NYSE American",
+	"N": "NYSE",
+	"P": "NYSE Arca",
+	"Z": "Cboe BZX",
+	"V": "IEX",
+}
+
+// newEtfInfo - download the etfs listed outside nasdaq, with their name and exchange
+func newEtfInfo() ([]SymbolInfo, error) {
+
 	buf, err := getAnonFTP("ftp.nasdaqtrader.com", "21", "symboldirectory", "otherlisted.txt")
 	if err != nil {
 		Log.Println(err)
-		return symbols, err
+		return nil, err
 	}
+	return parseEtfInfo(string(buf)), nil
+}
 
-	for _, line := range strings.Split(string(buf), "\n") {
+// parseEtfInfo - the etfs, not test issues, in an otherlisted.txt, sorted
+func parseEtfInfo(listing string) []SymbolInfo {
+	var infos []SymbolInfo
+	for _, line := range strings.Split(listing, "\n") {
 		// ACT Symbol|Security Name|Exchange|CQS Symbol|ETF|Round Lot Size|Test Issue|NASDAQ Symbol
-		cols := strings.Split(line, "|")
-		if len(cols) > 5 && cols[4] == "Y" && cols[6] == "N" {
-			symbols = append(symbols, strings.ToLower(cols[0]))
+		cols := strings.Split(strings.TrimSuffix(line, "\r"), "|")
+		if len(cols) > 6 && cols[4] == "Y" && cols[6] == "N" {
+			exchange := etfExchanges[cols[2]]
+			if exchange == "" {
+				exchange = cols[2]
+			}
+			infos = append(infos, SymbolInfo{Symbol: strings.ToLower(cols[0]), Name: cols[1], Exchange: exchange})
 		}
 	}
-	sort.Strings(symbols)
-	return symbols, nil
+	sortSymbolInfo(infos)
+	return infos
 }
 
 // NewEtfFile - download a list of etf symbols to a file
@@ -1142,7 +5715,16 @@ func NewEtfFile(filename string) error {
 	if err != nil {
 		return err
 	}
-	ba := []byte(strings.Join(etfs, "\n"))
+	return writeSymbolFile(filename, "etf", etfs)
+}
+
+// writeSymbolFile - write a downloaded symbol list one per line, refusing an
+// empty list so a bad upstream response doesn't clobber a good existing file
+func writeSymbolFile(filename, market string, syms []string) error {
+	if len(syms) == 0 {
+		return fmt.Errorf("%s market list is empty, not writing %s", market, filename)
+	}
+	ba := []byte(strings.Join(syms, "\n"))
 	return os.WriteFile(filename, ba, 0644)
 }
 
@@ -1174,6 +5756,15 @@ var ValidMarkets = [...]string{
 	"tiingo-eth",
 	"tiingo-usd",
 	"coinbase",
+	"deribit",
+	"bybit",
+}
+
+// Markets - list of markets that can be downloaded
+func Markets() []string {
+	markets := make([]string, len(ValidMarkets))
+	copy(markets, ValidMarkets[:])
+	return markets
 }
 
 // ValidMarket - validate market string
@@ -1194,10 +5785,97 @@ func ValidMarket(market string) bool {
 
 // NewMarketList - download a list of market symbols to an array of strings
 func NewMarketList(market string) ([]string, error) {
+	symbols, _, err := NewMarketListWithMeta(market)
+	return symbols, err
+}
+
+// NewMarketListWithMeta - download a list of market symbols along with the time
+// the list is as of. That is the screener's asOf date for the nasdaq markets and
+// the Last-Modified header for the others, zero if the source doesn't say
+func NewMarketListWithMeta(market string) ([]string, time.Time, error) {
 
 	var symbols []string
+	newStr, asOf, err := getMarketBody(market)
+	if err != nil {
+		return symbols, asOf, err
+	}
+
+	if strings.HasPrefix(market, "tiingo") {
+		symbols, err = getTiingoCryptoMarket(market, newStr)
+		return symbols, asOf, err
+	}
+
+	if strings.HasPrefix(market, "coinbase") {
+		symbols, err = getCoinbaseMarket(market, newStr)
+		return symbols, asOf, err
+	}
+
+	if market == "deribit" {
+		symbols, err = getDeribitMarket(market, newStr)
+		return symbols, asOf, err
+	}
+
+	if market == "bybit" {
+		symbols, err = getBybitMarket(market, newStr)
+		return symbols, asOf, err
+	}
+
+	if market == "nasdaq100" {
+		return getNasdaq100Market(market, newStr)
+	}
+
+	return getNasdaqMarket(market, newStr)
+
+}
+
+// SymbolInfo - a market list symbol with the details its source lists, the
+// nasdaq screener's name, sector, market cap and last sale price, and the
+// name and exchange of etfs. Details a market's source doesn't have are empty
+type SymbolInfo struct {
+	Symbol    string
+	Name      string
+	Sector    string
+	MarketCap float64
+	LastSale  float64
+	Exchange  string
+}
+
+// NewMarketListDetailed - download a list of market symbols with their details,
+// in the same order as NewMarketList
+func NewMarketListDetailed(market string) ([]SymbolInfo, error) {
+
+	if market == "etf" {
+		return newEtfInfo()
+	}
+	if strings.HasPrefix(market, "tiingo") || market == "coinbase" || market == "deribit" || market == "bybit" {
+		// crypto markets have nothing past the symbol
+		symbols, err := NewMarketList(market)
+		infos := make([]SymbolInfo, len(symbols))
+		for i, symbol := range symbols {
+			infos[i].Symbol = symbol
+		}
+		return infos, err
+	}
+
+	newStr, _, err := getMarketBody(market)
+	if err != nil {
+		return nil, err
+	}
+	if market == "nasdaq100" {
+		infos, _, err := getNasdaq100Info(market, newStr)
+		return infos, err
+	}
+	infos, _, err := getNasdaqInfo(market, newStr)
+	return infos, err
+}
+
+// getMarketBody - download a market list's json, and the time it is as of
+// from the Last-Modified header, zero if there is none
+func getMarketBody(market string) (string, time.Time, error) {
+
+	var asOf time.Time
 	if !ValidMarket(market) {
-		return symbols, fmt.Errorf("invalid market")
+		return "", asOf, fmt.Errorf("invalid market")
 	}
 	var url string
 	switch market {
@@ -1244,44 +5922,47 @@ func NewMarketList(market string) ([]string, error) {
 	case "technology":
 		url = "https://api.nasdaq.com/api/screener/stocks?tableonly=true&offset=0&download=true&sector=technology"
 	case "tiingo-btc":
-		url = fmt.Sprintf("https://api.tiingo.com/tiingo/crypto?token=%s", os.Getenv("TIINGO_API_TOKEN"))
+		url = fmt.Sprintf("%s?token=%s", tiingoCryptoURL, os.Getenv("TIINGO_API_TOKEN"))
 	case "tiingo-eth":
-		url = fmt.Sprintf("https://api.tiingo.com/tiingo/crypto?token=%s", os.Getenv("TIINGO_API_TOKEN"))
+		url = fmt.Sprintf("%s?token=%s", tiingoCryptoURL, os.Getenv("TIINGO_API_TOKEN"))
 	case "tiingo-usd":
-		url = fmt.Sprintf("https://api.tiingo.com/tiingo/crypto?token=%s", os.Getenv("TIINGO_API_TOKEN"))
+		url = fmt.Sprintf("%s?token=%s", tiingoCryptoURL, os.Getenv("TIINGO_API_TOKEN"))
 	case "coinbase":
-		url = "https://api.exchange.coinbase.com/products"
+		url = CoinbaseBaseURL + "/products"
+	case "deribit":
+		url = "https://www.deribit.com/api/v2/public/get_instruments?currency=any&kind=future&expired=false"
+	case "bybit":
+		url = "https://api.bybit.com/v5/market/instruments-info?category=spot"
 	}
 
+	// nasdaq.com rejects requests that don't look like they come from a browser
 	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("User-Agent", "markcheno/go-quote")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	client := &http.Client{}
+	req.Header.Add("User-Agent", pickRandomUserAgent())
+	req.Header.Add("Accept", "application/json, text/plain, */*")
+	req.Header.Add("Accept-Language", "en-US,en;q=0.9")
+	client := &http.Client{Transport: clientTransport()}
 	resp, err := client.Do(req)
 	if err != nil {
-		return symbols, err
+		return "", asOf, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return "", asOf, fmt.Errorf("%s market list request failed: %s", market, resp.Status)
+	}
+
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(resp.Body)
 	newStr := buf.String()
 
-	if strings.HasPrefix(market, "tiingo") {
-		return getTiingoCryptoMarket(market, newStr)
-	}
-
-	if strings.HasPrefix(market, "coinbase") {
-		return getCoinbaseMarket(market, newStr)
+	if body := strings.TrimSpace(newStr); !strings.HasPrefix(body, "{") && !strings.HasPrefix(body, "[") {
+		return "", asOf, fmt.Errorf("%s market list returned a non-json response", market)
 	}
 
-	if market == "nasdaq100" {
-		return getNasdaq100Market(market, newStr)
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		asOf = modified
 	}
-
-	return getNasdaqMarket(market, newStr)
-
+	return newStr, asOf, nil
 }
 
 func getTiingoCryptoMarket(market, rawdata string) ([]string, error) {
@@ -1314,7 +5995,30 @@ func getTiingoCryptoMarket(market, rawdata string) ([]string, error) {
 	return symbols, err
 }
 
-func getNasdaqMarket(market, rawdata string) ([]string, error) {
+func getNasdaqMarket(market, rawdata string) ([]string, time.Time, error) {
+	infos, asOf, err := getNasdaqInfo(market, rawdata)
+	if err != nil {
+		return nil, asOf, err
+	}
+	var symbols []string
+	for _, info := range infos {
+		symbols = append(symbols, info.Symbol)
+	}
+	return symbols, asOf, nil
+}
+
+// parseNasdaqNumber - screener number such as "$1,234.50", 0 for "NA" or empty
+func parseNasdaqNumber(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.NewReplacer("$", "", ",", "", " ", "").Replace(s), 64)
+	return f
+}
+
+// sortSymbolInfo - sort by symbol, the order of the symbol-only market lists
+func sortSymbolInfo(infos []SymbolInfo) {
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Symbol < infos[j].Symbol })
+}
+
+func getNasdaqInfo(market, rawdata string) ([]SymbolInfo, time.Time, error) {
 
 	// https://www.nasdaq.com/market-activity/stocks/screener
 
@@ -1334,6 +6038,7 @@ func getNasdaqMarket(market, rawdata string) ([]string, error) {
 		NetChange string `json:"netchange"`
 		PctChange string `json:"pctchange"`
 		MarketCap string `json:"marketCap"`
+		Sector    string `json:"sector"`
 		URL       string `json:"url"`
 	}
 
@@ -1359,21 +6064,56 @@ func getNasdaqMarket(market, rawdata string) ([]string, error) {
 	var apiResponse ApiResponse
 	err := json.Unmarshal([]byte(rawdata), &apiResponse)
 	if err != nil {
-		log.Fatalf("Error parsing JSON: %v", err)
+		return nil, time.Time{}, fmt.Errorf("error parsing %s market JSON: %v", market, err)
 	}
 
-	var symbols []string
+	var infos []SymbolInfo
 	for _, row := range apiResponse.Data.Rows {
-		symbols = append(symbols, strings.ToLower(row.Symbol))
-		//fmt.Printf("Symbol: %s\n", row.Symbol)
+		infos = append(infos, SymbolInfo{
+			Symbol:    strings.ToLower(row.Symbol),
+			Name:      row.Name,
+			Sector:    row.Sector,
+			MarketCap: parseNasdaqNumber(row.MarketCap),
+			LastSale:  parseNasdaqNumber(row.LastSale),
+		})
 	}
+	sortSymbolInfo(infos)
 
-	sort.Strings(symbols)
+	var asOf time.Time
+	if apiResponse.Data.AsOf != nil {
+		asOf = parseNasdaqAsOf(*apiResponse.Data.AsOf)
+	}
+	return infos, asOf, err
+}
 
-	return symbols, err
+// parseNasdaqAsOf - date from a screener asOf string such as
+// "Last price as of Feb 7, 2025", zero if it can't be read
+func parseNasdaqAsOf(asOf string) time.Time {
+	if i := strings.LastIndex(strings.ToLower(asOf), "as of "); i >= 0 {
+		asOf = asOf[i+len("as of "):]
+	}
+	asOf = strings.TrimSpace(asOf)
+	for _, layout := range []string{"Jan 2, 2006", "Jan 2, 2006 3:04 PM", "January 2, 2006", "01/02/2006"} {
+		if t, err := time.Parse(layout, asOf); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func getNasdaq100Market(market, rawdata string) ([]string, time.Time, error) {
+	infos, asOf, err := getNasdaq100Info(market, rawdata)
+	if err != nil {
+		return nil, asOf, err
+	}
+	var symbols []string
+	for _, info := range infos {
+		symbols = append(symbols, info.Symbol)
+	}
+	return symbols, asOf, nil
 }
 
-func getNasdaq100Market(market, rawdata string) ([]string, error) {
+func getNasdaq100Info(market, rawdata string) ([]SymbolInfo, time.Time, error) {
 
 	// https://api.nasdaq.com/api/quote/list-type/nasdaq100
 
@@ -1427,18 +6167,26 @@ func getNasdaq100Market(market, rawdata string) ([]string, error) {
 	var apiResponse ApiResponse
 	err := json.Unmarshal([]byte(rawdata), &apiResponse)
 	if err != nil {
-		log.Fatalf("Error parsing JSON: %v", err)
+		return nil, time.Time{}, fmt.Errorf("error parsing %s market JSON: %v", market, err)
 	}
 
-	var symbols []string
+	var infos []SymbolInfo
 	for _, row := range apiResponse.Data.Data.Rows {
-		symbols = append(symbols, strings.ToLower(row.Symbol))
-		//fmt.Printf("Symbol: %s\n", row.Symbol)
+		infos = append(infos, SymbolInfo{
+			Symbol:    strings.ToLower(row.Symbol),
+			Name:      row.Name,
+			Sector:    row.Sector,
+			MarketCap: parseNasdaqNumber(row.MarketCap),
+			LastSale:  parseNasdaqNumber(row.LastSalePrice),
+		})
 	}
+	sortSymbolInfo(infos)
 
-	sort.Strings(symbols)
-
-	return symbols, err
+	var asOf time.Time
+	if apiResponse.Data.Data.AsOf != nil {
+		asOf = parseNasdaqAsOf(*apiResponse.Data.Data.AsOf)
+	}
+	return infos, asOf, err
 }
 
 func getCoinbaseMarket(market, rawdata string) ([]string, error) {
@@ -1483,6 +6231,72 @@ func getCoinbaseMarket(market, rawdata string) ([]string, error) {
 	return symbols, err
 }
 
+func getDeribitMarket(market, rawdata string) ([]string, error) {
+
+	type Instrument struct {
+		InstrumentName string `json:"instrument_name"`
+		Kind           string `json:"kind"`
+		IsActive       bool   `json:"is_active"`
+	}
+
+	type ApiResponse struct {
+		Result []Instrument `json:"result"`
+	}
+
+	var apiResponse ApiResponse
+	err := json.Unmarshal([]byte(rawdata), &apiResponse)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	var symbols []string
+	for _, inst := range apiResponse.Result {
+		if inst.IsActive {
+			symbols = append(symbols, inst.InstrumentName)
+		}
+	}
+
+	sort.Strings(symbols)
+
+	return symbols, err
+}
+
+func getBybitMarket(market, rawdata string) ([]string, error) {
+
+	type Instrument struct {
+		Symbol string `json:"symbol"`
+		Status string `json:"status"`
+	}
+
+	type ApiResponse struct {
+		RetCode int    `json:"retCode"`
+		RetMsg  string `json:"retMsg"`
+		Result  struct {
+			List []Instrument `json:"list"`
+		} `json:"result"`
+	}
+
+	var apiResponse ApiResponse
+	err := json.Unmarshal([]byte(rawdata), &apiResponse)
+	if err != nil {
+		fmt.Println(err)
+	}
+	if err == nil && apiResponse.RetCode != 0 {
+		err = fmt.Errorf("bybit error: %s", apiResponse.RetMsg)
+	}
+
+	var symbols []string
+	for _, inst := range apiResponse.Result.List {
+		if inst.Status == "Trading" {
+			symbols = append(symbols, inst.Symbol)
+		}
+	}
+
+	sort.Strings(symbols)
+
+	return symbols, err
+}
+
 // NewMarketFile - download a list of market symbols to a file
 func NewMarketFile(market, filename string) error {
 	if !ValidMarket(market) {
@@ -1496,18 +6310,51 @@ func NewMarketFile(market, filename string) error {
 	if err != nil {
 		return err
 	}
-	ba := []byte(strings.Join(syms, "\n"))
-	return os.WriteFile(filename, ba, 0644)
+	return writeSymbolFile(filename, market, syms)
+}
+
+// NewMarketFileWithMeta - same as NewMarketFile, also writing the time the list
+// is as of to a filename.asof sidecar so a universe snapshot can be dated later.
+// No sidecar is written when the source doesn't say
+func NewMarketFileWithMeta(market, filename string) error {
+	if !ValidMarket(market) {
+		return fmt.Errorf("invalid market")
+	}
+	// default filename
+	if filename == "" {
+		filename = market + ".txt"
+	}
+	syms, asOf, err := NewMarketListWithMeta(market)
+	if err != nil {
+		return err
+	}
+	if err = writeSymbolFile(filename, market, syms); err != nil || asOf.IsZero() {
+		return err
+	}
+	return os.WriteFile(filename+".asof", []byte(asOf.Format(time.RFC3339)+"\n"), 0644)
 }
 
-// NewSymbolsFromFile - read symbols from a file
+// NewSymbolsFromFile - read symbols from a file, lowercased
 func NewSymbolsFromFile(filename string) ([]string, error) {
+	symbols, err := NewSymbolsFromFileRaw(filename)
+	for i := range symbols {
+		symbols[i] = strings.ToLower(symbols[i])
+	}
+	return symbols, err
+}
+
+// NewSymbolsFromFileRaw - read symbols from a file keeping their case, for
+// sources with case-sensitive symbols such as coinbase or kraken
+func NewSymbolsFromFileRaw(filename string) ([]string, error) {
 	raw, err := os.ReadFile(filename)
 	if err != nil {
 		return []string{}, err
 	}
 
-	a := strings.Split(strings.ToLower(string(raw)), "\n")
+	a := strings.Split(string(raw), "\n")
+	for i := range a {
+		a[i] = strings.TrimSpace(a[i])
+	}
 
 	return deleteEmpty(a), nil
 }
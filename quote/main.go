@@ -12,10 +12,14 @@ Licensed under terms of MIT license
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/markcheno/go-quote"
@@ -24,62 +28,131 @@ import (
 var usage = `Usage:
   quote -h | -help
   quote -v | -version
+  quote -list-markets
   quote <market> [-output=<outputFile>]
   quote [-years=<years>|(-start=<datestr> [-end=<datestr>])] [options] [-infile=<filename>|<symbol> ...]
 
 Options:
   -h -help             show help
   -v -version          show version
+  -list-markets        list valid markets
   -years=<years>       number of years to download [default=5]
   -start=<datestr>     yyyy[-[mm-[dd]]]
   -end=<datestr>       yyyy[-[mm-[dd]]] [default=today]
+  -limit=<n>           keep only the last n bars of each symbol, paged sources don't download the rest [default=0]
+  -since-file=<file>   start after the last bar in this csv or json file, overriding -start and -years,
+                       appending to it when it is also the -outfile, nothing is downloaded when it is current
   -infile=<filename>   list of symbols to download
   -outfile=<filename>  output filename
-  -period=<period>     1m|3m|5m|15m|30m|1h|2h|4h|6h|8h|12h|d|3d|w|m [default=d]
-  -source=<source>     yahoo|tiingo|tiingo-crypto|coinbase [default=yahoo]
-  -token=<tiingo_tok>  tingo api token [default=TIINGO_API_TOKEN]
-  -format=<format>     (csv|json|hs|ami) [default=csv]
+  -period=<period>     1m|3m|5m|15m|30m|1h|2h|4h|6h|8h|12h|d|3d|w|m|q|y [default=d]
+                       q and y are resampled from monthly or daily bars when the source has no quarterly or yearly ones
+  -resample=<period>   also write a copy resampled to a coarser period (e.g. spy_1h.csv)
+  -indicators=<list>   extra csv columns, a registered indicator and period (sma20,ema50,rsi14,vwap20)
+  -source=<source>     yahoo|tiingo|tiingo-crypto|tiingo-fx|coinbase|coinbase-advanced|deribit|gateio|bybit|kraken|mexc|eodhd [default=yahoo]
+  -token=<tiingo_tok>  tingo api token, or comma separated list to rotate with -source=tiingo [default=TIINGO_API_TOKEN]
+                       eodhd api token with -source=eodhd [default=EODHD_API_TOKEN]
+  -format=<format>     csv|json|hs|ami|arrow|png|all, or comma separated list, png is a chart of each symbol [default=csv]
   -adjust=<bool>       adjust yahoo prices [default=true]
+  -dateonly=<bool>     omit the time from daily csv dates [default=false]
+  -epoch=<unit>        write csv dates as unix timestamps in s (seconds) or ms (milliseconds)
+  -separator=<sep>     csv field separator [default=,]
+  -decimal=<sep>       csv decimal separator [default=.]
   -all=<bool>          all in one file (true|false) [default=false]
+  -chunk-symbols=<n>   with -all, split the output into files of at most n symbols (quotes_1.csv, quotes_2.csv) [default=0]
+  -partition=<bool>    with -all, write a hive style parquet dataset instead of -format files, one file per symbol
+                       under a directory named after -outfile (quotes/symbol=spy/data.parquet) [default=false]
+  -workers=<n>         symbols downloaded at once, only with -source=coinbase and -all [default=1]
+  -retries=<n>         download a failed symbol again up to n times, unless the source doesn't know it [default=0]
+  -notfound-file=<file>
+                       write the symbols the source doesn't know (delisted, renamed), one per line
+  -update=<bool>       symbols are existing csv files (spy.csv), append bars newer than each file's last date [default=false]
   -log=<dest>          filename|stdout|stderr|discard [default=stdout]
   -delay=<ms>          delay in milliseconds between quote requests
+  -jitter=<ms>         randomly vary each delay by up to this many milliseconds [default=0]
+  -env-file=<file>     load KEY=VALUE lines (TIINGO_API_TOKEN=...) into the environment first, without replacing variables already set
+  -cacert=<filename>   extra CA certificates (PEM) [default=QUOTE_CA_BUNDLE]
+  -insecure=<bool>     skip TLS certificate verification [default=false]
+  -verbose=<bool>      log request urls, status, bar counts and timing [default=false]
+  -check=<bool>        check the source is reachable and the token works before downloading [default=false]
+  -verify=<bool>       re-read each csv, json or ami file after writing it and check the bars, exit non-zero if any fail,
+                       files in other formats are logged as not verified [default=false]
 
 Note: not all periods work with all sources
 
+Proxies are taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+
+Market lists also write <outputFile>.asof holding the time the list is as of, when the source reports one
+
 Valid markets:
 etf,nasdaq,nasdaq100,amex,nyse,megacap,largecap,midcap,smallcap,microcap,nanocap,
 telecommunications,health_care,finance,real_estate,consumer_discretionary,
 consumer_staples,industrials,basic_materials,energy,utilities,technology
-coinbase,tiingo-usd,tiingo-btc,tiingo-eth
+coinbase,deribit,bybit,tiingo-usd,tiingo-btc,tiingo-eth
 `
 
 const (
-	version    = "0.3"
-	dateFormat = "2006-01-02"
+	version     = "0.3"
+	dateFormat  = "2006-01-02"
+	chartWidth  = 1200
+	chartHeight = 800
 )
 
 type quoteflags struct {
-	years   int
-	delay   int
-	start   string
-	end     string
-	period  string
-	source  string
-	token   string
-	infile  string
-	outfile string
-	format  string
-	log     string
-	all     bool
-	adjust  bool
-	version bool
+	years      int
+	delay      int
+	jitter     int
+	start      string
+	end        string
+	period     string
+	source     string
+	token      string
+	infile     string
+	outfile    string
+	format     string
+	resample   string
+	log        string
+	cacert     string
+	fieldsep   string
+	decimal    string
+	all        bool
+	adjust     bool
+	dateonly   bool
+	version    bool
+	markets    bool
+	insecure   bool
+	verbose    bool
+	update     bool
+	check      bool
+	indicators string
+	workers    int
+	sinceFile  string
+	since      time.Time
+	chunk      int
+	envFile    string
+	retries    int
+	notFound   string
+	verify     bool
+	partition  bool
+	limit      int
+	epoch      string
+}
+
+// flagPassed - true if the named flag was set on the command line
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
 }
 
 func check(e error) {
 	if e != nil {
 		fmt.Printf("\nerror: %v\n\n", e)
 		fmt.Println(usage)
-		os.Exit(0)
+		os.Exit(1)
 		//panic(e)
 	}
 }
@@ -90,46 +163,130 @@ func checkFlags(flags quoteflags) error {
 	if flags.source != "yahoo" &&
 		flags.source != "tiingo" &&
 		flags.source != "tiingo-crypto" &&
-		flags.source != "coinbase" {
-		return fmt.Errorf("invalid source, must be either 'yahoo', 'tiingo', or 'coinbase'")
+		flags.source != "tiingo-fx" &&
+		flags.source != "coinbase" &&
+		flags.source != "coinbase-advanced" &&
+		flags.source != "deribit" &&
+		flags.source != "gateio" &&
+		flags.source != "bybit" &&
+		flags.source != "kraken" &&
+		flags.source != "mexc" &&
+		flags.source != "eodhd" {
+		return fmt.Errorf("invalid source, must be either 'yahoo', 'tiingo', 'tiingo-crypto', 'tiingo-fx', 'coinbase', 'coinbase-advanced', 'deribit', 'gateio', 'bybit', 'kraken', 'mexc' or 'eodhd'")
 	}
 
 	// validate period
-	if flags.source == "yahoo" &&
-		(flags.period == "1m" || flags.period == "5m" || flags.period == "15m" || flags.period == "30m" || flags.period == "1h") {
-		return fmt.Errorf("invalid period for yahoo, must be 'd'")
+	if periodIndex(flags.period) < 0 {
+		return fmt.Errorf("invalid period '%s'", flags.period)
 	}
-	if flags.source == "tiingo" {
-		// check period
-		if flags.period != "d" {
-			return fmt.Errorf("invalid period for tiingo, must be 'd'")
+	if !supportsPeriod(flags.source, downloadPeriod(flags.source, getPeriod(flags.period))) {
+		return fmt.Errorf("invalid period for %s, must be one of %s", flags.source, periodNames(flags.source))
+	}
+
+	// resample target must be coarser than the download period
+	if flags.resample != "" {
+		from, to := periodIndex(flags.period), periodIndex(flags.resample)
+		if from < 0 || to < 0 {
+			return fmt.Errorf("invalid resample period '%s'", flags.resample)
+		}
+		if to <= from {
+			return fmt.Errorf("resample period '%s' must be coarser than period '%s'", flags.resample, flags.period)
+		}
+	}
+
+	// validate formats
+	for _, format := range getFormats(flags.format) {
+		if format != "csv" && format != "json" && format != "hs" && format != "ami" && format != "arrow" && format != "png" {
+			return fmt.Errorf("invalid format '%s', must be either 'csv', 'json', 'hs', 'ami', 'arrow', 'png' or 'all'", format)
+		}
+		if format == "png" && flags.all {
+			return fmt.Errorf("png charts are one per symbol, not with -all")
+		}
+	}
+
+	if flags.epoch != "" && flags.epoch != "s" && flags.epoch != "ms" {
+		return fmt.Errorf("epoch must be s or ms")
+	}
+
+	// csv numbers must stay readable
+	if flags.fieldsep == "" || flags.fieldsep == flags.decimal {
+		return fmt.Errorf("csv field separator must be set and differ from the decimal separator")
+	}
+
+	// -since-file appends when it is also the -outfile, so that must be one csv file
+	if flags.sinceFile != "" && flags.sinceFile == flags.outfile && (flags.all || flags.format != "csv" || flags.indicators != "" || flags.resample != "") {
+		return fmt.Errorf("since-file can only be the outfile for a single csv file, not with -all, -format, -indicators or -resample")
+	}
+
+	// update appends to one csv file per symbol
+	if flags.update && (flags.all || flags.format != "csv" || flags.outfile != "") {
+		return fmt.Errorf("update only works with individual csv files, not with -all, -outfile or -format")
+	}
+
+	if flags.verify && flags.update {
+		return fmt.Errorf("verify doesn't work with -update")
+	}
+
+	if flags.limit < 0 {
+		return fmt.Errorf("limit can't be negative")
+	}
+
+	if flags.retries < 0 {
+		return fmt.Errorf("retries can't be negative")
+	}
+
+	// a partitioned -all output is a parquet dataset, one file per symbol
+	if flags.partition && (!flags.all || flags.chunk > 0) {
+		return fmt.Errorf("partition only works with -all, not with -chunk-symbols")
+	}
+
+	// only coinbase -all downloads run concurrently
+	if flags.workers < 1 || (flags.workers > 1 && (flags.source != "coinbase" || !flags.all)) {
+		return fmt.Errorf("workers must be at least 1, and more than 1 only works with -source=coinbase and -all")
+	}
+
+	// chunks split the single -all file
+	if flags.chunk < 0 || (flags.chunk > 0 && !flags.all) {
+		return fmt.Errorf("chunk-symbols must be a positive number of symbols and only works with -all")
+	}
+
+	// indicators are extra columns of individual csv files
+	if flags.indicators != "" {
+		if flags.all || flags.update {
+			return fmt.Errorf("indicators only work with individual csv files, not with -all or -update")
 		}
-		// check token
-		if flags.token == "" {
-			return fmt.Errorf("missing token for tiingo, must be passed or TIINGO_API_TOKEN must be set")
+		for _, name := range strings.Split(flags.indicators, ",") {
+			if _, err := quote.Indicator(strings.TrimSpace(name)); err != nil {
+				return err
+			}
 		}
 	}
 
-	if flags.source == "tiingo-crypto" &&
-		!(flags.period == "1m" ||
-			flags.period == "3m" ||
-			flags.period == "5m" ||
-			flags.period == "15m" ||
-			flags.period == "30m" ||
-			flags.period == "1h" ||
-			flags.period == "2h" ||
-			flags.period == "4h" ||
-			flags.period == "6h" ||
-			flags.period == "8h" ||
-			flags.period == "12h" ||
-			flags.period == "d") {
-		return fmt.Errorf("invalid source for tiingo-crypto, must be '1m', '3m', '5m', '15m', '30m', '1h', '2h', '4h', '6h', '8h', '12h', '1d', '3d', '1w', or '1M'")
+	// check token
+	if flags.source == "tiingo" && flags.token == "" {
+		return fmt.Errorf("missing token for tiingo, must be passed or TIINGO_API_TOKEN must be set")
 	}
 
 	if flags.source == "tiingo-crypto" && flags.token == "" {
 		return fmt.Errorf("missing token for tiingo-crypto, must be passed or TIINGO_API_TOKEN must be set")
 	}
 
+	if flags.source == "tiingo-fx" && flags.token == "" {
+		return fmt.Errorf("missing token for tiingo-fx, must be passed or TIINGO_API_TOKEN must be set")
+	}
+
+	if flags.source == "eodhd" && flags.token == "" {
+		return fmt.Errorf("missing token for eodhd, must be passed or EODHD_API_TOKEN must be set")
+	}
+
+	// only tiingo daily downloads rotate through a token list
+	switch flags.source {
+	case "tiingo-crypto", "tiingo-fx", "eodhd":
+		if strings.Contains(flags.token, ",") {
+			return fmt.Errorf("a comma separated token list only works with -source=tiingo, not %s", flags.source)
+		}
+	}
+
 	return nil
 }
 
@@ -153,13 +310,37 @@ func setOutput(flags quoteflags) error {
 	return err
 }
 
+func setTLS(flags quoteflags) error {
+	if flags.cacert != "" {
+		if err := quote.SetCABundle(flags.cacert); err != nil {
+			return err
+		}
+	}
+	if flags.insecure {
+		quote.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	}
+	return nil
+}
+
+// sources whose symbols are case-insensitive, so an infile is lowercased;
+// the rest (coinbase, kraken, ...) keep the case found in the file
+var lowerSymbols = map[string]bool{
+	"yahoo":  true,
+	"tiingo": true,
+	"eodhd":  true,
+}
+
 func getSymbols(flags quoteflags, args []string) ([]string, error) {
 
 	var err error
 	var symbols []string
 
 	if flags.infile != "" {
-		symbols, err = quote.NewSymbolsFromFile(flags.infile)
+		if lowerSymbols[flags.source] {
+			symbols, err = quote.NewSymbolsFromFile(flags.infile)
+		} else {
+			symbols, err = quote.NewSymbolsFromFileRaw(flags.infile)
+		}
 		if err != nil {
 			return symbols, err
 		}
@@ -180,6 +361,91 @@ func getSymbols(flags quoteflags, args []string) ([]string, error) {
 	return symbols, nil
 }
 
+// cli period names, in display order
+var periodFlags = []struct {
+	name   string
+	period quote.Period
+}{
+	{"1m", quote.Min1},
+	{"3m", quote.Min3},
+	{"5m", quote.Min5},
+	{"15m", quote.Min15},
+	{"30m", quote.Min30},
+	{"1h", quote.Min60},
+	{"2h", quote.Hour2},
+	{"4h", quote.Hour4},
+	{"6h", quote.Hour6},
+	{"8h", quote.Hour8},
+	{"12h", quote.Hour12},
+	{"d", quote.Daily},
+	{"3d", quote.Day3},
+	{"w", quote.Weekly},
+	{"m", quote.Monthly},
+	{"q", quote.Quarterly},
+	{"y", quote.Yearly},
+}
+
+// alternate names accepted for some periods
+var periodAliases = map[string]string{"1d": "d", "1w": "w", "1M": "m"}
+
+// position of a period flag in periodFlags, -1 if unknown
+func periodIndex(periodFlag string) int {
+	if name, ok := periodAliases[periodFlag]; ok {
+		periodFlag = name
+	}
+	for i, pf := range periodFlags {
+		if pf.name == periodFlag {
+			return i
+		}
+	}
+	return -1
+}
+
+// downloadPeriod - period to download from the source for period. Quarterly
+// and yearly bars are resampled from monthly, or else daily, bars when the
+// source has no native ones
+func downloadPeriod(source string, period quote.Period) quote.Period {
+	if (period != quote.Quarterly && period != quote.Yearly) || supportsPeriod(source, period) {
+		return period
+	}
+	if supportsPeriod(source, quote.Monthly) {
+		return quote.Monthly
+	}
+	return quote.Daily
+}
+
+// downloadLimit - bars to download for -limit, enough more when quarterly or
+// yearly bars are resampled from finer ones to leave -limit of them after
+func downloadLimit(flags quoteflags) int {
+	period := getPeriod(flags.period)
+	base := downloadPeriod(flags.source, period)
+	if flags.limit == 0 || base == period {
+		return flags.limit
+	}
+	t := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	per := int(quote.NextBarTime(t, period).Sub(t)/quote.NextBarTime(t, base).Sub(t)) + 1
+	return (flags.limit + 1) * per
+}
+
+func supportsPeriod(source string, period quote.Period) bool {
+	for _, p := range quote.SupportedPeriods(source) {
+		if p == period {
+			return true
+		}
+	}
+	return false
+}
+
+func periodNames(source string) string {
+	var names []string
+	for _, pf := range periodFlags {
+		if supportsPeriod(source, downloadPeriod(source, pf.period)) {
+			names = append(names, "'"+pf.name+"'")
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
 func getPeriod(periodFlag string) quote.Period {
 	period := quote.Daily
 	switch periodFlag {
@@ -219,6 +485,10 @@ func getPeriod(periodFlag string) quote.Period {
 		period = quote.Monthly
 	case "1M":
 		period = quote.Monthly
+	case "q":
+		period = quote.Quarterly
+	case "y":
+		period = quote.Yearly
 	}
 	return period
 }
@@ -227,7 +497,9 @@ func getTimes(flags quoteflags) (time.Time, time.Time) {
 	// determine start/end times
 	to := quote.ParseDateString(flags.end)
 	var from time.Time
-	if flags.start != "" {
+	if !flags.since.IsZero() {
+		from = flags.since
+	} else if flags.start != "" {
 		from = quote.ParseDateString(flags.start)
 	} else { // use years
 		from = to.Add(-time.Duration(int(time.Hour) * 24 * 365 * flags.years))
@@ -235,85 +507,574 @@ func getTimes(flags quoteflags) (time.Time, time.Time) {
 	return from, to
 }
 
+// start of the download, the bar after the last one in the -since-file file,
+// zero when the file doesn't exist yet or has no bars
+func sinceFile(flags quoteflags) (time.Time, error) {
+	return startAfter(flags.sinceFile, getPeriod(flags.period))
+}
+
+// the bar after the last one in a csv or json file, zero when the file
+// doesn't exist yet or has no bars
+func startAfter(filename string, period quote.Period) (time.Time, error) {
+	last, err := quote.LastFileDate(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil || last.IsZero() {
+		return time.Time{}, err
+	}
+	return quote.NextBarTime(last, period), nil
+}
+
 func outputAll(symbols []string, flags quoteflags) error {
 	// output all in one file
 	from, to := getTimes(flags)
-	period := getPeriod(flags.period)
+	period := downloadPeriod(flags.source, getPeriod(flags.period))
 	quotes := quote.Quotes{}
+	var errs map[string]error
 	var err error
 	if flags.source == "yahoo" {
-		quotes, err = quote.NewQuotesFromYahooSyms(symbols, from.Format(dateFormat), to.Format(dateFormat), period, flags.adjust)
+		quotes, errs, err = quote.NewQuotesFromYahooSymsWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), period, flags.adjust)
 	} else if flags.source == "tiingo" {
-		quotes, err = quote.NewQuotesFromTiingoSyms(symbols, from.Format(dateFormat), to.Format(dateFormat), flags.token)
+		quotes, errs, err = quote.NewQuotesFromTiingoPoolSymsWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), quote.NewTokenPool(flags.token))
 	} else if flags.source == "tiingo-crypto" {
-		quotes, err = quote.NewQuotesFromTiingoCryptoSyms(symbols, from.Format(dateFormat), to.Format(dateFormat), period, flags.token)
+		quotes, errs, err = quote.NewQuotesFromTiingoCryptoBatchWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), period, flags.token)
+	} else if flags.source == "tiingo-fx" {
+		quotes, errs, err = quote.NewQuotesFromTiingoFXSymsWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), period, flags.token)
+	} else if flags.source == "coinbase" && flags.workers > 1 {
+		quotes, errs, err = quote.NewQuotesFromCoinbaseSymsConcurrentWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), period, flags.workers)
 	} else if flags.source == "coinbase" {
-		quotes, err = quote.NewQuotesFromCoinbaseSyms(symbols, from.Format(dateFormat), to.Format(dateFormat), period)
+		quotes, errs, err = quote.NewQuotesFromCoinbaseSymsWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), period)
+	} else if flags.source == "coinbase-advanced" {
+		quotes, errs, err = quote.NewQuotesFromCoinbaseAdvancedSymsWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), period)
+	} else if flags.source == "deribit" {
+		quotes, errs, err = quote.NewQuotesFromDeribitSymsWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), period)
+	} else if flags.source == "gateio" {
+		quotes, errs, err = quote.NewQuotesFromGateIOSymsWithErrors(symbols, from, to, period)
+	} else if flags.source == "bybit" {
+		quotes, errs, err = quote.NewQuotesFromBybitSymsWithErrors(symbols, from, to, period)
+	} else if flags.source == "kraken" {
+		quotes, errs, err = quote.NewQuotesFromKrakenSymsWithErrors(symbols, from, to, period)
+	} else if flags.source == "mexc" {
+		quotes, errs, err = quote.NewQuotesFromMEXCSymsWithErrors(symbols, from, to, period)
+	} else if flags.source == "eodhd" {
+		quotes, errs, err = quote.NewQuotesFromEODHDSymsWithErrors(symbols, from.Format(dateFormat), to.Format(dateFormat), period, flags.token)
 	}
-	if err != nil {
+	if flags.notFound != "" {
+		if nfErr := writeNotFound(flags.notFound, errs); nfErr != nil {
+			return nfErr
+		}
+	}
+
+	// still write partial results when only some symbols failed
+	if err != nil && len(quotes) == 0 {
+		return err
+	}
+	downloadErr := err
+
+	if want := getPeriod(flags.period); want != period {
+		for i := range quotes {
+			quotes[i], err = quotes[i].Resample(want)
+			if err != nil {
+				return err
+			}
+			if flags.limit > 0 {
+				quotes[i] = quotes[i].Tail(flags.limit)
+			}
+		}
+	}
+
+	var resampled quote.Quotes
+	if flags.resample != "" {
+		resampled = make(quote.Quotes, len(quotes))
+		for i := range quotes {
+			resampled[i], err = quotes[i].Resample(getPeriod(flags.resample))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	formats := getFormats(flags.format)
+	if flags.partition {
+		dir := strings.TrimSuffix(flags.outfile, filepath.Ext(flags.outfile))
+		if dir == "" {
+			dir = "quotes"
+		}
+		err = writePartitioned(quotes, dir, flags.verify)
+		if err == nil && resampled != nil {
+			err = writePartitioned(resampled, dir+"_"+flags.resample, flags.verify)
+		}
+		if err != nil {
+			return err
+		}
+		return downloadErr
+	}
+	for _, format := range formats {
+		filename := formatName(flags.outfile, "quotes", format, formats)
+		err = writeChunks(quotes, filename, format, flags.chunk, flags.verify)
+		if err != nil {
+			return err
+		}
+		if resampled != nil {
+			if filename == "" {
+				filename = "quotes" + formatExt(format)
+			}
+			err = writeChunks(resampled, resampleName(filename, flags.resample), format, flags.chunk, flags.verify)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return downloadErr
+}
+
+func writeQuotes(quotes quote.Quotes, filename, format string) error {
+	var err error
+	if format == "csv" {
+		err = quotes.WriteCSV(filename)
+	} else if format == "json" {
+		err = quotes.WriteJSON(filename, false)
+	} else if format == "hs" {
+		err = quotes.WriteHighstock(filename)
+	} else if format == "ami" {
+		err = quotes.WriteAmibroker(filename)
+	} else if format == "arrow" {
+		err = quotes.WriteArrowIPC(filename)
+	}
+	return err
+}
+
+// write quotes as a parquet dataset under dir, logging that -verify can't check it
+func writePartitioned(quotes quote.Quotes, dir string, verify bool) error {
+	err := quotes.WriteParquetPartitioned(dir)
+	for i := 0; err == nil && verify && i < len(quotes); i++ {
+		err = verifyQuote(quotes[i], quote.PartitionFile(dir, quotes[i].Symbol), "parquet", quoteflags{})
+	}
+	return err
+}
+
+// write quotes in files of at most chunk symbols each, numbered from 1
+// (quotes_1.csv, quotes_2.csv), or in a single file when chunk is 0
+func writeChunks(quotes quote.Quotes, filename, format string, chunk int, verify bool) error {
+	if chunk <= 0 || len(quotes) <= chunk {
+		err := writeQuotes(quotes, filename, format)
+		if err == nil && verify {
+			err = verifyQuotes(quotes, filename, format)
+		}
 		return err
 	}
+	if filename == "" {
+		filename = "quotes" + formatExt(format)
+	}
+	for start := 0; start < len(quotes); start += chunk {
+		end := start + chunk
+		if end > len(quotes) {
+			end = len(quotes)
+		}
+		name := chunkName(filename, start/chunk+1)
+		err := writeQuotes(quotes[start:end], name, format)
+		if err == nil && verify {
+			err = verifyQuotes(quotes[start:end], name, format)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyQuotes - re-read an -all file and validate every quote in it.
+// Formats the library can't read back are logged and not checked
+func verifyQuotes(quotes quote.Quotes, filename, format string) error {
+	if filename == "" {
+		filename = "quotes" + formatExt(format)
+	}
+	var read quote.Quotes
+	var err error
+	switch format {
+	case "csv":
+		read, err = quote.NewQuotesFromCSVFile(filename)
+	case "json":
+		read, err = quote.NewQuotesFromJSONFile(filename)
+	default:
+		quote.Log.Printf("%s not verified, %s files with -all can't be read back\n", filename, format)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("verify %s: %v", filename, err)
+	}
+	wrote, got := 0, 0
+	for i := range quotes {
+		wrote += len(quotes[i].Close)
+	}
+	for _, q := range read {
+		got += len(q.Close)
+		if err := q.Validate(); err != nil {
+			return fmt.Errorf("verify %s: %v", filename, err)
+		}
+	}
+	if got != wrote {
+		return fmt.Errorf("verify %s: wrote %d bars, read back %d", filename, wrote, got)
+	}
+	return nil
+}
 
-	if flags.format == "csv" {
-		err = quotes.WriteCSV(flags.outfile)
-	} else if flags.format == "json" {
-		err = quotes.WriteJSON(flags.outfile, false)
-	} else if flags.format == "hs" {
-		err = quotes.WriteHighstock(flags.outfile)
-	} else if flags.format == "ami" {
-		err = quotes.WriteAmibroker(flags.outfile)
+// verifyQuote - re-read a symbol's file and validate it. Formats the library
+// can't read back, and csv files with -indicators columns, are logged and not checked
+func verifyQuote(q quote.Quote, filename, format string, flags quoteflags) error {
+	if filename == "" {
+		filename = q.Symbol + formatExt(format)
+	}
+	var read quote.Quote
+	var err error
+	switch {
+	case format == "csv" && flags.indicators == "":
+		read, err = quote.NewQuoteFromCSVFile(q.Symbol, filename)
+	case format == "json":
+		read, err = quote.NewQuoteFromJSONFile(filename)
+	case format == "ami":
+		read, err = quote.NewQuoteFromAmibrokerCSVFile(q.Symbol, filename)
+	case format == "csv":
+		quote.Log.Printf("%s not verified, csv with -indicators can't be read back\n", filename)
+		return nil
+	default:
+		quote.Log.Printf("%s not verified, %s files can't be read back\n", filename, format)
+		return nil
+	}
+	if err == nil {
+		err = read.Validate()
+	}
+	if err == nil && len(read.Close) != len(q.Close) {
+		err = fmt.Errorf("wrote %d bars, read back %d", len(q.Close), len(read.Close))
+	}
+	if err != nil {
+		return fmt.Errorf("verify %s: %v", filename, err)
+	}
+	return nil
+}
+
+// quotes.csv -> quotes_2.csv
+func chunkName(filename string, n int) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(filename, ext), n, ext)
+}
+
+func writeQuote(q quote.Quote, filename, format string) error {
+	var err error
+	if format == "csv" {
+		err = q.WriteCSV(filename)
+	} else if format == "json" {
+		err = q.WriteJSON(filename, false)
+	} else if format == "hs" {
+		err = q.WriteHighstock(filename)
+	} else if format == "ami" {
+		err = q.WriteAmibroker(filename)
+	} else if format == "arrow" {
+		err = q.WriteArrowIPC(filename)
+	} else if format == "png" {
+		err = q.WriteChartPNG(filename, chartWidth, chartHeight)
 	}
 	return err
 }
 
+// default file extension for an output format
+func formatExt(format string) string {
+	if format == "json" || format == "hs" {
+		return ".json"
+	}
+	if format == "arrow" {
+		return ".arrow"
+	}
+	if format == "png" {
+		return ".png"
+	}
+	return ".csv"
+}
+
+// split a comma separated -format list, "all" selects every format
+func getFormats(format string) []string {
+	if format == "all" {
+		return []string{"csv", "json", "hs", "ami", "arrow"}
+	}
+	var formats []string
+	for _, f := range strings.Split(format, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
+
+// output filename for one of the requested formats. A single format keeps
+// the filename as given (empty lets the writer pick its default). With several
+// the extension follows the format, and a format sharing an extension with an
+// earlier one gets the format name appended (spy.csv, spy_ami.csv)
+func formatName(filename, base, format string, formats []string) string {
+	if len(formats) < 2 {
+		return filename
+	}
+	if filename != "" {
+		base = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	ext := formatExt(format)
+	for _, other := range formats {
+		if other == format {
+			break
+		}
+		if formatExt(other) == ext {
+			return base + "_" + format + ext
+		}
+	}
+	return base + ext
+}
+
+// spy.csv -> spy_1h.csv
+func resampleName(filename, period string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "_" + period + ext
+}
+
+// download one symbol from the selected source
+func download(sym string, from, to time.Time, period quote.Period, pool *quote.TokenPool, flags quoteflags) (quote.Quote, error) {
+	if p := downloadPeriod(flags.source, period); p != period {
+		q, err := download(sym, from, to, p, pool, flags)
+		if err != nil {
+			return q, err
+		}
+		q, err = q.Resample(period)
+		if flags.limit > 0 {
+			q = q.Tail(flags.limit)
+		}
+		return q, err
+	}
+	source := quote.SourceSpec{Name: flags.source, Token: flags.token, Pool: pool, Adjust: flags.adjust}
+	return source.Download(sym, from, to, period)
+}
+
 func outputIndividual(symbols []string, flags quoteflags) error {
 	// output individual symbol files
 
 	from, to := getTimes(flags)
 	period := getPeriod(flags.period)
 
+	pool := quote.NewTokenPool(flags.token)
+	failed := 0
+	errs := map[string]error{}
 	for _, sym := range symbols {
-		var q quote.Quote
-		if flags.source == "yahoo" {
-			q, _ = quote.NewQuoteFromYahoo(sym, from.Format(dateFormat), to.Format(dateFormat), period, flags.adjust)
-		} else if flags.source == "tiingo" {
-			q, _ = quote.NewQuoteFromTiingo(sym, from.Format(dateFormat), to.Format(dateFormat), flags.token)
-		} else if flags.source == "tiingo-crypto" {
-			q, _ = quote.NewQuoteFromTiingoCrypto(sym, from.Format(dateFormat), to.Format(dateFormat), period, flags.token)
-		} else if flags.source == "coinbase" {
-			q, _ = quote.NewQuoteFromCoinbase(sym, from.Format(dateFormat), to.Format(dateFormat), period)
-		}
-		var err error
-		if flags.format == "csv" {
-			err = q.WriteCSV(flags.outfile)
-		} else if flags.format == "json" {
-			err = q.WriteJSON(flags.outfile, false)
-		} else if flags.format == "hs" {
-			err = q.WriteHighstock(flags.outfile)
-		} else if flags.format == "ami" {
-			err = q.WriteAmibroker(flags.outfile)
+		q, err := download(sym, from, to, period, pool, flags)
+		for try := 0; try < flags.retries && err != nil && !errors.Is(err, quote.ErrSymbolNotFound); try++ {
+			quote.SleepDelay()
+			q, err = download(sym, from, to, period, pool, flags)
 		}
+		if err != nil {
+			fmt.Printf("Error downloading %s: %v\n", sym, err)
+			errs[sym] = err
+			failed++
+			quote.SleepDelay()
+			continue
+		}
+		err = writeFormats(q, flags)
 		if err != nil {
 			fmt.Printf("Error writing file: %v\n", err)
+			failed++
+		}
+		quote.SleepDelay()
+	}
+	if flags.notFound != "" {
+		if err := writeNotFound(flags.notFound, errs); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d symbols failed", failed, len(symbols))
+	}
+	return nil
+}
+
+// write the symbols the source didn't know, one per line, so watchlists can
+// be reconciled. The file is written even when every symbol was found
+func writeNotFound(filename string, errs map[string]error) error {
+	var lines string
+	for _, symbol := range quote.NotFound(errs) {
+		lines += symbol + "\n"
+	}
+	return os.WriteFile(filename, []byte(lines), 0644)
+}
+
+// append new bars to existing csv files, named after their symbol (spy.csv),
+// starting from the bar after each file's last date. Files that are already
+// up to date aren't downloaded at all.
+func outputUpdate(files []string, flags quoteflags) error {
+
+	pool := quote.NewTokenPool(flags.token)
+	failed := 0
+	for i, filename := range files {
+		if i > 0 {
+			quote.SleepDelay()
+		}
+		sym := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+		if err := updateFile(sym, filename, pool, flags); err != nil {
+			fmt.Printf("Error updating %s: %v\n", filename, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return nil
+}
+
+// append the bars of sym after the last one in a csv file, which is created
+// when it doesn't exist yet, making no requests when it is already current
+func updateFile(sym, filename string, pool *quote.TokenPool, flags quoteflags) error {
+	from, to := getTimes(flags)
+	period := getPeriod(flags.period)
+	start, err := startAfter(filename, period)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		start = from
+	}
+	if start.After(to) {
+		quote.Log.Printf("%s is up to date, nothing to download\n", filename)
+		return nil
+	}
+	q, err := download(sym, start, to, period, pool, flags)
+	if err != nil {
+		return err
+	}
+	return q.AppendCSV(filename)
+}
+
+// write a quote in each requested format, plus any resampled copies
+func writeFormats(q quote.Quote, flags quoteflags) error {
+	var rq quote.Quote
+	var err error
+	if flags.resample != "" {
+		rq, err = q.Resample(getPeriod(flags.resample))
+		if err != nil {
+			return err
+		}
+	}
+	formats := getFormats(flags.format)
+	for _, format := range formats {
+		filename := formatName(flags.outfile, q.Symbol, format, formats)
+		err = writeIndicators(q, filename, format, flags)
+		if err == nil && flags.verify {
+			err = verifyQuote(q, filename, format, flags)
+		}
+		if err != nil {
+			return err
+		}
+		if flags.resample != "" {
+			if filename == "" {
+				filename = q.Symbol + formatExt(format)
+			}
+			err = writeIndicators(rq, resampleName(filename, flags.resample), format, flags)
+			if err == nil && flags.verify {
+				err = verifyQuote(rq, resampleName(filename, flags.resample), format, flags)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeIndicators - csv with the -indicators columns after the bars, other
+// formats as usual
+func writeIndicators(q quote.Quote, filename, format string, flags quoteflags) error {
+	if format != "csv" || flags.indicators == "" {
+		return writeQuote(q, filename, format)
+	}
+	cols := []string{"datetime", "open", "high", "low", "close", "volume"}
+	for _, name := range strings.Split(flags.indicators, ",") {
+		cols = append(cols, strings.TrimSpace(name))
+	}
+	return q.WriteCSVColumns(filename, cols)
+}
+
+// checkSource - one cheap request to the source, for tiingo once per token
+// in the list, so a bad token or outage stops the run before it starts
+func checkSource(flags quoteflags) error {
+	tokens := []string{flags.token}
+	if flags.source == "tiingo" {
+		tokens = strings.Split(flags.token, ",")
+	}
+	for _, token := range tokens {
+		if err := quote.CheckSource(flags.source, strings.TrimSpace(token)); err != nil {
+			return err
 		}
-		time.Sleep(quote.Delay * time.Millisecond)
 	}
+	fmt.Printf("%s ok\n", flags.source)
 	return nil
 }
 
-func handleCommand(cmd string, flags quoteflags) bool {
+func handleCommand(cmd string, flags quoteflags) (bool, error) {
 
 	// handle market special commands
 	if !quote.ValidMarket(cmd) {
-		return false
+		return false, nil
 	}
+	var err error
 	switch cmd {
 	case "etf":
-		quote.NewEtfFile(flags.outfile)
+		err = quote.NewEtfFile(flags.outfile)
 	default:
-		quote.NewMarketFile(cmd, flags.outfile)
+		err = quote.NewMarketFileWithMeta(cmd, flags.outfile)
+	}
+	return true, err
+}
+
+// envFileArg - value of the -env-file flag in args, found ahead of flag.Parse
+func envFileArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if value, ok := strings.CutPrefix(name, "env-file="); ok {
+			return value
+		}
+		if name == "env-file" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// loadEnvFile - set the KEY=VALUE lines of a dotenv file in the environment,
+// skipping blank lines, # comments and variables that are already set.
+// Values may be quoted and lines may start with export
+func loadEnvFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "export "))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", filename, n+1)
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
 	}
-	return true
+	return nil
 }
 
 func main() {
@@ -322,29 +1083,81 @@ func main() {
 	var symbols []string
 	var flags quoteflags
 
+	// before the flags are defined, so their environment defaults see the file
+	if filename := envFileArg(os.Args[1:]); filename != "" {
+		err = loadEnvFile(filename)
+		check(err)
+	}
+
+	flag.StringVar(&flags.envFile, "env-file", "", "load KEY=VALUE lines into the environment")
 	flag.IntVar(&flags.years, "years", 5, "number of years to download")
 	flag.IntVar(&flags.delay, "delay", 100, "milliseconds to delay between requests")
+	flag.IntVar(&flags.workers, "workers", 1, "concurrent coinbase downloads with -all")
+	flag.IntVar(&flags.limit, "limit", 0, "keep only the last n bars of each symbol")
+	flag.IntVar(&flags.retries, "retries", 0, "times to download a failed symbol again")
+	flag.StringVar(&flags.notFound, "notfound-file", "", "write symbols the source doesn't know to this file")
+	flag.IntVar(&flags.chunk, "chunk-symbols", 0, "split -all output into files of at most this many symbols")
+	flag.IntVar(&flags.jitter, "jitter", 0, "milliseconds to randomly vary each delay by")
 	flag.StringVar(&flags.start, "start", "", "start date (yyyy[-mm[-dd]])")
 	flag.StringVar(&flags.end, "end", "", "end date (yyyy[-mm[-dd]])")
+	flag.StringVar(&flags.sinceFile, "since-file", "", "start after the last bar in this csv or json file")
 	flag.StringVar(&flags.period, "period", "d", "1m|5m|15m|30m|1h|d")
-	flag.StringVar(&flags.source, "source", "yahoo", "yahoo|tiingo|coinbase")
+	flag.StringVar(&flags.source, "source", "yahoo", "yahoo|tiingo|tiingo-crypto|tiingo-fx|coinbase|coinbase-advanced|deribit|gateio|bybit|kraken|mexc|eodhd")
 	flag.StringVar(&flags.token, "token", os.Getenv("TIINGO_API_TOKEN"), "tiingo api token")
 	flag.StringVar(&flags.infile, "infile", "", "input filename")
 	flag.StringVar(&flags.outfile, "outfile", "", "output filename")
-	flag.StringVar(&flags.format, "format", "csv", "csv|json")
+	flag.StringVar(&flags.format, "format", "csv", "csv|json|hs|ami|arrow|png|all, or comma separated list")
+	flag.StringVar(&flags.indicators, "indicators", "", "comma separated indicator columns for csv output, e.g. sma20,rsi14")
+	flag.StringVar(&flags.resample, "resample", "", "also write data resampled to a coarser period")
 	flag.StringVar(&flags.log, "log", "stdout", "<filename>|stdout")
+	flag.StringVar(&flags.cacert, "cacert", os.Getenv("QUOTE_CA_BUNDLE"), "extra CA certificates (PEM)")
+	flag.BoolVar(&flags.insecure, "insecure", false, "skip TLS certificate verification")
+	flag.BoolVar(&flags.verify, "verify", false, "re-read and validate each file after writing it")
+	flag.BoolVar(&flags.partition, "partition", false, "with -all, write a parquet dataset with one file per symbol")
+	flag.BoolVar(&flags.check, "check", false, "check the source is reachable and the token works before downloading")
+	flag.BoolVar(&flags.verbose, "verbose", false, "log request urls, status, bar counts and timing")
 	flag.BoolVar(&flags.all, "all", false, "all output in one file")
+	flag.BoolVar(&flags.update, "update", false, "append new bars to existing csv files")
 	flag.BoolVar(&flags.adjust, "adjust", true, "adjust Yahoo prices")
+	flag.BoolVar(&flags.dateonly, "dateonly", false, "omit the time from daily csv dates")
+	flag.StringVar(&flags.epoch, "epoch", "", "write csv dates as unix timestamps in s or ms")
+	flag.StringVar(&flags.fieldsep, "separator", ",", "csv field separator")
+	flag.StringVar(&flags.decimal, "decimal", ".", "csv decimal separator")
 	flag.BoolVar(&flags.version, "v", false, "show version")
 	flag.BoolVar(&flags.version, "version", false, "show version")
+	flag.BoolVar(&flags.markets, "list-markets", false, "list valid markets")
 	flag.Parse()
 
+	// eodhd has its own token, unless one is passed
+	if flags.source == "eodhd" && !flagPassed("token") {
+		flags.token = os.Getenv("EODHD_API_TOKEN")
+	}
+
 	if flags.version {
 		fmt.Println(version)
 		os.Exit(0)
 	}
 
+	if flags.markets {
+		for _, market := range quote.Markets() {
+			if strings.HasPrefix(market, "tiingo") {
+				fmt.Println(market + " (requires TIINGO_API_TOKEN)")
+			} else {
+				fmt.Println(market)
+			}
+		}
+		os.Exit(0)
+	}
+
 	quote.Delay = time.Duration(flags.delay)
+	quote.DelayJitter = time.Duration(flags.jitter)
+	quote.DateOnly = flags.dateonly
+	quote.CSVEpoch = flags.epoch
+	quote.FieldSeparator = flags.fieldsep
+	quote.DecimalSeparator = flags.decimal
+	quote.Verbose = flags.verbose
+	quote.Retries = flags.retries
+	quote.Limit = downloadLimit(flags)
 
 	err = setOutput(flags)
 	check(err)
@@ -352,18 +1165,54 @@ func main() {
 	err = checkFlags(flags)
 	check(err)
 
+	err = setTLS(flags)
+	check(err)
+
+	if flags.check {
+		err = checkSource(flags)
+		check(err)
+		if len(flag.Args()) == 0 && flags.infile == "" {
+			os.Exit(0)
+		}
+	}
+
 	symbols, err = getSymbols(flags, flag.Args())
 	check(err)
 
+	// -since-file and -outfile the same csv file appends to it, like -update
+	if flags.sinceFile != "" && flags.sinceFile == flags.outfile {
+		err = updateFile(symbols[0], flags.outfile, quote.NewTokenPool(flags.token), flags)
+		check(err)
+		os.Exit(0)
+	}
+
+	if flags.sinceFile != "" {
+		flags.since, err = sinceFile(flags)
+		check(err)
+		if _, to := getTimes(flags); flags.since.After(to) {
+			quote.Log.Printf("%s is up to date, nothing to download\n", flags.sinceFile)
+			os.Exit(0)
+		}
+	}
+
+	if flags.update {
+		err = outputUpdate(symbols, flags)
+		check(err)
+		os.Exit(0)
+	}
+
 	// check for and handled special commands
-	if handleCommand(symbols[0], flags) {
+	handled, err := handleCommand(symbols[0], flags)
+	check(err)
+	if handled {
 		os.Exit(0)
 	}
 
 	// main output
 	if flags.all {
-		outputAll(symbols, flags)
+		err = outputAll(symbols, flags)
 	} else {
-		outputIndividual(symbols, flags)
+		err = outputIndividual(symbols, flags)
 	}
+	check(err)
 }
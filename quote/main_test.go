@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/markcheno/go-quote"
+)
+
+func TestVerifySeparators(t *testing.T) {
+	defer func(field, decimal string) { quote.FieldSeparator, quote.DecimalSeparator = field, decimal }(quote.FieldSeparator, quote.DecimalSeparator)
+	quote.FieldSeparator, quote.DecimalSeparator = ";", ","
+	var log strings.Builder
+	defer quote.Log.SetOutput(quote.Log.Writer())
+	quote.Log.SetOutput(&log)
+
+	q := quote.NewQuote("spy", 3)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2024, 1, 2+bar, 0, 0, 0, 0, time.UTC)
+		q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar], q.Volume[bar] = 10.5, 14.25, 9.75, float64(11+bar)+0.5, 1000
+	}
+
+	dir := t.TempDir()
+	flags := quoteflags{format: "all", outfile: filepath.Join(dir, "spy.csv"), verify: true}
+	if err := writeFormats(q, flags); err != nil {
+		t.Fatalf("verify with ';' and ',' separators: %v", err)
+	}
+	flags.outfile = filepath.Join(dir, "quotes.csv")
+	qqq := q
+	qqq.Symbol = "qqq"
+	for _, format := range getFormats("all") {
+		if err := writeChunks(quote.Quotes{q, qqq}, formatName(flags.outfile, "quotes", format, getFormats("all")), format, 0, true); err != nil {
+			t.Fatalf("verify -all %s: %v", format, err)
+		}
+	}
+
+	for _, name := range []string{"spy_hs.json", "spy.arrow", "quotes_hs.json", "quotes_ami.csv", "quotes.arrow"} {
+		if !strings.Contains(log.String(), name+" not verified") {
+			t.Errorf("expected %s to be logged as not verified: %q", name, log.String())
+		}
+	}
+	if strings.Contains(log.String(), "spy_ami.csv not verified") {
+		t.Errorf("spy_ami.csv should be verified: %q", log.String())
+	}
+}
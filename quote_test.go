@@ -1,11 +1,27 @@
 package quote
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // assert fails the test if the condition is false.
@@ -85,16 +101,2288 @@ aapl,2018-07-20 00:00,191.78,192.43,190.17,188.57,20676200.00`
 	if len(q) != 2 {
 		t.Error("Invalid length")
 	}
-	if q[0].Symbol != "spy" {
+	if q[0].Symbol != "aapl" {
 		t.Error("Invalid symbol")
 	}
-	if q[0].Close[len(q[0].Close)-1] != 274.26 {
+	if q[0].Close[len(q[0].Close)-1] != 188.57 {
 		t.Error("Invalid last value")
 	}
-	if q[1].Symbol != "aapl" {
+	if q[1].Symbol != "spy" {
 		t.Error("Invalid symbol")
 	}
-	if q[1].Close[len(q[1].Close)-1] != 188.57 {
+	if q[1].Close[len(q[1].Close)-1] != 274.26 {
 		t.Error("Invalid last value")
 	}
 }
+
+func TestSortQuotes(t *testing.T) {
+	day := func(d int) []time.Time { return []time.Time{time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)} }
+	q := Quotes{
+		{Symbol: "spy", Date: day(3)},
+		{Symbol: "empty"},
+		{Symbol: "aapl", Date: day(5)},
+		{Symbol: "qqq", Date: day(1)},
+	}
+	symbols := func() string {
+		var s []string
+		for _, quote := range q {
+			s = append(s, quote.Symbol)
+		}
+		return strings.Join(s, ",")
+	}
+
+	q.SortByFirstDate()
+	equals(t, "qqq,spy,aapl,empty", symbols())
+	q.SortBySymbol()
+	equals(t, "aapl,empty,qqq,spy", symbols())
+
+	// same input always gives the same order
+	csv := "symbol,datetime,open,high,low,close,volume\nspy,2024-01-02,1,1,1,1,1\nqqq,2024-01-02,1,1,1,1,1\naapl,2024-01-02,1,1,1,1,1\n"
+	for i := 0; i < 20; i++ {
+		q, _ = NewQuotesFromCSV(csv)
+		equals(t, "aapl,qqq,spy", symbols())
+	}
+}
+
+func TestNormalizeSymbol(t *testing.T) {
+	equals(t, "BRK-B", NormalizeSymbol("yahoo", "BRK.B"))
+	equals(t, "VOD.L", NormalizeSymbol("yahoo", "VOD.L"))
+	equals(t, "BTC-USD", NormalizeSymbol("yahoo", "BTC/USD"))
+	equals(t, "brk-b", NormalizeSymbol("tiingo", "brk.b"))
+	equals(t, "btcusd", NormalizeSymbol("tiingo-crypto", "BTC/USD"))
+	equals(t, "BTC-USD", NormalizeSymbol("coinbase", "btc/usd"))
+	equals(t, "BTC-USD", NormalizeSymbol("coinbase", NormalizeSymbol("coinbase", "BTC/USD")))
+}
+
+func TestQuotesHighstock(t *testing.T) {
+	spy := NewQuote("spy", 2)
+	spy.Date[0] = time.Date(2018, 7, 12, 0, 0, 0, 0, time.UTC)
+	spy.Date[1] = time.Date(2018, 7, 13, 0, 0, 0, 0, time.UTC)
+	spy.Close[0], spy.Close[1] = 273.95, 274.17
+	empty := NewQuote("aapl", 0)
+
+	for _, q := range []Quotes{{spy, empty}, {empty, spy}, {empty}, {}} {
+		hs := q.Highstock()
+		assert(t, json.Valid([]byte(hs)), "invalid json: %s", hs)
+		var data map[string][][]float64
+		ok(t, json.Unmarshal([]byte(hs), &data))
+		equals(t, len(q), len(data))
+	}
+}
+
+func TestLocation(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+
+	// same data must land on the same timestamps regardless of the machine TZ
+	for _, tz := range []*time.Location{time.UTC, time.FixedZone("EST", -5*3600), time.FixedZone("JST", 9*3600)} {
+		time.Local = tz
+		equals(t, "2018-07-12 00:00", unixTime(1531353600).Format("2006-01-02 15:04"))
+		q, err := NewQuoteFromCSV("spy", "datetime,open,high,low,close,volume\n2018-07-12 00:00,1,1,1,1,1")
+		ok(t, err)
+		equals(t, time.Date(2018, 7, 12, 0, 0, 0, 0, time.UTC), q.Date[0])
+	}
+
+	loc := Location
+	defer func() { Location = loc }()
+	Location = time.FixedZone("EST", -5*3600)
+	equals(t, "2018-07-11 19:00", unixTime(1531353600).Format("2006-01-02 15:04"))
+}
+
+func TestRollingVWAP(t *testing.T) {
+	q := NewQuote("spy", 4)
+	for bar, px := range []float64{10, 20, 30, 40} {
+		q.High[bar], q.Low[bar], q.Close[bar] = px, px, px
+	}
+	q.Volume[0], q.Volume[1] = 1, 3
+	vwap := q.RollingVWAP(2)
+	assert(t, math.IsNaN(vwap[0]), "expected NaN during warmup, got %v", vwap[0])
+	equals(t, 17.5, vwap[1])
+	equals(t, 20.0, vwap[2])
+	equals(t, 20.0, vwap[3]) // no volume in window, carried forward
+}
+
+func TestFillMissing(t *testing.T) {
+	q := NewQuote("spy", 2)
+	q.Date[0] = time.Date(2018, 7, 12, 0, 0, 0, 0, time.UTC)
+	q.Date[1] = time.Date(2018, 7, 15, 0, 0, 0, 0, time.UTC)
+	q.Close[0], q.Close[1] = 10, 40
+
+	ffill := q.FillMissing(Daily, "ffill")
+	equals(t, 4, len(ffill.Close))
+	equals(t, []float64{10, 10, 10, 40}, ffill.Close)
+	equals(t, time.Date(2018, 7, 13, 0, 0, 0, 0, time.UTC), ffill.Date[1])
+
+	linear := q.FillMissing(Daily, "linear")
+	equals(t, []float64{10, 20, 30, 40}, linear.Close)
+	equals(t, 0.0, linear.Volume[2])
+}
+
+func TestAppendCSV(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "spy.csv")
+	q := NewQuote("spy", 3)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2018, 7, 12+bar, 0, 0, 0, 0, time.UTC)
+		q.Close[bar] = float64(bar + 1)
+	}
+
+	head := NewQuote("spy", 2)
+	copy(head.Date, q.Date)
+	copy(head.Close, q.Close)
+	ok(t, head.AppendCSV(filename))
+	ok(t, q.AppendCSV(filename)) // only the third bar is new
+	ok(t, q.AppendCSV(filename)) // nothing new
+
+	csv, err := os.ReadFile(filename)
+	ok(t, err)
+	equals(t, q.CSV(), string(csv))
+}
+
+func TestDateOnly(t *testing.T) {
+	defer func() { DateOnly = false }()
+	DateOnly = true
+
+	q := NewQuote("spy", 1)
+	q.Date[0] = time.Date(2018, 7, 12, 0, 0, 0, 0, time.UTC)
+	csv := q.CSV()
+	equals(t, "datetime,open,high,low,close,volume\n2018-07-12,0.00,0.00,0.00,0.00,0.00\n", csv)
+	rt, err := NewQuoteFromCSV("spy", csv)
+	ok(t, err)
+	equals(t, q.Date[0], rt.Date[0])
+
+	q.Date[0] = time.Date(2018, 7, 12, 9, 30, 0, 0, time.UTC)
+	assert(t, !q.IsDaily(), "intraday quote reported as daily")
+	assert(t, strings.Contains(q.CSV(), "2018-07-12 09:30"), "intraday time dropped")
+}
+
+func TestOutputUTC(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+
+	// the same instants parsed on machines in different time zones
+	var out []string
+	for _, tz := range []*time.Location{time.FixedZone("EST", -5*3600), time.FixedZone("JST", 9*3600)} {
+		time.Local = tz
+		q := NewQuote("spy", 2)
+		q.Date[0] = time.Unix(1531353600, 0)
+		q.Date[1] = time.Unix(1531440000, 0)
+		out = append(out, q.CSV()+q.Amibroker()+q.JSON(false))
+	}
+	equals(t, out[0], out[1])
+	assert(t, strings.Contains(out[0], "2018-07-12 00:00"), "expected UTC timestamps, got %s", out[0])
+}
+
+func TestDownsample(t *testing.T) {
+	q := NewQuote("spy", 7)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2024, 1, 1+bar, 0, 0, 0, 0, time.UTC)
+		q.Open[bar], q.High[bar], q.Low[bar] = float64(1+bar), float64(10+bar), float64(bar)
+		q.Close[bar], q.Volume[bar] = float64(100+bar), 1
+	}
+	q.Low[3] = -1
+
+	// 7 bars into 3 buckets of 2, 2 and 3 bars
+	ds := q.Downsample(3)
+	equals(t, "spy", ds.Symbol)
+	equals(t, []time.Time{q.Date[0], q.Date[2], q.Date[4]}, ds.Date)
+	equals(t, []float64{1, 3, 5}, ds.Open)
+	equals(t, []float64{11, 13, 16}, ds.High)
+	equals(t, []float64{0, -1, 4}, ds.Low)
+	equals(t, []float64{101, 103, 106}, ds.Close)
+	equals(t, []float64{2, 2, 3}, ds.Volume)
+
+	equals(t, q.Close, q.Downsample(7).Close)
+	equals(t, q.Close, q.Downsample(0).Close)
+	equals(t, []float64{106}, q.Downsample(1).Close)
+	equals(t, []float64{7}, q.Downsample(1).Volume)
+}
+
+func TestResample(t *testing.T) {
+	q := NewQuote("spy", 4)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2018, 7, 12, 9, 30+bar*15, 0, 0, time.UTC)
+		q.Open[bar] = float64(10 + bar)
+		q.High[bar] = float64(20 + bar%2)
+		q.Low[bar] = float64(5 - bar)
+		q.Close[bar] = float64(15 + bar)
+		q.Volume[bar] = 100
+	}
+	h, err := q.Resample(Min60)
+	ok(t, err)
+	equals(t, []time.Time{time.Date(2018, 7, 12, 9, 0, 0, 0, time.UTC), time.Date(2018, 7, 12, 10, 0, 0, 0, time.UTC)}, h.Date)
+	equals(t, []float64{10, 12}, h.Open)
+	equals(t, []float64{21, 21}, h.High)
+	equals(t, []float64{4, 2}, h.Low)
+	equals(t, []float64{16, 18}, h.Close)
+	equals(t, []float64{200, 200}, h.Volume)
+
+	w, err := q.Resample(Weekly)
+	ok(t, err)
+	equals(t, []time.Time{time.Date(2018, 7, 9, 0, 0, 0, 0, time.UTC)}, w.Date)
+}
+
+func TestHighstockOHLCV(t *testing.T) {
+	q := NewQuote("spy", 2)
+	q.Date[0] = time.Date(2018, 7, 12, 0, 0, 0, 0, time.UTC)
+	q.Date[1] = time.Date(2018, 7, 13, 0, 0, 0, 0, time.UTC)
+	q.Volume[1] = 100
+
+	var data struct {
+		OHLC   [][]float64 `json:"ohlc"`
+		Volume [][]float64 `json:"volume"`
+	}
+	ok(t, json.Unmarshal([]byte(q.HighstockOHLCV()), &data))
+	equals(t, 2, len(data.OHLC))
+	equals(t, 5, len(data.OHLC[0]))
+	equals(t, []float64{1531440000000, 100}, data.Volume[1])
+	ok(t, json.Unmarshal([]byte(NewQuote("spy", 0).HighstockOHLCV()), &data))
+}
+
+func TestVolumeProfile(t *testing.T) {
+	q := NewQuote("spy", 2)
+	q.Low[0], q.High[0], q.Volume[0] = 10, 20, 100
+	q.Low[1], q.High[1], q.Volume[1] = 15, 15, 50
+	levels, volumes := q.VolumeProfile(2)
+	equals(t, []float64{12.5, 17.5}, levels)
+	equals(t, []float64{50, 100}, volumes)
+}
+
+func TestTiingoCryptoQuote(t *testing.T) {
+	body := `[{"ticker":"btcusd","priceData":[{"date":"2019-01-02T00:00:00Z","open":1,"high":2,"low":0.5,"close":1.5,"volume":10}]},
+	{"ticker":"ethusd","priceData":[{"date":"2019-01-02T00:00:00Z","open":3,"high":4,"low":2.5,"close":3.5,"volume":20},
+	{"date":"2019-01-03T00:00:00Z","open":3.5,"high":4.5,"low":3,"close":4,"volume":30}]}]`
+
+	var crypto []tiingoCryptoData
+	ok(t, json.Unmarshal([]byte(body), &crypto))
+	equals(t, 2, len(crypto))
+
+	eth := tiingoCryptoQuote(crypto[1].Ticker, crypto[1])
+	equals(t, "ethusd", eth.Symbol)
+	equals(t, 2, len(eth.Close))
+	equals(t, 4.0, eth.Close[1])
+	equals(t, 30.0, eth.Volume[1])
+}
+
+func TestAccessors(t *testing.T) {
+	q := NewQuote("test", 2)
+	q.Close[0], q.Close[1] = 1, 2
+
+	q.Closes()[0] = 5
+	equals(t, 5.0, q.Close[0])
+
+	c := q.CloseColumn()
+	c[1] = 9
+	equals(t, 2.0, q.Close[1])
+	equals(t, []float64{5, 9}, c)
+
+	old := q.ClosesCopy()
+	old[0] = 7
+	equals(t, 5.0, q.Close[0])
+	equals(t, q.Date, q.DatesCopy())
+}
+
+func TestCSVWindowsLineEndings(t *testing.T) {
+	csv := "\ufeffdatetime,open,high,low,close,volume\r\n" +
+		"2018-07-12,278.28,279.43,277.60,273.95,60124700.00\r\n" +
+		"2018-07-13,279.17,279.93,278.66,274.17,48216000.00\r\n"
+	q, err := NewQuoteFromCSV("spy", csv)
+	ok(t, err)
+	equals(t, time.Date(2018, 7, 12, 0, 0, 0, 0, time.UTC), q.Date[0])
+	equals(t, 48216000.0, q.Volume[1])
+
+	csv = "\ufeffsymbol,datetime,open,high,low,close,volume\r\n" +
+		"spy,2018-07-12,278.28,279.43,277.60,273.95,60124700.00\r\n" +
+		"aapl,2018-07-12,189.53,191.41,189.31,188.17,18041100.00\r\n" +
+		"spy,2018-07-13,279.17,279.93,278.66,274.17,48216000.00\r\n"
+	qs, err := NewQuotesFromCSV(csv)
+	ok(t, err)
+	equals(t, 2, len(qs))
+	equals(t, "spy", qs[1].Symbol)
+	equals(t, []float64{60124700, 48216000}, qs[1].Volume)
+	equals(t, 18041100.0, qs[0].Volume[0])
+}
+
+func TestBarsFromTrades(t *testing.T) {
+	base := time.Date(2021, 3, 1, 9, 30, 0, 0, time.UTC)
+	ts := []time.Time{
+		base.Add(2 * time.Minute), // out of order
+		base,
+		base.Add(30 * time.Second),
+		base.Add(90 * time.Second),
+	}
+	price := []float64{12, 10, 11, 9}
+	size := []float64{5, 1, 2, 3}
+
+	q := BarsFromTrades("btcusd", ts, price, size, Min1)
+	equals(t, []time.Time{base, base.Add(time.Minute), base.Add(2 * time.Minute)}, q.Date)
+	equals(t, []float64{10, 9, 12}, q.Open)
+	equals(t, []float64{11, 9, 12}, q.High)
+	equals(t, []float64{10, 9, 12}, q.Low)
+	equals(t, []float64{11, 9, 12}, q.Close)
+	equals(t, []float64{3, 3, 5}, q.Volume)
+}
+
+func TestBetweenHours(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tz database")
+	}
+	q := NewQuote("spy", 4)
+	q.Date[0] = time.Date(2021, 3, 5, 9, 0, 0, 0, ny)  // pre-market, Friday
+	q.Date[1] = time.Date(2021, 3, 5, 9, 30, 0, 0, ny) // open
+	q.Date[2] = time.Date(2021, 3, 5, 16, 0, 0, 0, ny) // after close
+	q.Date[3] = time.Date(2021, 3, 6, 10, 0, 0, 0, ny) // Saturday
+	for bar := range q.Close {
+		q.Close[bar] = float64(bar)
+	}
+
+	session := q.BetweenHours("09:30", "16:00", ny)
+	equals(t, []float64{1, 3}, session.Close)
+
+	weekdays := q.Weekdays()
+	equals(t, []float64{0, 1, 2}, weekdays.Close)
+
+	equals(t, 0, len(q.BetweenHours("9.30", "16:00", ny).Close))
+}
+
+func TestVerboseTransport(t *testing.T) {
+	var buf strings.Builder
+	defer Log.SetOutput(Log.Writer())
+	Log.SetOutput(&buf)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+
+	Verbose = true
+	defer func() { Verbose = false }()
+
+	resp, err := newClient().Get(srv.URL + "/candles")
+	ok(t, err)
+	resp.Body.Close()
+	assert(t, strings.Contains(buf.String(), srv.URL+"/candles: 418"), "missing request log: %q", buf.String())
+
+	resp, err = newClient().Get(srv.URL + "/api/eod/AAPL.US?fmt=json&api_token=secret")
+	ok(t, err)
+	resp.Body.Close()
+	assert(t, !strings.Contains(buf.String(), "secret"), "api token logged: %q", buf.String())
+	assert(t, strings.Contains(buf.String(), "api_token=REDACTED"), "missing redacted request log: %q", buf.String())
+}
+
+func TestParseGateIOCandles(t *testing.T) {
+	body := `[["1700000000","1500.5","36010.2","36050","35990.1","36000","0.0417","true"],
+	["1700000060","250","36020","36030","36005","36010.2","0.0069","true"]]`
+	q, err := parseGateIOCandles("BTC_USDT", []byte(body))
+	ok(t, err)
+	equals(t, 2, len(q.Close))
+	equals(t, time.Unix(1700000060, 0).UTC(), q.Date[1])
+	equals(t, 36000.0, q.Open[0])
+	equals(t, 36050.0, q.High[0])
+	equals(t, 35990.1, q.Low[0])
+	equals(t, 36010.2, q.Close[0])
+	equals(t, []float64{0.0417, 0.0069}, q.Volume)
+
+	_, err = parseGateIOCandles("BTC_USDT", []byte(`[["1700000000","1500.5","36010.2","36050","35990.1","36000"]]`))
+	assert(t, err != nil, "expected an error for a candle without base volume")
+
+	_, err = parseGateIOCandles("BTC_USDT", []byte(`{"label":"INVALID_CURRENCY_PAIR","message":"Invalid currency pair"}`))
+	assert(t, errors.Is(err, ErrSymbolNotFound), "gateio invalid pair should wrap ErrSymbolNotFound: %v", err)
+
+	equals(t, "BTC_USDT", NormalizeSymbol("gateio", "btc/usdt"))
+}
+
+func TestSleepDelayJitter(t *testing.T) {
+	defer func(delay, jitter time.Duration) { Delay, DelayJitter = delay, jitter }(Delay, DelayJitter)
+
+	// both in milliseconds
+	Delay, DelayJitter = 100, 0
+	equals(t, 100*time.Millisecond, jitteredDelay())
+
+	Delay, DelayJitter = 100, 50
+	shortest, longest := time.Hour, time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		d := jitteredDelay()
+		assert(t, d >= 50*time.Millisecond && d <= 150*time.Millisecond, "delay %v outside 100ms +/- 50ms", d)
+		shortest, longest = min(shortest, d), max(longest, d)
+	}
+	assert(t, shortest < 100*time.Millisecond && longest > 100*time.Millisecond, "no jitter in [%v, %v]", shortest, longest)
+
+	Delay, DelayJitter = 10, 50
+	for i := 0; i < 100; i++ {
+		assert(t, jitteredDelay() >= 0, "negative delay")
+	}
+
+	Delay, DelayJitter = 0, 1
+	began := time.Now()
+	SleepDelay()
+	assert(t, time.Since(began) < time.Second, "SleepDelay slept %v", time.Since(began))
+}
+
+func TestDownloadSymsWithErrors(t *testing.T) {
+	defer func(d time.Duration) { Delay = d }(Delay)
+	Delay = 0
+	defer Log.SetOutput(Log.Writer())
+	Log.SetOutput(io.Discard)
+
+	missing := errors.New("not found")
+	quotes, failed, err := downloadSyms([]string{"spy", "nope", "qqq"}, func(symbol string) (Quote, error) {
+		if symbol == "nope" {
+			return NewQuote("", 0), missing
+		}
+		return NewQuote(symbol, 1), nil
+	})
+	equals(t, "1 of 3 symbols failed", err.Error())
+	equals(t, 2, len(quotes))
+	equals(t, "qqq", quotes[1].Symbol)
+	equals(t, map[string]error{"nope": missing}, failed)
+
+	_, failed, err = downloadSyms([]string{"spy"}, func(symbol string) (Quote, error) {
+		return NewQuote(symbol, 1), nil
+	})
+	ok(t, err)
+	equals(t, 0, len(failed))
+}
+
+func TestLastCSVDate(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "spy.csv")
+
+	last, err := LastCSVDate(filename)
+	assert(t, os.IsNotExist(err), "expected not exist error, got %v", err)
+
+	q := NewQuote("spy", 2)
+	q.Date[0] = time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC)
+	q.Date[1] = time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	ok(t, q.WriteCSV(filename))
+
+	last, err = LastCSVDate(filename)
+	ok(t, err)
+	equals(t, q.Date[1], last)
+	equals(t, time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC), NextBarTime(last, Daily))
+}
+
+func TestBars(t *testing.T) {
+	q := NewQuote("spy", 2)
+	q.Date[1] = time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	q.Open[1], q.High[1], q.Low[1], q.Close[1], q.Volume[1] = 1, 2, 0.5, 1.5, 100
+
+	bars := q.Bars()
+	equals(t, 2, len(bars))
+	equals(t, Bar{Date: q.Date[1], Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 100}, bars[1])
+
+	sum := 0.0
+	q.ForEachBar(func(i int, b Bar) { sum += float64(i) * b.Close })
+	equals(t, 1.5, sum)
+}
+
+func TestCSVColumns(t *testing.T) {
+	q := NewQuote("spy", 2)
+	q.Date[0] = time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC)
+	q.Date[1] = time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	q.Close[0], q.Close[1] = 520.1, 521.25
+	q.Volume[0], q.Volume[1] = 100, 200
+
+	csv, err := q.CSVColumns([]string{"close", "datetime"})
+	ok(t, err)
+	equals(t, "close,datetime\n520.10,2024-05-09 00:00\n521.25,2024-05-10 00:00\n", csv)
+
+	_, err = q.CSVColumns([]string{"close", "adjclose"})
+	assert(t, err != nil, "expected error for unknown column")
+
+	filename := filepath.Join(t.TempDir(), "spy.csv")
+	ok(t, q.WriteCSVColumns(filename, []string{"datetime", "close"}))
+	data, err := os.ReadFile(filename)
+	ok(t, err)
+	equals(t, "datetime,close\n2024-05-09 00:00,520.10\n2024-05-10 00:00,521.25\n", string(data))
+}
+
+func TestParseBybitKlines(t *testing.T) {
+	body := `{"retCode":0,"retMsg":"OK","result":{"category":"spot","symbol":"BTCUSDT","list":[
+	["1700000060000","36010","36030","36005","36020","1.5","54030"],
+	["1700000000000","36000","36050","35990","36010","2.25","81022.5"]]}}`
+	q, err := parseBybitKlines("BTCUSDT", []byte(body))
+	ok(t, err)
+	equals(t, []time.Time{time.Unix(1700000000, 0).UTC(), time.Unix(1700000060, 0).UTC()}, q.Date)
+	equals(t, []float64{36000, 36010}, q.Open)
+	equals(t, []float64{36010, 36020}, q.Close)
+	equals(t, []float64{2.25, 1.5}, q.Volume)
+
+	_, err = parseBybitKlines("BTCUSDT", []byte(`{"retCode":10001,"retMsg":"Not supported symbols","result":{}}`))
+	assert(t, errors.Is(err, ErrSymbolNotFound), "bybit unknown symbol should wrap ErrSymbolNotFound: %v", err)
+
+	symbols, err := getBybitMarket("bybit", `{"retCode":0,"result":{"list":[{"symbol":"ETHUSDT","status":"Trading"},{"symbol":"OLDUSDT","status":"Closed"},{"symbol":"BTCUSDT","status":"Trading"}]}}`)
+	ok(t, err)
+	equals(t, []string{"BTCUSDT", "ETHUSDT"}, symbols)
+}
+
+func TestTiingoResampleFreq(t *testing.T) {
+	freqs := map[Period]string{
+		Min1: "1min", Min3: "3min", Min5: "5min", Min15: "15min", Min30: "30min",
+		Min60: "1hour", Hour2: "2hour", Hour4: "4hour", Hour6: "6hour", Hour8: "8hour", Hour12: "12hour",
+		Daily: "1day", Day3: "3day", Weekly: "7day", Monthly: "30day",
+	}
+	for _, period := range SupportedPeriods("tiingo-crypto") {
+		equals(t, freqs[period], tiingoResampleFreq(period))
+	}
+	equals(t, len(freqs), len(SupportedPeriods("tiingo-crypto")))
+}
+
+func TestTrueRange(t *testing.T) {
+	q := NewQuote("spy", 3)
+	q.High = []float64{10, 12, 9}
+	q.Low = []float64{8, 11, 7}
+	q.Close = []float64{9, 11.5, 8}
+
+	equals(t, []float64{2, 1, 2}, q.Range())
+	// bar 1 gaps up from 9, bar 2 gaps down from 11.5
+	equals(t, []float64{2, 3, 4.5}, q.TrueRange())
+}
+
+func TestParseTiingoFX(t *testing.T) {
+	body := `[{"date":"2019-06-24T00:00:00.000Z","ticker":"eurusd","open":1.1369,"high":1.1403,"low":1.1362,"close":1.1398},
+	{"date":"2019-06-25T00:00:00.000Z","ticker":"eurusd","open":1.1398,"high":1.1405,"low":1.1357,"close":1.1367}]`
+	q, err := parseTiingoFX("eurusd", []byte(body))
+	ok(t, err)
+	equals(t, time.Date(2019, 6, 25, 0, 0, 0, 0, time.UTC), q.Date[1])
+	equals(t, 1.1367, q.Close[1])
+	equals(t, false, q.HasVolume())
+	equals(t, "eurusd", NormalizeSymbol("tiingo-fx", "EUR/USD"))
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	defer func(d time.Duration) { ResponseHeaderTimeout = d }(ResponseHeaderTimeout)
+	ResponseHeaderTimeout = 20 * time.Millisecond
+
+	_, err := newClient().Get(srv.URL)
+	assert(t, err != nil && strings.Contains(err.Error(), "timeout awaiting response headers"), "expected header timeout, got %v", err)
+}
+
+func TestCSVSeparators(t *testing.T) {
+	defer func() { FieldSeparator, DecimalSeparator = ",", "." }()
+	FieldSeparator, DecimalSeparator = ";", ","
+
+	q := NewQuote("spy", 1)
+	q.Date[0] = time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	q.Open[0], q.High[0], q.Low[0], q.Close[0], q.Volume[0] = 520.5, 522, 519.25, 521.75, 1000
+
+	csv := q.CSV()
+	equals(t, "datetime;open;high;low;close;volume\n2024-05-10 00:00;520,50;522,00;519,25;521,75;1000,00\n", csv)
+
+	back, err := NewQuoteFromCSV("spy", csv)
+	ok(t, err)
+	equals(t, q.Close[0], back.Close[0])
+	equals(t, q.Date[0], back.Date[0])
+
+	qs, err := NewQuotesFromCSV(Quotes{q}.CSV())
+	ok(t, err)
+	equals(t, q.Low[0], qs[0].Low[0])
+}
+
+func TestSessionDaily(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tz database")
+	}
+	// US DST starts 2024-03-10, so the session opens at 14:30 UTC on the
+	// 8th and 13:30 UTC on the 11th
+	utc := func(day, hour, min int) time.Time { return time.Date(2024, 3, day, hour, min, 0, 0, time.UTC) }
+	q := NewQuote("spy", 6)
+	q.Date = []time.Time{
+		utc(8, 14, 0),  // pre-market
+		utc(8, 14, 30), // open
+		utc(8, 20, 59), // last minute
+		utc(11, 13, 30),
+		utc(11, 19, 0),
+		utc(11, 22, 0), // after hours
+	}
+	q.Open = []float64{1, 2, 3, 4, 5, 6}
+	q.High = []float64{10, 2, 3, 4, 9, 6}
+	q.Low = []float64{0, 2, 1, 4, 5, 6}
+	q.Close = []float64{1, 2, 3, 4, 5, 6}
+	q.Volume = []float64{100, 1, 1, 1, 1, 100}
+
+	d := q.SessionDaily(ny, "09:30", "16:00")
+	equals(t, []time.Time{time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)}, d.Date)
+	equals(t, []float64{2, 4}, d.Open)
+	equals(t, []float64{3, 9}, d.High)
+	equals(t, []float64{1, 4}, d.Low)
+	equals(t, []float64{3, 5}, d.Close)
+	equals(t, []float64{2, 2}, d.Volume)
+}
+
+func TestNasdaqMarketAsOf(t *testing.T) {
+	body := `{"data":{"asOf":"Last price as of Feb 7, 2025","headers":{},"rows":[{"symbol":"MSFT"},{"symbol":"AAPL"}]},"message":null,"status":{"rCode":200}}`
+	symbols, asOf, err := getNasdaqMarket("nasdaq", body)
+	ok(t, err)
+	equals(t, []string{"aapl", "msft"}, symbols)
+	equals(t, time.Date(2025, 2, 7, 0, 0, 0, 0, time.UTC), asOf)
+
+	_, asOf, err = getNasdaqMarket("nasdaq", `{"data":{"rows":[]}}`)
+	ok(t, err)
+	assert(t, asOf.IsZero(), "expected zero asOf, got %v", asOf)
+	assert(t, parseNasdaqAsOf("sometime").IsZero(), "expected zero asOf for unreadable date")
+}
+
+func TestCompactJSON(t *testing.T) {
+	q := NewQuote("spy", 30)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).AddDate(0, 0, bar)
+		q.Open[bar] = 470.12 + float64(bar)
+		q.High[bar] = 475.5
+		q.Low[bar] = 468.03
+		q.Close[bar] = 472.25
+		q.Volume[bar] = 81234567
+	}
+	data, err := q.CompactJSON()
+	ok(t, err)
+	assert(t, len(data) < len(q.JSON(false)), "compact json %d bytes not smaller than %d", len(data), len(q.JSON(false)))
+	assert(t, strings.Contains(string(data), `"date":[1704153600,86400,86400,`), "dates not delta encoded: %s", data)
+	assert(t, strings.Contains(string(data), `"close":[47225,47225,`), "prices not fixed point: %s", data)
+
+	back, err := NewQuoteFromCompactJSON(data)
+	ok(t, err)
+	equals(t, q.Symbol, back.Symbol)
+	for bar := range q.Date {
+		assert(t, q.Date[bar].Equal(back.Date[bar]), "bar %d date %v != %v", bar, q.Date[bar], back.Date[bar])
+	}
+	equals(t, q.Open, back.Open)
+	equals(t, q.Low, back.Low)
+	equals(t, q.Volume, back.Volume)
+
+	_, err = NewQuoteFromCompactJSON([]byte(`{"symbol":"x","date":[1,2],"open":[1]}`))
+	assert(t, err != nil, "expected error for ragged columns")
+	for _, bad := range []string{`{"precision":-1}`, `{"precision":400}`, `{"precision":2,"volume_precision":99}`} {
+		_, err = NewQuoteFromCompactJSON([]byte(bad))
+		assert(t, err != nil, "expected error for %s", bad)
+	}
+
+	// volume too large for the price precision gets a coarser one of its own
+	shib := NewQuote("shib-usd", 1)
+	shib.Date[0] = q.Date[0]
+	shib.Open[0], shib.High[0], shib.Low[0], shib.Close[0], shib.Volume[0] = 0.00001812, 0.0000185, 0.0000179, 0.00001831, 2.5e12
+	data, err = shib.CompactJSON()
+	ok(t, err)
+	back, err = NewQuoteFromCompactJSON(data)
+	ok(t, err)
+	equals(t, 2.5e12, back.Volume[0])
+	equals(t, shib.Close, back.Close)
+
+	shib.Close[0] = 1e300
+	_, err = shib.CompactJSON()
+	assert(t, err != nil, "expected error for a price that overflows")
+}
+
+func TestNewQuoteMultiSource(t *testing.T) {
+	defer func(d time.Duration) { Delay = d }(Delay)
+	Delay = 0
+	defer Log.SetOutput(Log.Writer())
+	Log.SetOutput(io.Discard)
+
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	source := func(closePrice float64, days ...int) SourceSpec {
+		return SourceSpec{Name: "test", Fetch: func(symbol, startDate, endDate string, period Period) (Quote, error) {
+			q := NewQuote(symbol, len(days))
+			for i, d := range days {
+				q.Date[i] = day(d)
+				q.Close[i] = closePrice
+			}
+			return q, nil
+		}}
+	}
+	failing := SourceSpec{Name: "down", Fetch: func(symbol, startDate, endDate string, period Period) (Quote, error) {
+		return NewQuote("", 0), errors.New("unavailable")
+	}}
+
+	// recent source first, older history from the second fills in before it
+	q, err := NewQuoteMultiSource("spy", "2024-01-01", "2024-01-10", Daily, []SourceSpec{source(2, 4, 5, 8), failing, source(1, 2, 3, 4, 6)})
+	ok(t, err)
+	equals(t, "spy", q.Symbol)
+	equals(t, []time.Time{day(2), day(3), day(4), day(5), day(6), day(8)}, q.Date)
+	equals(t, []float64{1, 1, 2, 2, 1, 2}, q.Close)
+
+	_, err = NewQuoteMultiSource("spy", "2024-01-01", "2024-01-10", Daily, []SourceSpec{failing, {Name: "nope"}})
+	assert(t, err != nil && strings.Contains(err.Error(), "unavailable") && strings.Contains(err.Error(), "invalid source 'nope'"), "unexpected error %v", err)
+}
+
+func TestHasNonPositivePrices(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		open, high, low, close float64
+		want                   bool
+	}{
+		{"positive", 1, 2, 0.5, 1.5, false},
+		{"zero open", 0, 2, 0.5, 1.5, true},
+		{"zero low", 1, 2, 0, 1.5, true},
+		{"negative high", 1, -2, 0.5, 1.5, true},
+		{"negative close", 1, 2, 0.5, -0.01, true},
+	} {
+		q := NewQuote("spy", 3)
+		for bar := range q.Close {
+			q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar] = 1, 2, 0.5, 1.5
+		}
+		q.Open[1], q.High[1], q.Low[1], q.Close[1] = tc.open, tc.high, tc.low, tc.close
+		assert(t, q.HasNonPositivePrices() == tc.want, "%s: want %v", tc.name, tc.want)
+	}
+	assert(t, !NewQuote("spy", 0).HasNonPositivePrices(), "expected no bars to be all positive")
+
+	// tiingo warns about split adjusted history that went to zero
+	var log strings.Builder
+	defer Log.SetOutput(Log.Writer())
+	Log.SetOutput(&log)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"date":"2024-01-02T00:00:00.000Z","open":2,"high":4,"low":1,"close":3,"volume":100,
+			"adjOpen":0,"adjHigh":0,"adjLow":0,"adjClose":0,"adjVolume":200,"divCash":0,"splitFactor":1}]`)
+	}))
+	defer srv.Close()
+	defer func(url string) { tiingoDailyURL = url }(tiingoDailyURL)
+	tiingoDailyURL = srv.URL
+	_, err := NewQuoteFromTiingo("spy", "2024-01-01", "2024-01-03", "token")
+	ok(t, err)
+	assert(t, strings.Contains(log.String(), "warning: tiingo symbol 'spy' has zero or negative adjusted prices"), "expected a warning, got %q", log.String())
+}
+
+func TestDetectSplits(t *testing.T) {
+	closes := []float64{100, 102, 51.5, 52, 50, 150.9, 151, 100.5}
+	q := NewQuote("abc", len(closes))
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2024, 3, 1+bar, 0, 0, 0, 0, time.UTC)
+		q.Open[bar], q.High[bar], q.Low[bar], q.Close[bar] = closes[bar], closes[bar], closes[bar], closes[bar]
+		q.Volume[bar] = 1000
+	}
+
+	// 2:1 split, then a 1:3 reverse split, then a 3:2 split
+	splits := q.DetectSplits(0.05)
+	equals(t, []Split{{q.Date[2], 2}, {q.Date[5], 1.0 / 3}, {q.Date[7], 1.5}}, splits)
+	equals(t, 0, len(q.DetectSplits(0.001)))
+
+	adj := q.AdjustForSplits(splits[0])
+	equals(t, []float64{50, 51, 51.5}, adj.Close[:3])
+	equals(t, []float64{2000, 2000, 1000}, adj.Volume[:3])
+	equals(t, 100.0, q.Close[0]) // original untouched
+}
+
+func TestSplitByYear(t *testing.T) {
+	q := NewQuote("spy", 5)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2022, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 200*bar)
+		q.Close[bar] = float64(bar)
+	}
+	years := q.SplitByYear()
+	equals(t, 4, len(years))
+	equals(t, []float64{0}, years[2022].Close)
+	equals(t, []float64{1}, years[2023].Close)
+	equals(t, []float64{2, 3}, years[2024].Close)
+
+	parts := Quotes{years[2024], years[2022], years[2025], years[2023], years[2024]}
+	flat, err := parts.Flatten()
+	ok(t, err)
+	equals(t, q.JSON(false), flat.JSON(false))
+
+	_, err = Quotes{q, NewQuote("qqq", 1)}.Flatten()
+	assert(t, err != nil, "expected error flattening different symbols")
+}
+
+func TestCheckSourceTiingo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"detail":"Invalid token."}`)
+			return
+		}
+		fmt.Fprint(w, `{"message":"You successfully sent a request"}`)
+	}))
+	defer srv.Close()
+	defer func(u string) { tiingoTestURL = u }(tiingoTestURL)
+	tiingoTestURL = srv.URL
+
+	ok(t, CheckSource("tiingo", "good"))
+	err := CheckSource("tiingo-crypto", "bad")
+	assert(t, err != nil && strings.Contains(err.Error(), "Invalid token."), "unexpected error %v", err)
+	assert(t, CheckSource("tiingo", "") != nil, "expected error without a token")
+	assert(t, CheckSource("nope", "") != nil, "expected error for an invalid source")
+}
+
+func TestTiingoChunks(t *testing.T) {
+	defer func(days int) { TiingoChunkDays = days }(TiingoChunkDays)
+	day := func(y, m, d int) time.Time { return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC) }
+
+	TiingoChunkDays = 10
+	equals(t, [][2]time.Time{{day(2024, 1, 1), day(2024, 1, 11)}, {day(2024, 1, 11), day(2024, 1, 21)}, {day(2024, 1, 21), day(2024, 1, 25)}},
+		tiingoChunks(day(2024, 1, 1), day(2024, 1, 25)))
+	equals(t, [][2]time.Time{{day(2024, 1, 1), day(2024, 1, 11)}}, tiingoChunks(day(2024, 1, 1), day(2024, 1, 11)))
+
+	TiingoChunkDays = 0
+	equals(t, [][2]time.Time{{day(1990, 1, 1), day(2024, 1, 1)}}, tiingoChunks(day(1990, 1, 1), day(2024, 1, 1)))
+
+	// the day both chunks cover is kept once
+	first, next := NewQuote("spy", 2), NewQuote("spy", 2)
+	first.Date[0], first.Date[1] = day(2024, 1, 10), day(2024, 1, 11)
+	next.Date[0], next.Date[1] = day(2024, 1, 11), day(2024, 1, 12)
+	next.Close[1] = 5
+	joined := tiingoJoin(first, next)
+	equals(t, []time.Time{day(2024, 1, 10), day(2024, 1, 11), day(2024, 1, 12)}, joined.Date)
+	equals(t, []float64{0, 0, 5}, joined.Close)
+}
+
+func TestAsOf(t *testing.T) {
+	q := NewQuote("spy", 3)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2024, 1, 2+2*bar, 0, 0, 0, 0, time.UTC)
+		q.Close[bar] = float64(bar)
+	}
+
+	_, found := q.AsOf(q.Date[0].Add(-time.Nanosecond))
+	equals(t, false, found)
+	b, found := q.AsOf(q.Date[0])
+	equals(t, true, found)
+	equals(t, 0.0, b.Close)
+	b, _ = q.AsOf(q.Date[1].Add(-time.Nanosecond))
+	equals(t, 0.0, b.Close)
+	b, _ = q.AsOf(q.Date[1])
+	equals(t, 1.0, b.Close)
+	b, _ = q.AsOf(q.Date[2].AddDate(1, 0, 0))
+	equals(t, q.Date[2], b.Date)
+
+	_, found = NewQuote("none", 0).AsOf(q.Date[0])
+	equals(t, false, found)
+}
+
+func TestIndicators(t *testing.T) {
+	q := NewQuote("spy", 6)
+	for bar, c := range []float64{1, 2, 3, 2, 4, 5} {
+		q.Date[bar] = time.Date(2024, 1, 2+bar, 0, 0, 0, 0, time.UTC)
+		q.Close[bar] = c
+	}
+
+	sma := q.Apply(SMA(3))
+	assert(t, math.IsNaN(sma[1]), "expected NaN before the window fills")
+	equals(t, []float64{2, 7.0 / 3, 3, 11.0 / 3}, sma[2:])
+
+	ema := q.Apply(EMA(3))
+	equals(t, []float64{2, 2, 3, 4}, ema[2:])
+
+	rsi := q.Apply(RSI(3))
+	assert(t, math.IsNaN(rsi[2]), "expected NaN before the window fills")
+	for bar, want := range map[int]float64{3: 200.0 / 3, 4: 100 - 100/(1+(2.0/3*2/3+2.0/3)/(1.0/3*2/3))} {
+		assert(t, math.Abs(rsi[bar]-want) < 1e-9, "rsi[%d] = %v, want %v", bar, rsi[bar], want)
+	}
+
+	fn, err := Indicator("SMA3")
+	ok(t, err)
+	equals(t, fmt.Sprint(sma), fmt.Sprint(q.Apply(fn)))
+	_, err = Indicator("sma")
+	assert(t, err != nil, "expected error without a period")
+	_, err = Indicator("macd12")
+	assert(t, err != nil, "expected error for an unknown indicator")
+
+	RegisterIndicator("double", func(period int) IndicatorFunc {
+		return func(q Quote) []float64 {
+			out := q.CloseColumn()
+			for i := range out {
+				out[i] *= float64(period)
+			}
+			return out
+		}
+	})
+	defer func() {
+		indicatorsMu.Lock()
+		delete(indicators, "double")
+		indicatorsMu.Unlock()
+	}()
+	assert(t, strings.Contains(strings.Join(Indicators(), ","), "double"), "registered indicator not listed")
+
+	csv, err := q.CSVColumns([]string{"close", "sma3", "double2"})
+	ok(t, err)
+	lines := strings.Split(csv, "\n")
+	equals(t, "close,sma3,double2", lines[0])
+	equals(t, "1.00,,2.00", lines[1])
+	equals(t, "3.00,2.00,6.00", lines[3])
+}
+
+func TestDownloadSymsConcurrent(t *testing.T) {
+	defer Log.SetOutput(Log.Writer())
+	Log.SetOutput(io.Discard)
+
+	var mu sync.Mutex
+	running, most := 0, 0
+	symbols := []string{"a", "b", "bad", "c", "d", "e"}
+	quotes, failed, err := downloadSymsConcurrent(symbols, 3, func(symbol string) (Quote, error) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if symbol == "bad" {
+			return NewQuote("", 0), errors.New("not found")
+		}
+		return NewQuote(symbol, 1), nil
+	})
+	equals(t, "1 of 6 symbols failed", err.Error())
+	equals(t, 1, len(failed))
+	var got []string
+	for _, q := range quotes {
+		got = append(got, q.Symbol)
+	}
+	equals(t, []string{"a", "b", "c", "d", "e"}, got)
+	assert(t, most > 1 && most <= 3, "expected up to 3 concurrent downloads, got %d", most)
+
+	var limiter rateLimiter
+	began := time.Now()
+	for i := 0; i < 4; i++ {
+		limiter.wait(100)
+	}
+	assert(t, time.Since(began) >= 30*time.Millisecond, "rate limiter didn't space requests")
+}
+
+func TestInferPeriod(t *testing.T) {
+	build := func(next func(time.Time) time.Time, bars int) Quote {
+		q := NewQuote("spy", bars)
+		date := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+		for bar := range q.Date {
+			q.Date[bar] = date
+			date = next(date)
+		}
+		return q
+	}
+	weekdays := func(t time.Time) time.Time {
+		t = t.AddDate(0, 0, 1)
+		for t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t
+	}
+
+	for _, tc := range []struct {
+		next func(time.Time) time.Time
+		want Period
+	}{
+		{func(t time.Time) time.Time { return t.Add(time.Minute) }, Min1},
+		{func(t time.Time) time.Time { return t.Add(15 * time.Minute) }, Min15},
+		{func(t time.Time) time.Time { return t.Add(4 * time.Hour) }, Hour4},
+		{weekdays, Daily},
+		{func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }, Weekly},
+		{func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }, Monthly},
+	} {
+		p, err := build(tc.next, 40).InferPeriod()
+		ok(t, err)
+		equals(t, tc.want, p)
+	}
+
+	// daily bars across a DST change are still daily
+	ny, err := time.LoadLocation("America/New_York")
+	ok(t, err)
+	q := NewQuote("spy", 10)
+	for bar := range q.Date {
+		q.Date[bar] = time.Date(2024, 3, 5+bar, 0, 0, 0, 0, ny)
+	}
+	p, err := q.InferPeriod()
+	ok(t, err)
+	equals(t, Daily, p)
+
+	irregular := []time.Duration{time.Minute, 7 * time.Minute, 2 * time.Hour, 13 * time.Minute, 3 * time.Hour}
+	i := 0
+	_, err = build(func(t time.Time) time.Time { i++; return t.Add(irregular[i%len(irregular)]) }, 20).InferPeriod()
+	assert(t, err != nil, "expected error for irregular bars")
+	_, err = build(func(t time.Time) time.Time { return t.Add(10 * time.Hour) }, 5).InferPeriod()
+	assert(t, err != nil, "expected error for a gap matching no period")
+	_, err = NewQuote("spy", 1).InferPeriod()
+	assert(t, err != nil, "expected error for a single bar")
+}
+
+func TestNewQuotesFromCSVStream(t *testing.T) {
+	csv := "\ufeffsymbol,datetime,open,high,low,close,volume\r\n" +
+		"spy,2024-01-02,1.00,2.00,0.50,1.50,100.00\r\n" +
+		"aapl,2024-01-02,3.00,4.00,2.50,3.50,200.00\r\n" +
+		"spy,2024-01-03,1.50,2.50,1.00,2.00,300.00\r\n" +
+		"bad,row\r\n"
+
+	quotes, err := NewQuotesFromCSVStream(strings.NewReader(csv))
+	ok(t, err)
+	want, err := NewQuotesFromCSV(csv)
+	ok(t, err)
+	equals(t, want, quotes)
+	equals(t, 2, len(quotes))
+	equals(t, "aapl", quotes[0].Symbol)
+	equals(t, []float64{1.5, 2}, quotes[1].Close)
+
+	filename := filepath.Join(t.TempDir(), "quotes.csv")
+	ok(t, os.WriteFile(filename, []byte(csv), 0644))
+	quotes, err = NewQuotesFromCSVFile(filename)
+	ok(t, err)
+	equals(t, want, quotes)
+}
+
+func TestLastFileDate(t *testing.T) {
+	dir := t.TempDir()
+	spy := NewQuote("spy", 2)
+	spy.Date[0] = time.Date(2024, 1, 2, 0, 0, 0, 0, Location)
+	spy.Date[1] = time.Date(2024, 1, 3, 0, 0, 0, 0, Location)
+	aapl := NewQuote("aapl", 1)
+	aapl.Date[0] = time.Date(2024, 1, 2, 0, 0, 0, 0, Location)
+
+	name := filepath.Join(dir, "spy.csv")
+	ok(t, spy.WriteCSV(name))
+	last, err := LastFileDate(name)
+	ok(t, err)
+	assert(t, last.Equal(spy.Date[1]), "csv last date %v", last)
+
+	name = filepath.Join(dir, "spy.json")
+	ok(t, spy.WriteJSON(name, false))
+	last, err = LastFileDate(name)
+	ok(t, err)
+	assert(t, last.Equal(spy.Date[1]), "json last date %v", last)
+
+	// several quotes give the earliest last date
+	name = filepath.Join(dir, "quotes.csv")
+	ok(t, Quotes{spy, aapl}.WriteCSV(name))
+	last, err = LastFileDate(name)
+	ok(t, err)
+	assert(t, last.Equal(aapl.Date[0]), "quotes csv last date %v", last)
+
+	name = filepath.Join(dir, "quotes.json")
+	ok(t, Quotes{spy, aapl}.WriteJSON(name, true))
+	last, err = LastFileDate(name)
+	ok(t, err)
+	assert(t, last.Equal(aapl.Date[0]), "quotes json last date %v", last)
+
+	_, err = LastFileDate(filepath.Join(dir, "missing.csv"))
+	assert(t, errors.Is(err, os.ErrNotExist), "expected not exist, got %v", err)
+}
+
+func TestSaveRawResponses(t *testing.T) {
+	body := `[[1704240000,1,3,2,2.5,100],[1704153600,1,3,2,2.5,100]]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	defer func(url, dir string) { CoinbaseBaseURL, SaveRawResponses = url, dir }(CoinbaseBaseURL, SaveRawResponses)
+	CoinbaseBaseURL = srv.URL
+	SaveRawResponses = t.TempDir()
+
+	_, err := NewQuoteFromCoinbase("BTC-USD", "2024-01-02", "2024-01-03", Daily)
+	ok(t, err)
+	files, err := filepath.Glob(filepath.Join(SaveRawResponses, "coinbase_BTC-USD_*.json"))
+	ok(t, err)
+	assert(t, len(files) > 0, "no raw response saved")
+	raw, err := os.ReadFile(files[0])
+	ok(t, err)
+	equals(t, body, string(raw))
+}
+
+func TestYahooIndex(t *testing.T) {
+	// ^VIX as yahoo returns it, with null volume and a bar without prices
+	body := `{"chart":{"result":[{"meta":{"symbol":"^VIX"},"timestamp":[1704205800,1704292200,1704378600],
+		"indicators":{"quote":[{"open":[13.21,null,14.2],"high":[14.23,null,14.5],"low":[13.1,null,13.9],"close":[13.2,null,14.1],"volume":[null,null,null]}],
+		"adjclose":[{"adjclose":[13.2,null,14.1]}]}}],"error":null}}`
+	q, err := parseYahooChart("^VIX", []byte(body), true)
+	ok(t, err)
+	equals(t, 2, len(q.Close))
+	equals(t, []float64{13.2, 14.1}, q.Close)
+	equals(t, []float64{0, 0}, q.Volume)
+	assert(t, !q.HasVolume(), "index has volume")
+
+	// no volume or adjclose at all
+	body = `{"chart":{"result":[{"timestamp":[1704205800],
+		"indicators":{"quote":[{"open":[4745.2],"high":[4754.33],"low":[4722.67],"close":[4742.83]}]}}]}}`
+	q, err = parseYahooChart("^GSPC", []byte(body), false)
+	ok(t, err)
+	equals(t, []float64{4742.83}, q.Close)
+
+	assert(t, IsIndex("^spx") && !IsIndex("spy"), "IsIndex")
+	spy := q
+	spy.Symbol = "spy"
+	assert(t, !spy.HasVolume(), "zero volume")
+
+	csv := q.CSV()
+	assert(t, strings.HasPrefix(csv, "datetime,open,high,low,close\n"), "volume column in %q", csv)
+	assert(t, !strings.Contains(csv, "volume"), "volume column in %q", csv)
+	r, err := NewQuoteFromCSV("^GSPC", csv)
+	ok(t, err)
+	equals(t, q.Close[0], r.Close[0])
+	equals(t, q.Open[0], r.Open[0])
+
+	// the multi-symbol layout keeps its volume column, empty for the index
+	spy.Volume[0] = 1000
+	rows := strings.Split(Quotes{q, spy}.CSV(), "\n")
+	assert(t, strings.HasSuffix(rows[1], ",4742.83,"), "index volume in %q", rows[1])
+	assert(t, strings.HasSuffix(rows[2], ",1000.00"), "missing volume in %q", rows[2])
+	qs, err := NewQuotesFromCSV(Quotes{q, spy}.CSV())
+	ok(t, err)
+	equals(t, 2, len(qs))
+
+	// appending an index to a file with a volume column keeps six fields
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "gspc.csv")
+	ok(t, os.WriteFile(filename, []byte("datetime,open,high,low,close,volume\n2024-01-01,1,1,1,1,0\n"), 0644))
+	ok(t, q.AppendCSV(filename))
+	contents, err := os.ReadFile(filename)
+	ok(t, err)
+	for _, row := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		equals(t, 6, len(strings.Split(row, ",")))
+	}
+
+	filename = filepath.Join(dir, "new.csv")
+	ok(t, q.AppendCSV(filename))
+	ok(t, q.AppendCSV(filename))
+	contents, err = os.ReadFile(filename)
+	ok(t, err)
+	equals(t, csv, string(contents))
+}
+
+func TestEODHD(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_token") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/eod/AAPL.US":
+			equals(t, "w", r.URL.Query().Get("period"))
+			fmt.Fprint(w, `[{"date":"2024-01-02","open":10,"high":12,"low":9,"close":11,"adjusted_close":5.5,"volume":1000},
+				{"date":"2024-01-09","open":11,"high":13,"low":10,"close":12,"adjusted_close":12,"volume":2000}]`)
+		case "/api/intraday/BRK-B.US":
+			equals(t, "5m", r.URL.Query().Get("interval"))
+			fmt.Fprint(w, `[{"timestamp":1704205800,"gmtoffset":0,"datetime":"2024-01-02 14:30:00","open":1,"high":2,"low":0.5,"close":1.5,"volume":100}]`)
+		case "/api/splits/AAPL.US":
+			fmt.Fprint(w, `[{"date":"2020-08-31","split":"4.000000/1.000000"}]`)
+		case "/api/div/AAPL.US":
+			fmt.Fprint(w, `[{"date":"2024-02-09","value":0.24}]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	defer func(url string) { EODHDBaseURL = url }(EODHDBaseURL)
+	EODHDBaseURL = srv.URL
+
+	q, err := NewQuoteFromEODHD("aapl", "2024-01-01", "2024-01-31", Weekly, "key")
+	ok(t, err)
+	equals(t, "AAPL.US", q.Symbol)
+	equals(t, []float64{5, 11}, q.Open)
+	equals(t, []float64{5.5, 12}, q.Close)
+	equals(t, []float64{1000, 2000}, q.Volume)
+	equals(t, time.Date(2024, 1, 9, 0, 0, 0, 0, Location), q.Date[1])
+
+	q, err = NewQuoteFromEODHD("BRK.B", "2024-01-02", "2024-01-03", Min5, "key")
+	ok(t, err)
+	equals(t, []float64{1.5}, q.Close)
+	equals(t, unixTime(1704205800), q.Date[0])
+
+	splits, err := NewSplitsFromEODHD("AAPL.US", "2020-01-01", "2024-01-01", "key")
+	ok(t, err)
+	equals(t, []Split{{Date: time.Date(2020, 8, 31, 0, 0, 0, 0, Location), Ratio: 4}}, splits)
+	dividends, err := NewDividendsFromEODHD("AAPL", "2024-01-01", "2024-12-31", "key")
+	ok(t, err)
+	equals(t, 0.24, dividends[0].Amount)
+
+	_, err = NewQuoteFromEODHD("AAPL.US", "2024-01-01", "2024-01-31", Daily, "bad")
+	assert(t, err != nil, "expected error for a bad token")
+	_, err = NewQuoteFromEODHD("AAPL.US", "2024-01-01", "2024-01-31", Min15, "key")
+	assert(t, err != nil, "expected error for an unsupported period")
+}
+
+func TestEODHDLimitGaps(t *testing.T) {
+	// hourly bars from 15:00 to 20:00 utc on weekdays only
+	var bars []time.Time
+	for d := 1; d <= 8; d++ {
+		for h := 15; h <= 20; h++ {
+			if bar := time.Date(2024, 1, d, h, 0, 0, 0, time.UTC); bar.Weekday() != time.Saturday && bar.Weekday() != time.Sunday {
+				bars = append(bars, bar)
+			}
+		}
+	}
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		from, _ := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+		to, _ := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+		var rows []string
+		for _, bar := range bars {
+			if bar.Unix() >= from && bar.Unix() <= to {
+				rows = append(rows, fmt.Sprintf(`{"timestamp":%d,"open":1,"high":2,"low":0.5,"close":%d,"volume":100}`, bar.Unix(), bar.Day()*100+bar.Hour()))
+			}
+		}
+		fmt.Fprint(w, "["+strings.Join(rows, ",")+"]")
+	}))
+	defer srv.Close()
+	defer func(url string, limit int) { EODHDBaseURL, Limit = url, limit }(EODHDBaseURL, Limit)
+	EODHDBaseURL, Limit = srv.URL, 5
+
+	// the last five bars reach back over the weekend to friday
+	q, err := NewQuoteFromEODHD("SPY.US", "2024-01-01", "2024-01-08 16:00", Min60, "key")
+	ok(t, err)
+	equals(t, []float64{518, 519, 520, 815, 816}, q.Close)
+	assert(t, requests < 10, "expected a few backward pages, got %d requests", requests)
+}
+
+func TestEveryN(t *testing.T) {
+	q := NewQuote("spy", 7)
+	for bar := range q.Close {
+		q.Date[bar] = time.Date(2024, 1, 1+bar, 0, 0, 0, 0, time.UTC)
+		q.Close[bar] = float64(bar)
+	}
+	equals(t, []float64{0, 3, 6}, q.EveryN(3).Close)
+	equals(t, q.Date[3], q.EveryN(3).Date[1])
+	equals(t, q.Close, q.EveryN(1).Close)
+	equals(t, 0, len(q.EveryN(0).Close))
+
+	thin := q.EveryN(2)
+	thin.Close[0] = 99
+	equals(t, 0.0, q.Close[0])
+}
+
+func TestVolumeProfileBins(t *testing.T) {
+	q := NewQuote("spy", 2)
+	q.Low[0], q.High[0], q.Volume[0] = 10, 20, 100
+	q.Low[1], q.High[1], q.Volume[1] = 15, 20, 50
+
+	bins := q.VolumeProfileBins(2)
+	equals(t, []VolumeBin{{PriceLow: 10, PriceHigh: 15, Volume: 50}, {PriceLow: 15, PriceHigh: 20, Volume: 100}}, bins)
+
+	total := 0.0
+	for _, bin := range q.VolumeProfileBins(7) {
+		total += bin.Volume
+	}
+	assert(t, math.Abs(total-150) < 1e-9, "volume not preserved: %v", total)
+	equals(t, 0, len(q.VolumeProfileBins(0)))
+	equals(t, 0, len(NewQuote("spy", 0).VolumeProfileBins(3)))
+}
+
+func TestErrUnsupportedPeriod(t *testing.T) {
+	from, to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	downloads := map[string]func() error{
+		"yahoo": func() error { _, err := NewQuoteFromYahoo("spy", "2024-01-01", "2024-01-02", Min1, true); return err },
+		"tiingo-crypto": func() error {
+			_, err := NewQuoteFromTiingoCrypto("btcusd", "2024-01-01", "2024-01-02", Period("2m"), "token")
+			return err
+		},
+		"tiingo-fx": func() error {
+			_, err := NewQuoteFromTiingoFX("eurusd", "2024-01-01", "2024-01-02", Hour2, "token")
+			return err
+		},
+		"coinbase": func() error { _, err := NewQuoteFromCoinbase("BTC-USD", "2024-01-01", "2024-01-02", Day3); return err },
+		"coinbase-advanced": func() error {
+			_, err := NewQuoteFromCoinbaseAdvanced("BTC-USD", "2024-01-01", "2024-01-02", Weekly)
+			return err
+		},
+		"deribit": func() error {
+			_, err := NewQuoteFromDeribit("BTC-PERPETUAL", "2024-01-01", "2024-01-02", Weekly)
+			return err
+		},
+		"gateio": func() error { _, err := NewQuoteFromGateIO("BTC_USDT", from, to, Min3); return err },
+		"bybit":  func() error { _, err := NewQuoteFromBybit("BTCUSDT", from, to, Hour8); return err },
+		"eodhd": func() error {
+			_, err := NewQuoteFromEODHD("AAPL.US", "2024-01-01", "2024-01-02", Min15, "key")
+			return err
+		},
+		"stream": func() error { return StreamCoinbase(context.Background(), "BTC-USD", Period("2m"), nil) },
+	}
+	for source, download := range downloads {
+		err := download()
+		assert(t, errors.Is(err, ErrUnsupportedPeriod), "%s: expected ErrUnsupportedPeriod, got %v", source, err)
+	}
+}
+
+func TestKrakenPairs(t *testing.T) {
+	var assetPairs int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/AssetPairs":
+			assetPairs++
+			fmt.Fprint(w, `{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","wsname":"XBT/USD"},"XETHZUSD":{"altname":"ETHUSD","wsname":"ETH/USD"}}}`)
+		case "/0/public/OHLC":
+			equals(t, "XXBTZUSD", r.URL.Query().Get("pair"))
+			equals(t, "1440", r.URL.Query().Get("interval"))
+			fmt.Fprint(w, `{"error":[],"result":{"XXBTZUSD":[
+				[1704067200,"42000.0","43000.0","41000.0","42500.0","42100.0","100.5",1000],
+				[1704153600,"42500.0","45000.0","42000.0","44900.0","44000.0","200.25",2000],
+				[1704240000,"44900.0","45500.0","44000.0","45000.0","44800.0","50",500]],"last":1704240000}}`)
+		}
+	}))
+	defer srv.Close()
+	defer func(url string) { KrakenBaseURL, krakenPairs = url, nil }(KrakenBaseURL)
+	KrakenBaseURL, krakenPairs = srv.URL, nil
+
+	for _, symbol := range []string{"XXBTZUSD", "XBTUSD", "XBT/USD", "btc/usd", "BTCUSD"} {
+		pair, err := krakenPair(symbol)
+		ok(t, err)
+		equals(t, "XXBTZUSD", pair)
+	}
+	equals(t, 1, assetPairs)
+	_, err := krakenPair("DOGEUSD")
+	assert(t, err != nil && strings.Contains(err.Error(), "not found"), "expected not found, got %v", err)
+
+	q, err := NewQuoteFromKraken("XBT/USD", time.Unix(1704067200, 0), time.Unix(1704153600, 0), Daily)
+	ok(t, err)
+	equals(t, "XXBTZUSD", q.Symbol)
+	equals(t, []float64{42500, 44900}, q.Close)
+	equals(t, []float64{100.5, 200.25}, q.Volume)
+	equals(t, unixTime(1704153600), q.Date[1])
+}
+
+func TestChartPNG(t *testing.T) {
+	q := NewQuote("spy", 2)
+	q.Open[0], q.High[0], q.Low[0], q.Close[0], q.Volume[0] = 10, 12, 9, 11, 100 // up
+	q.Open[1], q.High[1], q.Low[1], q.Close[1], q.Volume[1] = 11, 11.5, 8, 9, 50 // down
+
+	chart, err := q.ChartPNG(200, 100)
+	ok(t, err)
+	img, err := png.Decode(bytes.NewReader(chart))
+	ok(t, err)
+	equals(t, image.Rect(0, 0, 200, 100), img.Bounds())
+
+	colors := map[color.RGBA]bool{}
+	for x := 0; x < 200; x++ {
+		for y := 0; y < 100; y++ {
+			colors[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)] = true
+		}
+	}
+	assert(t, colors[color.RGBA{0x26, 0xa6, 0x9a, 0xff}], "no up candle")
+	assert(t, colors[color.RGBA{0xef, 0x53, 0x50, 0xff}], "no down candle")
+	assert(t, colors[color.RGBA{0x40, 0x40, 0x40, 0xff}], "no axis ticks or labels")
+
+	ticks, decimals := chartTicks(8, 12)
+	equals(t, []float64{8, 9, 10, 11, 12}, ticks)
+	equals(t, 0, decimals)
+	ticks, decimals = chartTicks(-0.04, 0.19)
+	equals(t, []float64{0, 0.05, 0.1, 0.15}, ticks)
+	equals(t, 2, decimals)
+	assert(t, !math.Signbit(ticks[0]), "expected 0, not -0")
+
+	// far more bars than pixels, no pixel column holds two candles
+	many := NewQuote("spy", 1000)
+	for bar := range many.Close {
+		many.Date[bar] = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, bar)
+		many.Open[bar], many.High[bar], many.Low[bar], many.Close[bar], many.Volume[bar] = 10, 12, 9, 11, 100
+		if bar%2 == 1 {
+			many.Open[bar], many.High[bar], many.Low[bar], many.Close[bar] = 21, 22, 19, 20
+		}
+	}
+	chart, err = many.ChartPNG(200, 100)
+	ok(t, err)
+	img, err = png.Decode(bytes.NewReader(chart))
+	ok(t, err)
+	for x := 0; x < 200; x++ {
+		candles := map[color.RGBA]bool{}
+		for y := 0; y < 100; y++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if c == (color.RGBA{0x26, 0xa6, 0x9a, 0xff}) || c == (color.RGBA{0xef, 0x53, 0x50, 0xff}) {
+				candles[c] = true
+			}
+		}
+		assert(t, len(candles) < 2, "up and down candles overlap in column %d", x)
+	}
+
+	filename := filepath.Join(t.TempDir(), "spy.png")
+	ok(t, q.WriteChartPNG(filename, 200, 100))
+	_, err = NewQuote("spy", 0).ChartPNG(200, 100)
+	assert(t, err != nil, "expected error for an empty quote")
+	_, err = q.ChartPNG(10, 10)
+	assert(t, err != nil, "expected error for a tiny chart")
+}
+
+func TestNormalize(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	q := NewQuote("spy", 4)
+	q.Date = []time.Time{day(3), day(1), day(3), day(2)}
+	q.Close = []float64{3, 1, 33, 2}
+	q.Volume = q.Volume[:3] // ragged
+
+	n := q.Normalize()
+	equals(t, []time.Time{day(1), day(3)}, n.Date)
+	equals(t, []float64{1, 33}, n.Close)
+	equals(t, 2, len(n.Volume))
+	equals(t, []time.Time{day(3), day(1), day(3), day(2)}, q.Date) // unchanged
+}
+
+func FuzzNormalize(f *testing.F) {
+	f.Add([]byte{3, 1, 3, 2, 9, 9, 0})
+	f.Add([]byte{})
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// one bar per byte, dated by its low bits so dates repeat
+		q := NewQuote("spy", len(data))
+		lastClose := map[int64]float64{}
+		for bar, b := range data {
+			q.Date[bar] = time.Unix(int64(b%16)*3600, 0)
+			q.Close[bar] = float64(bar)
+			lastClose[q.Date[bar].Unix()] = float64(bar)
+		}
+		if len(data) > 0 && data[0]%2 == 1 {
+			q.Open = q.Open[:len(data)/2] // ragged columns
+		}
+
+		n := q.Normalize()
+		bars := len(n.Date)
+		for _, col := range [][]float64{n.Open, n.High, n.Low, n.Close, n.Volume} {
+			if len(col) != bars {
+				t.Fatalf("columns differ in length: %d dates, %d values", bars, len(col))
+			}
+		}
+		for bar := 1; bar < bars; bar++ {
+			if !n.Date[bar-1].Before(n.Date[bar]) {
+				t.Fatalf("dates not strictly ascending at bar %d", bar)
+			}
+		}
+		if len(q.Open) == len(data) {
+			if bars != len(lastClose) {
+				t.Fatalf("%d bars for %d distinct dates", bars, len(lastClose))
+			}
+			for bar := range n.Date {
+				if n.Close[bar] != lastClose[n.Date[bar].Unix()] {
+					t.Fatalf("bar %d isn't the last of its duplicates", bar)
+				}
+			}
+		}
+		if !reflect.DeepEqual(n.Normalize(), n) {
+			t.Fatal("normalizing twice changed the quote")
+		}
+	})
+}
+
+func TestTiingoColumns(t *testing.T) {
+	var columns []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		columns = append(columns, r.URL.Query().Get("columns"))
+		if r.URL.Query().Get("columns") != "" {
+			fmt.Fprint(w, `[{"date":"2024-01-02T00:00:00.000Z","adjOpen":1,"adjHigh":2,"adjLow":0.5,"adjClose":1.5,"volume":100}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"date":"2024-01-02T00:00:00.000Z","open":2,"high":4,"low":1,"close":3,"volume":100,
+			"adjOpen":1,"adjHigh":2,"adjLow":0.5,"adjClose":1.5,"adjVolume":200,"divCash":0,"splitFactor":1}]`)
+	}))
+	defer srv.Close()
+	defer func(url string, on bool) { tiingoDailyURL, TiingoColumns = url, on }(tiingoDailyURL, TiingoColumns)
+	tiingoDailyURL = srv.URL
+
+	full, err := NewQuoteFromTiingo("spy", "2024-01-01", "2024-01-03", "token")
+	ok(t, err)
+	TiingoColumns = true
+	slim, err := NewQuoteFromTiingo("spy", "2024-01-01", "2024-01-03", "token")
+	ok(t, err)
+	equals(t, full, slim)
+	equals(t, []string{"", "date,adjOpen,adjHigh,adjLow,adjClose,volume"}, columns)
+
+	// unadjusted prices still need every column
+	_, raw, err := NewQuoteBothFromTiingo("spy", "2024-01-01", "2024-01-03", "token")
+	ok(t, err)
+	equals(t, []float64{3}, raw.Close)
+	equals(t, "", columns[2])
+}
+
+func TestGroupBy(t *testing.T) {
+	var quotes Quotes
+	for _, symbol := range []string{"msft", "aapl", "meta", "amzn", "nvda", "amd"} {
+		quotes = append(quotes, NewQuote(symbol, 1))
+	}
+	groups := quotes.GroupBy(func(q Quote) string { return q.Symbol[:1] })
+
+	symbols := func(q Quotes) []string {
+		var s []string
+		for _, quote := range q {
+			s = append(s, quote.Symbol)
+		}
+		return s
+	}
+	equals(t, 3, len(groups))
+	equals(t, []string{"msft", "meta"}, symbols(groups["m"]))
+	equals(t, []string{"aapl", "amzn", "amd"}, symbols(groups["a"]))
+	equals(t, []string{"nvda"}, symbols(groups["n"]))
+	equals(t, 0, len(Quotes{}.GroupBy(func(q Quote) string { return q.Symbol })))
+}
+
+func TestQuotesIndex(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	a := NewQuote("AAA", 3)
+	b := NewQuote("BBB", 3)
+	for i, d := range []int{1, 2, 3} {
+		a.Date[i], a.Open[i], a.High[i], a.Low[i], a.Close[i], a.Volume[i] = day(d), 10, 10, 10, float64(10+i*10), 1
+	}
+	for i, d := range []int{2, 3, 4} {
+		b.Date[i], b.Open[i], b.High[i], b.Low[i], b.Close[i], b.Volume[i] = day(d), 50, 50, 50, 50, 2
+	}
+
+	aligned := Quotes{a, b}.AlignDates()
+	equals(t, []time.Time{day(2), day(3)}, aligned[0].Date)
+	equals(t, []time.Time{day(2), day(3)}, aligned[1].Date)
+	equals(t, []float64{20, 30}, aligned[0].Close)
+
+	index, err := Quotes{a, b}.Index(nil)
+	ok(t, err)
+	equals(t, "INDEX", index.Symbol)
+	equals(t, []time.Time{day(2), day(3)}, index.Date)
+	equals(t, []float64{100, 125}, index.Close)
+	equals(t, []float64{3, 3}, index.Volume)
+
+	index, err = Quotes{a, b}.Index(map[string]float64{"AAA": 3, "BBB": 1})
+	ok(t, err)
+	equals(t, []float64{100, 137.5}, index.Close)
+
+	index, err = Quotes{a, b}.Index(map[string]float64{"AAA": 1})
+	ok(t, err)
+	equals(t, []float64{100, 200, 300}, index.Close)
+	equals(t, []float64{1, 1, 1}, index.Volume)
+
+	_, err = Quotes{a, b}.Index(map[string]float64{"CCC": 1})
+	assert(t, err != nil, "expected error for unknown symbol")
+	_, err = Quotes{a, b}.Index(map[string]float64{"AAA": 0})
+	assert(t, err != nil, "expected error for zero weights")
+	_, err = Quotes{}.Index(nil)
+	assert(t, err != nil, "expected error for no quotes")
+}
+
+func TestCrossings(t *testing.T) {
+	q := NewQuote("X", 8)
+	copy(q.Close, []float64{9, 11, 12, 10, 10, 8, 10, 11})
+	equals(t, []int{1, -5, 7}, q.Crossings(10))
+	assert(t, len(q.Crossings(20)) == 0, "no crossings expected above the range")
+	assert(t, len(NewQuote("X", 0).Crossings(10)) == 0, "no crossings expected for an empty quote")
+
+	// starting at the level, the first close off it sets the side
+	copy(q.Close, []float64{10, 12, 9, 9, 9, 9, 9, 9})
+	equals(t, []int{-2}, q.Crossings(10))
+}
+
+func TestTiingoSymsWithDeadline(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		symbol := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/prices")
+		requested = append(requested, symbol)
+		if symbol == "slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		fmt.Fprint(w, `[{"date":"2024-01-02T00:00:00.000Z","adjOpen":1,"adjHigh":2,"adjLow":0.5,"adjClose":1.5,"volume":100}]`)
+	}))
+	defer srv.Close()
+	defer func(url string, delay time.Duration) { tiingoDailyURL, Delay = url, delay }(tiingoDailyURL, Delay)
+	tiingoDailyURL, Delay = srv.URL, 0
+
+	quotes, err := NewQuotesFromTiingoSymsWithDeadline([]string{"fast", "slow", "never"}, "2024-01-01", "2024-01-03", "token", time.Now().Add(50*time.Millisecond))
+	assert(t, errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded, got %v", err)
+	equals(t, []string{"fast", "slow"}, requested)
+	equals(t, 2, len(quotes))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	quotes, err = NewQuotesFromTiingoSymsContext(ctx, []string{"fast"}, "2024-01-01", "2024-01-03", "token")
+	assert(t, errors.Is(err, context.Canceled), "expected canceled, got %v", err)
+	equals(t, 0, len(quotes))
+}
+
+func TestSymbolNotFound(t *testing.T) {
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		symbol := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/prices")
+		calls[symbol]++
+		switch {
+		case symbol == "gone":
+			http.NotFound(w, r)
+		case symbol == "locked":
+			http.Error(w, "bad token", http.StatusUnauthorized)
+		case symbol == "flaky" && calls[symbol] == 1:
+			http.Error(w, "busy", http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, `[{"date":"2024-01-02T00:00:00.000Z","adjOpen":1,"adjHigh":2,"adjLow":0.5,"adjClose":1.5,"volume":100}]`)
+		}
+	}))
+	defer srv.Close()
+	defer func(url string, delay time.Duration, retries int) {
+		tiingoDailyURL, Delay, Retries = url, delay, retries
+	}(tiingoDailyURL, Delay, Retries)
+	tiingoDailyURL, Delay, Retries = srv.URL, 0, 2
+
+	quotes, errs, err := NewQuotesFromTiingoSymsWithErrors([]string{"spy", "gone", "flaky"}, "2024-01-01", "2024-01-03", "token")
+	assert(t, err != nil, "expected a batch error")
+	equals(t, 2, len(quotes))
+	assert(t, errors.Is(errs["gone"], ErrSymbolNotFound), "expected not found, got %v", errs["gone"])
+	equals(t, []string{"gone"}, NotFound(errs))
+	equals(t, 1, calls["gone"])
+	equals(t, 2, calls["flaky"])
+
+	_, errs, _ = NewQuotesFromTiingoSymsWithErrors([]string{"locked"}, "2024-01-01", "2024-01-03", "token")
+	assert(t, errors.Is(errs["locked"], ErrUnauthorized), "expected unauthorized, got %v", errs["locked"])
+	equals(t, 1, calls["locked"])
+
+	coinbaseCalls := 0
+	cb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coinbaseCalls++
+		http.Error(w, `{"message":"NotFound"}`, http.StatusNotFound)
+	}))
+	defer cb.Close()
+	defer func(url string) { CoinbaseBaseURL = url }(CoinbaseBaseURL)
+	CoinbaseBaseURL = cb.URL
+
+	_, errs, _ = NewQuotesFromCoinbaseSymsWithErrors([]string{"NOPE-USD"}, "2024-01-01", "2024-01-03", Daily)
+	assert(t, errors.Is(errs["NOPE-USD"], ErrSymbolNotFound), "expected not found, got %v", errs["NOPE-USD"])
+	equals(t, 1, coinbaseCalls)
+
+	_, errs, _ = NewQuotesFromCoinbaseSymsWithErrors([]string{"BTC-USD"}, "2024-01-01", "2024-01-03", Day3)
+	assert(t, errors.Is(errs["BTC-USD"], ErrUnsupportedPeriod), "expected unsupported period, got %v", errs["BTC-USD"])
+	equals(t, 1, coinbaseCalls)
+
+	_, err = parseKrakenOHLC("NOPEUSD", []byte(`{"error":["EQuery:Unknown asset pair"]}`))
+	assert(t, errors.Is(err, ErrSymbolNotFound), "expected kraken not found, got %v", err)
+}
+
+func TestMergePreferred(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	old := NewQuote("BTC-USD", 3)
+	recent := NewQuote("BTC-USD", 2)
+	for i, d := range []int{1, 2, 3} {
+		old.Date[i], old.Close[i] = day(d), float64(d)
+	}
+	for i, d := range []int{3, 4} {
+		recent.Date[i], recent.Close[i] = day(d), float64(10*d)
+	}
+
+	m, err := old.MergePreferred(recent, false)
+	ok(t, err)
+	equals(t, []time.Time{day(1), day(2), day(3), day(4)}, m.Date)
+	equals(t, []float64{1, 2, 3, 40}, m.Close)
+
+	m, err = old.MergePreferred(recent, true)
+	ok(t, err)
+	equals(t, "BTC-USD", m.Symbol)
+	equals(t, []time.Time{day(1), day(2), day(3), day(4)}, m.Date)
+	equals(t, []float64{1, 2, 30, 40}, m.Close)
+
+	// a tiingo history stamped at new york midnight with a coinbase tail at utc midnight
+	ny := time.FixedZone("EST", -5*60*60)
+	tiingo := NewQuote("BTC-USD", 3)
+	for i, d := range []int{1, 2, 3} {
+		tiingo.Date[i], tiingo.Close[i] = time.Date(2024, 1, d, 0, 0, 0, 0, ny), float64(d)
+	}
+	m, err = tiingo.MergePreferred(recent, true)
+	ok(t, err)
+	equals(t, []float64{1, 2, 30, 40}, m.Close)
+	equals(t, day(3), m.Date[2])
+	m, err = tiingo.MergePreferred(recent, false)
+	ok(t, err)
+	equals(t, []float64{1, 2, 3, 40}, m.Close)
+
+	recent.Symbol = "ETH-USD"
+	_, err = old.MergePreferred(recent, true)
+	assert(t, err != nil, "expected error for different symbols")
+}
+
+func TestHash(t *testing.T) {
+	q := NewQuote("SPY", 2)
+	for i := range q.Close {
+		q.Date[i] = time.Date(2024, 1, i+1, 0, 0, 0, 0, time.UTC)
+		q.Open[i], q.High[i], q.Low[i], q.Close[i], q.Volume[i] = 1, 2, 0.5, 1.5, 100
+	}
+	h := q.Hash()
+	equals(t, 64, len(h))
+
+	same := NewQuote("SPY", 2)
+	same.Close = make([]float64, 2, 10)
+	for i := range same.Close {
+		same.Date[i] = q.Date[i].In(time.FixedZone("EST", -5*3600))
+		same.Open[i], same.High[i], same.Low[i], same.Close[i], same.Volume[i] = 1, 2, 0.5, 1.5, 100
+	}
+	same.Precision = 4
+	equals(t, h, same.Hash())
+
+	same.Close[1] = 1.6
+	assert(t, same.Hash() != h, "changed close should change the hash")
+	other := q.filter(func(int) bool { return true })
+	other.Symbol = "SPYX"
+	assert(t, other.Hash() != h, "changed symbol should change the hash")
+}
+
+func TestValidate(t *testing.T) {
+	q := NewQuote("SPY", 3)
+	for i := range q.Close {
+		q.Date[i] = time.Date(2024, 1, i+1, 0, 0, 0, 0, time.UTC)
+		q.Open[i], q.High[i], q.Low[i], q.Close[i], q.Volume[i] = 1, 2, 0.5, 1.5, 100
+	}
+	ok(t, q.Validate())
+
+	// a written csv reads back without an empty bar for the trailing newline
+	read, err := NewQuoteFromCSV("SPY", q.CSV())
+	ok(t, err)
+	equals(t, 3, len(read.Close))
+	ok(t, read.Validate())
+
+	bad := q.filter(func(int) bool { return true })
+	bad.High[1] = 1
+	bad.Volume[2] = -1
+	err = bad.Validate()
+	assert(t, err != nil && strings.Contains(err.Error(), "bar 1") && strings.Contains(err.Error(), "1 more"), "unexpected error %v", err)
+
+	bad = q.filter(func(int) bool { return true })
+	bad.Date[2] = bad.Date[1]
+	assert(t, bad.Validate() != nil, "expected error for repeated date")
+
+	bad = q.filter(func(int) bool { return true })
+	bad.Low[0] = math.NaN()
+	assert(t, bad.Validate() != nil, "expected error for NaN")
+
+	bad.Volume = bad.Volume[:2]
+	assert(t, bad.Validate() != nil, "expected error for short column")
+}
+
+func TestResampleQuarterlyYearly(t *testing.T) {
+	dates := []time.Time{
+		time.Date(2023, 12, 29, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 28, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 23, 59, 0, 0, time.UTC),
+		time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	q := NewQuote("SPY", len(dates))
+	for i, d := range dates {
+		q.Date[i] = d
+		q.Open[i], q.High[i], q.Low[i], q.Close[i], q.Volume[i] = float64(i+1), float64(i+2), float64(i), float64(i+1), 1
+	}
+
+	quarters, err := q.Resample(Quarterly)
+	ok(t, err)
+	equals(t, []time.Time{
+		time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+	}, quarters.Date)
+	equals(t, []float64{1, 2, 5, 6, 7}, quarters.Open)
+	equals(t, []float64{1, 4, 5, 6, 7}, quarters.Close)
+	equals(t, []float64{1, 3, 1, 1, 1}, quarters.Volume)
+
+	years, err := q.Resample(Yearly)
+	ok(t, err)
+	equals(t, []time.Time{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, years.Date)
+	equals(t, []float64{2, 8}, years.High)
+	equals(t, []float64{0, 1}, years.Low)
+
+	equals(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), NextBarTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Quarterly))
+	equals(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), NextBarTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Yearly))
+
+	p, err := quarters.InferPeriod()
+	ok(t, err)
+	equals(t, Quarterly, p)
+	p, err = years.InferPeriod()
+	ok(t, err)
+	equals(t, Yearly, p)
+}
+
+func TestZScore(t *testing.T) {
+	q := NewQuote("SPY", 4)
+	copy(q.Close, []float64{2, 4, 4, 6})
+	copy(q.Volume, []float64{5, 5, 5, 5})
+	z, err := q.ZScore("close")
+	ok(t, err)
+	for i, exp := range []float64{-math.Sqrt2, 0, 0, math.Sqrt2} {
+		assert(t, math.Abs(z[i]-exp) < 1e-12, "bar %d: expected %v, got %v", i, exp, z[i])
+	}
+
+	_, err = q.ZScore("volume")
+	assert(t, err != nil, "expected error for zero variance")
+	_, err = q.ZScore("adjclose")
+	assert(t, err != nil, "expected error for unknown field")
+	_, err = NewQuote("SPY", 0).ZScore("close")
+	assert(t, err != nil, "expected error for no bars")
+}
+
+func TestPadTo(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	q := NewQuote("NEW", 2)
+	for i, d := range []int{3, 4} {
+		q.Date[i], q.Open[i], q.High[i], q.Low[i], q.Close[i], q.Volume[i] = day(d), 1, 2, 0.5, float64(d), 10
+	}
+
+	p := q.PadTo([]time.Time{day(1), day(2), day(3), day(4)}, 0)
+	equals(t, []time.Time{day(1), day(2), day(3), day(4)}, p.Date)
+	equals(t, []float64{0, 0, 3, 4}, p.Close)
+	equals(t, []float64{0, 0, 10, 10}, p.Volume)
+	equals(t, []float64{3, 4}, q.Close)
+
+	p = q.PadTo([]time.Time{day(2), day(4)}, math.NaN())
+	assert(t, math.IsNaN(p.Open[0]) && math.IsNaN(p.Close[0]), "expected NaN padding")
+	equals(t, 4.0, p.Close[1])
+}
+
+func TestMEXC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, "/api/v3/klines", r.URL.Path)
+		if r.URL.Query().Get("symbol") != "BTCUSDT" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"code":-1121,"msg":"Invalid symbol."}`)
+			return
+		}
+		equals(t, "1d", r.URL.Query().Get("interval"))
+		fmt.Fprint(w, `[[1704067200000,"42000.1","43000","41000","42500.5","100.5",1704153599999,"4250000"],
+			[1704153600000,"42500.5","45000","42000","44900","200",1704239999999,"8980000"]]`)
+	}))
+	defer srv.Close()
+	defer func(url string) { MEXCBaseURL = url }(MEXCBaseURL)
+	MEXCBaseURL = srv.URL
+
+	q, err := NewQuoteFromMEXC("btc/usdt", time.UnixMilli(1704067200000), time.UnixMilli(1704153600000), Daily)
+	ok(t, err)
+	equals(t, "BTCUSDT", q.Symbol)
+	equals(t, []float64{42500.5, 44900}, q.Close)
+	equals(t, []float64{100.5, 200}, q.Volume)
+	equals(t, unixTime(1704153600), q.Date[1])
+
+	_, err = NewQuoteFromMEXC("NOPEUSDT", time.UnixMilli(1704067200000), time.UnixMilli(1704153600000), Daily)
+	assert(t, errors.Is(err, ErrSymbolNotFound), "expected not found, got %v", err)
+
+	// numbers instead of strings parse the same
+	k, err := parseBinanceStyleKlines([]byte(`[[1704067200000,1,2,0.5,1.5,10,1704153599999]]`))
+	ok(t, err)
+	equals(t, []float64{1.5}, k.Close)
+	_, err = parseBinanceStyleKlines([]byte(`[[1704067200000,"1","2"]]`))
+	assert(t, err != nil, "expected error for a short kline")
+}
+
+func TestCoinbasePeriods(t *testing.T) {
+	// every supported period is either a native granularity or resampled from one
+	for _, p := range SupportedPeriods("coinbase") {
+		_, native := coinbaseGranularities[p]
+		base, resampled := coinbaseResampled[p]
+		_, baseNative := coinbaseGranularities[base]
+		assert(t, native != (resampled && baseNative), "coinbase period %s has no candles", p)
+	}
+
+	var granularities []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		granularities = append(granularities, r.URL.Query().Get("granularity"))
+		// hourly candles, newest first: [time, low, high, open, close, volume]
+		fmt.Fprint(w, `[[1704164400,4,6,5,5.5,40],[1704160800,3,5,4,4.5,30],[1704157200,2,4,3,3.5,20],[1704153600,1,3,2,2.5,10]]`)
+	}))
+	defer srv.Close()
+	defer func(url string) { CoinbaseBaseURL = url }(CoinbaseBaseURL)
+	CoinbaseBaseURL = srv.URL
+
+	q, err := NewQuoteFromCoinbase("BTC-USD", "2024-01-02", "2024-01-02 04:00", Hour2)
+	ok(t, err)
+	equals(t, []string{"3600"}, granularities)
+	equals(t, []time.Time{unixTime(1704153600), unixTime(1704160800)}, q.Date)
+	equals(t, []float64{2, 4}, q.Open)
+	equals(t, []float64{4, 6}, q.High)
+	equals(t, []float64{3.5, 5.5}, q.Close)
+	equals(t, []float64{30, 70}, q.Volume)
+
+	_, err = NewQuoteFromCoinbase("BTC-USD", "2024-01-02", "2024-01-03", Day3)
+	assert(t, errors.Is(err, ErrUnsupportedPeriod), "expected unsupported period, got %v", err)
+}
+
+func TestMarketListDetailed(t *testing.T) {
+	body := `{"data":{"asOf":null,"headers":{},"rows":[
+		{"symbol":"MSFT","name":"Microsoft Corporation Common Stock","lastsale":"$409.72","marketCap":"3,045,472,612,800","sector":"Technology"},
+		{"symbol":"AAPL","name":"Apple Inc. Common Stock","lastsale":"$227.63","marketCap":"NA","sector":"Technology"}]},"status":{"rCode":200}}`
+	infos, _, err := getNasdaqInfo("nasdaq", body)
+	ok(t, err)
+	equals(t, []SymbolInfo{
+		{Symbol: "aapl", Name: "Apple Inc. Common Stock", Sector: "Technology", LastSale: 227.63},
+		{Symbol: "msft", Name: "Microsoft Corporation Common Stock", Sector: "Technology", MarketCap: 3045472612800, LastSale: 409.72},
+	}, infos)
+	symbols, _, err := getNasdaqMarket("nasdaq", body)
+	ok(t, err)
+	equals(t, []string{"aapl", "msft"}, symbols)
+
+	listing := "ACT Symbol|Security Name|Exchange|CQS Symbol|ETF|Round Lot Size|Test Issue|NASDAQ Symbol\r\n" +
+		"SPY|SPDR S&P 500 ETF Trust|P|SPY|Y|100|N|SPY\r\n" +
+		"IBM|International Business Machines Corporation|N|IBM|N|100|N|IBM\r\n" +
+		"DIA|SPDR Dow Jones Industrial Average ETF|P|DIA|Y|100|N|DIA\r\n" +
+		"ZZT|Test ETF|Z|ZZT|Y|100|Y|ZZT\r\n"
+	equals(t, []SymbolInfo{
+		{Symbol: "dia", Name: "SPDR Dow Jones Industrial Average ETF", Exchange: "NYSE Arca"},
+		{Symbol: "spy", Name: "SPDR S&P 500 ETF Trust", Exchange: "NYSE Arca"},
+	}, parseEtfInfo(listing))
+}
+
+func TestLimit(t *testing.T) {
+	q := NewQuote("SPY", 4)
+	copy(q.Close, []float64{1, 2, 3, 4})
+	equals(t, []float64{3, 4}, q.Tail(2).Close)
+	equals(t, []float64{1, 2, 3, 4}, q.Tail(10).Close)
+	equals(t, 0, len(q.Tail(0).Close))
+
+	var starts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		starts = append(starts, r.URL.Query().Get("start"))
+		fmt.Fprint(w, `[[1704240000,1,3,2,2.5,100],[1704153600,1,3,2,2.4,100],[1704067200,1,3,2,2.3,100]]`)
+	}))
+	defer srv.Close()
+	defer func(url string, limit int) { CoinbaseBaseURL, Limit = url, limit }(CoinbaseBaseURL, Limit)
+	CoinbaseBaseURL, Limit = srv.URL, 2
+
+	// five years of daily bars, but only the page with the last ones is requested
+	q, err := NewQuoteFromCoinbase("BTC-USD", "2019-01-04", "2024-01-04", Daily)
+	ok(t, err)
+	equals(t, []string{"2024-01-01T00:00:00Z"}, starts)
+	equals(t, []float64{2.4, 2.5}, q.Close)
+}
+
+func TestCoinbaseMaxBars(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+	defer func(url string, maxBars int, rps float64) {
+		CoinbaseBaseURL, CoinbaseMaxBars, CoinbaseRequestsPerSecond = url, maxBars, rps
+	}(CoinbaseBaseURL, CoinbaseMaxBars, CoinbaseRequestsPerSecond)
+	CoinbaseBaseURL, CoinbaseRequestsPerSecond = srv.URL, 0
+
+	// a year of daily bars is 4 pages of 100, or 2 of 300 when out of range
+	for maxBars, pages := range map[int]int{100: 4, 0: 2, -5: 2, 1000: 2} {
+		CoinbaseMaxBars, requests = maxBars, 0
+		_, err := NewQuoteFromCoinbase("BTC-USD", "2024-01-01", "2024-12-31", Daily)
+		ok(t, err)
+		equals(t, pages, requests)
+	}
+
+	_, err := pagedBars("BTC-USD", time.Now().Add(-time.Hour), time.Now(), time.Minute, 0, 0, func(startBar, endBar time.Time) (Quote, []byte, error) {
+		return NewQuote("BTC-USD", 0), nil, nil
+	})
+	assert(t, err != nil, "expected an error for empty pages")
+}
+
+func TestKeepRaw(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body string
+		if r.URL.Path == "/prices" {
+			body = `[{"ticker":"btcusd","priceData":[{"date":"2024-01-01T00:00:00Z","open":1,"high":2,"low":0.5,"close":1.5,"volume":10}]}]`
+		} else {
+			// one bar at the start of each coinbase page
+			start, _ := time.Parse(time.RFC3339, r.URL.Query().Get("start"))
+			body = fmt.Sprintf(`[[%d,1,3,2,2.5,100]]`, start.Unix())
+		}
+		bodies = append(bodies, body)
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	defer func(url, cryptoURL string, maxBars int, rps float64, keep bool) {
+		CoinbaseBaseURL, tiingoCryptoURL, CoinbaseMaxBars, CoinbaseRequestsPerSecond, KeepRaw = url, cryptoURL, maxBars, rps, keep
+	}(CoinbaseBaseURL, tiingoCryptoURL, CoinbaseMaxBars, CoinbaseRequestsPerSecond, KeepRaw)
+	CoinbaseBaseURL, tiingoCryptoURL, CoinbaseMaxBars, CoinbaseRequestsPerSecond = srv.URL, srv.URL, 2, 0
+
+	KeepRaw = false
+	q, err := NewQuoteFromTiingoCrypto("btcusd", "2024-01-01", "2024-01-02", Daily, "token")
+	ok(t, err)
+	assert(t, q.Raw == nil, "expected no raw response by default, got %q", q.Raw)
+	q, err = NewQuoteFromCoinbase("BTC-USD", "2024-01-01", "2024-01-06", Daily)
+	ok(t, err)
+	assert(t, q.Raw == nil, "expected no raw response by default, got %q", q.Raw)
+
+	KeepRaw, bodies = true, nil
+	q, err = NewQuoteFromTiingoCrypto("btcusd", "2024-01-01", "2024-01-02", Daily, "token")
+	ok(t, err)
+	equals(t, bodies[0], string(q.Raw))
+
+	// six daily bars in pages of three, the raw pages joined by newlines
+	bodies = nil
+	q, err = NewQuoteFromCoinbase("BTC-USD", "2024-01-01", "2024-01-06", Daily)
+	ok(t, err)
+	equals(t, 2, len(bodies))
+	equals(t, bodies[0]+"\n"+bodies[1]+"\n", string(q.Raw))
+	equals(t, 2, len(q.Close))
+}
+
+func TestCSVEpoch(t *testing.T) {
+	defer func(epoch string) { CSVEpoch = epoch }(CSVEpoch)
+	q := NewQuote("SPY", 2)
+	for i := range q.Close {
+		q.Date[i] = time.Date(2024, 1, 2+i, 14, 30, 0, 0, time.UTC)
+		q.Open[i], q.High[i], q.Low[i], q.Close[i], q.Volume[i] = 1, 2, 0.5, 1.5, 100
+	}
+
+	for unit, first := range map[string]string{"s": "1704205800,", "ms": "1704205800000,"} {
+		CSVEpoch = unit
+		csv := q.CSV()
+		assert(t, strings.HasPrefix(strings.Split(csv, "\n")[1], first), "%s: unexpected row in %q", unit, csv)
+		read, err := NewQuoteFromCSV("SPY", csv)
+		ok(t, err)
+		equals(t, len(q.Date), len(read.Date))
+		for i := range q.Date {
+			assert(t, read.Date[i].Equal(q.Date[i]), "%s: bar %d read back as %v", unit, i, read.Date[i])
+		}
+	}
+
+	CSVEpoch = ""
+	assert(t, strings.Contains(q.CSV(), "2024-01-02 14:30"), "expected formatted dates by default")
+}
+
+func TestNewSymbolsFromFileRaw(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "symbols.txt")
+	ok(t, os.WriteFile(filename, []byte("BTC-USD\r\n\n  XBTUSDt \nspy\n"), 0644))
+
+	raw, err := NewSymbolsFromFileRaw(filename)
+	ok(t, err)
+	equals(t, []string{"BTC-USD", "XBTUSDt", "spy"}, raw)
+
+	lower, err := NewSymbolsFromFile(filename)
+	ok(t, err)
+	equals(t, []string{"btc-usd", "xbtusdt", "spy"}, lower)
+}
+
+func TestCumulativeReturnDrawdown(t *testing.T) {
+	q := NewQuote("SPY", 5)
+	copy(q.Close, []float64{100, 110, 88, 99, 121})
+
+	cum := q.CumulativeReturn()
+	for i, exp := range []float64{0, 0.1, -0.12, -0.01, 0.21} {
+		assert(t, math.Abs(cum[i]-exp) < 1e-12, "bar %d: expected return %v, got %v", i, exp, cum[i])
+	}
+	dd := q.Drawdown()
+	for i, exp := range []float64{0, 0, 20, 10, 0} {
+		assert(t, math.Abs(dd[i]-exp) < 1e-9, "bar %d: expected drawdown %v, got %v", i, exp, dd[i])
+	}
+	equals(t, 0, len(NewQuote("SPY", 0).Drawdown()))
+}
+
+func TestRollingVolatility(t *testing.T) {
+	q := NewQuote("BTC-USD", 5)
+	for i, c := range []float64{100, 110, 100, 110, 100} {
+		q.Date[i] = time.Date(2024, 1, i+1, 0, 0, 0, 0, time.UTC)
+		q.Close[i] = c
+	}
+
+	vol := q.RollingVolatility(2, false)
+	assert(t, math.IsNaN(vol[0]) && math.IsNaN(vol[1]), "expected NaN before the window fills")
+	exp := math.Log(1.1) * math.Sqrt2
+	for bar := 2; bar < 5; bar++ {
+		assert(t, math.Abs(vol[bar]-exp) < 1e-12, "bar %d: expected %v, got %v", bar, exp, vol[bar])
+	}
+
+	annual := q.RollingVolatility(2, true)
+	assert(t, math.Abs(annual[4]-exp*math.Sqrt(365.25)) < 1e-9, "expected daily bars annualized by sqrt(365.25), got %v", annual[4])
+	assert(t, math.IsNaN(q.RollingVolatility(1, false)[4]), "expected NaN for a window under 2")
+}
+
+func TestDescribe(t *testing.T) {
+	q := NewQuote("spy", 4)
+	for bar, c := range []float64{10, 30, 20, 40} {
+		q.Date[bar] = time.Date(2024, 1, 2+bar, 0, 0, 0, 0, time.UTC)
+		q.Close[bar] = c
+	}
+	q.Volume[0], q.Volume[2] = 100, 50.5
+
+	stats := q.Describe()
+	equals(t, QuoteStats{Symbol: "spy", Start: q.Date[0], End: q.Date[3], Bars: 4,
+		MinClose: 10, MaxClose: 40, MeanClose: 25, TotalVolume: 150.5, ZeroVolumeBars: 2}, stats)
+	equals(t, "symbol:       spy\n"+
+		"bars:         4\n"+
+		"start:        2024-01-02 00:00\n"+
+		"end:          2024-01-05 00:00\n"+
+		"min close:    10.00\n"+
+		"max close:    40.00\n"+
+		"mean close:   25.00\n"+
+		"total volume: 150.50\n"+
+		"zero volume:  2\n", stats.String())
+
+	empty := NewQuote("btc-usd", 0).Describe()
+	equals(t, QuoteStats{Symbol: "btc-usd"}, empty)
+	equals(t, "symbol:       btc-usd\nbars:         0\n", empty.String())
+}
+
+func TestNewQuoteFromAmibrokerCSV(t *testing.T) {
+	q := NewQuote("SPY", 2)
+	for i := range q.Close {
+		q.Date[i] = time.Date(2024, 3, 4+i, 9, 30, 0, 0, Location)
+		q.Open[i], q.High[i], q.Low[i], q.Close[i], q.Volume[i] = 10, 12, 9, float64(11+i), 1000
+	}
+
+	r, err := NewQuoteFromAmibrokerCSV("SPY", q.Amibroker())
+	ok(t, err)
+	equals(t, q, r)
+
+	r, err = NewQuoteFromAmibrokerCSV("SPY", "date,time,open,high,low,close,volume\r\n20240304,16:00:00,1,2,0.5,1.5,7\r\n")
+	ok(t, err)
+	equals(t, []time.Time{time.Date(2024, 3, 4, 16, 0, 0, 0, Location)}, r.Date)
+	equals(t, []float64{1.5}, r.Close)
+
+	_, err = NewQuoteFromAmibrokerCSV("SPY", "date,time,open,high,low,close,volume\n2024-03-04,noon,1,2,0.5,1.5,7\n")
+	assert(t, err != nil, "expected error for a bad time")
+	_, err = NewQuoteFromAmibrokerCSV("SPY", "date,time,open,high,low,close,volume\n2024-03-04,09:30,1,2,0.5,1.5,7\n2024-03-05,09:30,1,2\n")
+	assert(t, err != nil, "expected error for a short row")
+	_, err = NewQuoteFromAmibrokerCSV("SPY", "date,time,open,high,low,close,volume\n2024-03-04,09:30,1,2,0.5,x,7\n")
+	assert(t, err != nil, "expected error for a bad number")
+
+	// the separators only apply to the generic csv writer
+	defer func(field, decimal string) { FieldSeparator, DecimalSeparator = field, decimal }(FieldSeparator, DecimalSeparator)
+	FieldSeparator, DecimalSeparator = ";", ","
+	q.Close[0] = 11.25
+	r, err = NewQuoteFromAmibrokerCSV("SPY", q.Amibroker())
+	ok(t, err)
+	equals(t, q, r)
+	rs, err := NewQuoteFromAmibrokerCSV("SPY", Quotes{q}.Amibroker())
+	assert(t, err != nil, "expected an error for the 8 column multi-symbol layout, got %d bars", len(rs.Close))
+}
+
+func TestTiingoCryptoFreq(t *testing.T) {
+	_, err := NewQuoteFromTiingoCryptoFreq("btcusd", "2024-01-01", "2024-01-02", " ", "token")
+	assert(t, err != nil, "expected error for an empty resampleFreq")
+
+	var freqs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, "/prices", r.URL.Path)
+		equals(t, "btcusd", r.URL.Query().Get("tickers"))
+		freqs = append(freqs, r.URL.Query().Get("resampleFreq"))
+		fmt.Fprint(w, `[{"ticker":"btcusd","priceData":[
+			{"date":"2024-01-01T00:00:00Z","open":1,"high":2,"low":0.5,"close":1.5,"volume":10},
+			{"date":"2024-01-01T01:30:00Z","open":1.5,"high":3,"low":1,"close":2.5,"volume":20}]}]`)
+	}))
+	defer srv.Close()
+	defer func(url string) { tiingoCryptoURL = url }(tiingoCryptoURL)
+	tiingoCryptoURL = srv.URL
+
+	// a frequency no Period has reaches the server as given
+	q, err := NewQuoteFromTiingoCryptoFreq("btcusd", "2024-01-01", "2024-01-02", "90min", "token")
+	ok(t, err)
+	equals(t, []string{"90min"}, freqs)
+	equals(t, []float64{1.5, 2.5}, q.Close)
+}
+
+func TestTiingoCryptoStatus(t *testing.T) {
+	status, requests := http.StatusUnauthorized, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+	defer func(url string) { tiingoCryptoURL = url }(tiingoCryptoURL)
+	tiingoCryptoURL = srv.URL
+
+	_, err := NewQuoteFromTiingoCrypto("btcusd", "2024-01-01", "2024-01-02", Daily, "token")
+	assert(t, errors.Is(err, ErrUnauthorized), "expected ErrUnauthorized, got %v", err)
+	equals(t, 1, requests)
+
+	status = http.StatusNotFound
+	_, err = NewQuoteFromTiingoCrypto("btcusd", "2024-01-01", "2024-01-02", Daily, "token")
+	assert(t, errors.Is(err, ErrSymbolNotFound), "expected ErrSymbolNotFound, got %v", err)
+}
+
+func TestMarketFileEmpty(t *testing.T) {
+	body, lastModified := "[]", ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lastModified != "" {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	defer func(url string) { CoinbaseBaseURL = url }(CoinbaseBaseURL)
+	CoinbaseBaseURL = srv.URL
+
+	filename := filepath.Join(t.TempDir(), "coinbase.txt")
+	ok(t, os.WriteFile(filename, []byte("BTC-USD"), 0644))
+	err := NewMarketFile("coinbase", filename)
+	assert(t, err != nil, "expected error for an empty market list")
+	raw, err := os.ReadFile(filename)
+	ok(t, err)
+	equals(t, "BTC-USD", string(raw))
+
+	body = `[{"id":"ETH-USD"},{"id":"BTC-USD"}]`
+	ok(t, NewMarketFile("coinbase", filename))
+	raw, err = os.ReadFile(filename)
+	ok(t, err)
+	equals(t, "BTC-USD\nETH-USD", string(raw))
+
+	// the sidecar only when the source says when the list is as of
+	ok(t, NewMarketFileWithMeta("coinbase", filename))
+	_, err = os.Stat(filename + ".asof")
+	assert(t, errors.Is(err, os.ErrNotExist), "unexpected asof sidecar: %v", err)
+
+	lastModified = "Tue, 02 Jan 2024 15:04:05 GMT"
+	ok(t, NewMarketFileWithMeta("coinbase", filename))
+	raw, err = os.ReadFile(filename + ".asof")
+	ok(t, err)
+	equals(t, "2024-01-02T15:04:05Z\n", string(raw))
+
+	body = "[]"
+	ok(t, os.Remove(filename+".asof"))
+	err = NewMarketFileWithMeta("coinbase", filename)
+	assert(t, err != nil, "expected error for an empty market list")
+	_, err = os.Stat(filename + ".asof")
+	assert(t, errors.Is(err, os.ErrNotExist), "asof written for an empty list: %v", err)
+}
+
+func TestTokenPoolRotate(t *testing.T) {
+	var used []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+		used = append(used, token)
+		switch token {
+		case "a":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "b":
+			fmt.Fprint(w, "You have run over your hourly request allocation")
+		default:
+			fmt.Fprint(w, `[{"date":"2024-01-02T00:00:00.000Z","open":2,"high":4,"low":1,"close":3,"volume":100,
+				"adjOpen":1,"adjHigh":2,"adjLow":0.5,"adjClose":1.5,"adjVolume":200,"divCash":0,"splitFactor":1}]`)
+		}
+	}))
+	defer srv.Close()
+	defer func(url string) { tiingoDailyURL = url }(tiingoDailyURL)
+	tiingoDailyURL = srv.URL
+
+	pool := NewTokenPool("a, b ,c")
+	equals(t, 3, pool.Len())
+	q, err := NewQuoteFromTiingoPool("spy", "2024-01-02", "2024-01-02", pool)
+	ok(t, err)
+	equals(t, []float64{1.5}, q.Close)
+	equals(t, []string{"a", "b", "c"}, used)
+	equals(t, "c", pool.Token())
+
+	_, err = NewQuoteFromTiingoPool("spy", "2024-01-02", "2024-01-02", NewTokenPool("a,b"))
+	assert(t, err != nil && strings.Contains(err.Error(), "rate limited"), "expected all tokens limited, got %v", err)
+}
+
+func TestMergeTimeZones(t *testing.T) {
+	ny := time.FixedZone("EST", -5*60*60)
+	tiingo := NewQuote("spy", 3)
+	for i, d := range []int{2, 3, 4} {
+		tiingo.Date[i], tiingo.Close[i] = time.Date(2024, 1, d, 0, 0, 0, 0, ny), float64(d)
+	}
+	coinbase := NewQuote("spy", 3)
+	for i, d := range []int{4, 5, 6} {
+		coinbase.Date[i], coinbase.Close[i] = time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC), float64(10*d)
+	}
+
+	m := tiingo.Merge(coinbase)
+	equals(t, []float64{2, 3, 4, 50, 60}, m.Close)
+	equals(t, tiingo.Date[2], m.Date[2])
+
+	// hourly bars still merge on the hour they fall in
+	hourly := NewQuote("spy", 2)
+	hourly.Date[0], hourly.Date[1] = time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	other := NewQuote("spy", 2)
+	other.Date[0], other.Date[1] = time.Date(2024, 1, 2, 5, 0, 0, 0, ny), time.Date(2024, 1, 2, 11, 0, 0, 0, time.UTC)
+	equals(t, 3, len(hourly.Merge(other).Close))
+}
+
+func TestSourceSpecDownload(t *testing.T) {
+	var got []string
+	spec := SourceSpec{Name: "test", Fetch: func(symbol, startDate, endDate string, period Period) (Quote, error) {
+		got = append(got, startDate, endDate)
+		return NewQuote(symbol, 0), nil
+	}}
+	_, err := spec.Download("spy", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 5, 14, 30, 0, 0, time.FixedZone("EST", -5*60*60)), Daily)
+	ok(t, err)
+	equals(t, []string{"2024-01-02", "2024-01-05 19:30"}, got)
+	equals(t, time.Date(2024, 1, 5, 19, 30, 0, 0, time.UTC), ParseDateString(got[1]))
+
+	_, err = SourceSpec{Name: "nope"}.Download("spy", time.Now(), time.Now(), Daily)
+	assert(t, err != nil, "expected error for an unknown source")
+}
@@ -0,0 +1,383 @@
+package quote
+
+import (
+	"bufio"
+	"context"
+	crand "crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CoinbaseStreamURL - Coinbase exchange websocket feed used by StreamCoinbase
+var CoinbaseStreamURL = "wss://ws-feed.exchange.coinbase.com"
+
+// BinanceStreamURL - Binance websocket stream base used by StreamBinance
+var BinanceStreamURL = "wss://stream.binance.com:9443/ws"
+
+// StreamCoinbase - live bars for a Coinbase product (BTC-USD), built from the
+// matches channel and sent on out as each period completes, until ctx is
+// cancelled. Periods without trades have no bar. Returns the ctx error once
+// cancelled, otherwise the connection or exchange error that ended the stream
+func StreamCoinbase(ctx context.Context, symbol string, period Period, out chan<- Bar) error {
+	symbol = NormalizeSymbol("coinbase", symbol)
+	subscribe, _ := json.Marshal(map[string]interface{}{
+		"type":        "subscribe",
+		"product_ids": []string{symbol},
+		"channels":    []string{"matches"},
+	})
+	return streamBars(ctx, CoinbaseStreamURL, subscribe, parseCoinbaseMatch, period, out)
+}
+
+// StreamBinance - live bars for a Binance spot pair (BTCUSDT), built from its
+// trade stream, see StreamCoinbase
+func StreamBinance(ctx context.Context, symbol string, period Period, out chan<- Bar) error {
+	symbol = strings.ToLower(NormalizeSymbol("binance", symbol))
+	return streamBars(ctx, BinanceStreamURL+"/"+symbol+"@trade", nil, parseBinanceTrade, period, out)
+}
+
+// streamTrade - one executed trade from an exchange stream
+type streamTrade struct {
+	time  time.Time
+	price float64
+	size  float64
+}
+
+// parseCoinbaseMatch - trade from a matches channel message, false for other messages
+func parseCoinbaseMatch(msg []byte) (streamTrade, bool, error) {
+	var m struct {
+		Type    string `json:"type"`
+		Time    string `json:"time"`
+		Price   string `json:"price"`
+		Size    string `json:"size"`
+		Message string `json:"message"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return streamTrade{}, false, err
+	}
+	switch m.Type {
+	case "error":
+		return streamTrade{}, false, fmt.Errorf("coinbase error: %s %s", m.Message, m.Reason)
+	case "match":
+		var trade streamTrade
+		var err error
+		if trade.time, err = time.Parse(time.RFC3339Nano, m.Time); err != nil {
+			return streamTrade{}, false, err
+		}
+		trade.price, _ = strconv.ParseFloat(m.Price, 64)
+		trade.size, _ = strconv.ParseFloat(m.Size, 64)
+		return trade, true, nil
+	}
+	return streamTrade{}, false, nil
+}
+
+// parseBinanceTrade - trade from a trade stream message, false for other messages
+func parseBinanceTrade(msg []byte) (streamTrade, bool, error) {
+	// json keys match fields case insensitively, so the event time E and
+	// trade id t need fields of their own to keep them out of e and T
+	var m struct {
+		Event     string `json:"e"`
+		EventTime int64  `json:"E"`
+		TradeID   int64  `json:"t"`
+		Time      int64  `json:"T"`
+		Price     string `json:"p"`
+		Qty       string `json:"q"`
+		Error     *struct {
+			Msg string `json:"msg"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return streamTrade{}, false, err
+	}
+	if m.Error != nil {
+		return streamTrade{}, false, fmt.Errorf("binance error: %s", m.Error.Msg)
+	}
+	if m.Event != "trade" {
+		return streamTrade{}, false, nil
+	}
+	trade := streamTrade{time: time.UnixMilli(m.Time)}
+	trade.price, _ = strconv.ParseFloat(m.Price, 64)
+	trade.size, _ = strconv.ParseFloat(m.Qty, 64)
+	return trade, true, nil
+}
+
+// how long after a bar's end trades still in flight are waited for
+var streamGrace = 2 * time.Second
+
+// streamBars - aggregate the trades of a websocket stream into bars of period
+func streamBars(ctx context.Context, url string, subscribe []byte, parse func([]byte) (streamTrade, bool, error), period Period, out chan<- Bar) error {
+
+	if periodDuration(period) == 0 {
+		return fmt.Errorf("%w: invalid period '%s'", ErrUnsupportedPeriod, period)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ws, err := wsDial(ctx, url)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ws.Close()
+	}()
+	if subscribe != nil {
+		if err := ws.writeFrame(wsText, subscribe); err != nil {
+			return err
+		}
+	}
+
+	trades := make(chan streamTrade)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := ws.readMessage()
+			if err == nil {
+				var trade streamTrade
+				var ok bool
+				trade, ok, err = parse(msg)
+				if err == nil && !ok {
+					continue
+				}
+				if err == nil {
+					select {
+					case trades <- trade:
+						continue
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			errc <- err
+			return
+		}
+	}()
+
+	acc := tradeBar{period: period}
+	var last time.Time       // start of the last bar sent
+	var end <-chan time.Time // fires once the open bar is complete
+	send := func(bar Bar) error {
+		end, last = nil, bar.Date
+		select {
+		case out <- bar:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		case <-end:
+			if bar, open := acc.flush(); open {
+				if err := send(bar); err != nil {
+					return err
+				}
+			}
+		case trade := <-trades:
+			t := trade.time.In(Location)
+			if !last.IsZero() && !periodStart(t, period).After(last) {
+				continue // too late for a bar already sent
+			}
+			if bar, done := acc.add(t, trade.price, trade.size); done {
+				if err := send(bar); err != nil {
+					return err
+				}
+			}
+			if end == nil {
+				end = time.After(time.Until(NextBarTime(acc.bar.Date, period)) + streamGrace)
+			}
+		}
+	}
+}
+
+// websocket opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// largest websocket message accepted
+const wsMaxMessage = 16 << 20
+
+// wsConn - minimal client side websocket (RFC 6455) connection
+type wsConn struct {
+	rw io.ReadWriteCloser
+	br *bufio.Reader
+	mu sync.Mutex // guards writes, pongs are sent from the reader
+}
+
+// wsDial - open a websocket through the shared transport, so proxies, the tls
+// config and dial timeouts apply as for any other request
+func wsDial(ctx context.Context, url string) (*wsConn, error) {
+	url = strings.Replace(url, "ws", "http", 1) // ws: -> http:, wss: -> https:
+
+	nonce := make([]byte, 16)
+	crand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	client := &http.Client{Transport: clientTransport()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("websocket upgrade failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		resp.Body.Close()
+		return nil, errors.New("websocket upgrade failed: bad Sec-WebSocket-Accept")
+	}
+	rw, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("websocket upgrade failed: connection not writable")
+	}
+	return &wsConn{rw: rw, br: bufio.NewReader(rw)}, nil
+}
+
+// wsAccept - Sec-WebSocket-Accept expected for a Sec-WebSocket-Key
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (c *wsConn) Close() error {
+	return c.rw.Close()
+}
+
+// writeFrame - send a single masked frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := make([]byte, 4)
+	crand.Read(mask)
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.rw.Write(frame)
+	return err
+}
+
+// readFrame - next frame's fin flag, opcode and unmasked payload
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode, masked := head[0]&0x80 != 0, head[0]&0x0f, head[1]&0x80 != 0
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		return false, 0, nil, fmt.Errorf("websocket frame of %d bytes too large", n)
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// readMessage - next text or binary message, answering pings and joining
+// fragments along the way. A close from the server is returned as io.EOF
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary, wsContinuation:
+			msg = append(msg, payload...)
+			if len(msg) > wsMaxMessage {
+				return nil, fmt.Errorf("websocket message of %d bytes too large", len(msg))
+			}
+		default:
+			return nil, fmt.Errorf("websocket opcode %d not supported", opcode)
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
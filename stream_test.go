@@ -0,0 +1,103 @@
+package quote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// server side websocket frame, unmasked
+func wsServerFrame(fin bool, opcode byte, payload string) []byte {
+	head := opcode
+	if fin {
+		head |= 0x80
+	}
+	return append([]byte{head, byte(len(payload))}, payload...)
+}
+
+func TestStreamCoinbase(t *testing.T) {
+	base := time.Now().UTC().Truncate(time.Minute).Add(10 * time.Minute)
+	match := func(at time.Duration, price, size string) string {
+		return fmt.Sprintf(`{"type":"match","product_id":"BTC-USD","price":"%s","size":"%s","time":"%s"}`,
+			price, size, base.Add(at).Format(time.RFC3339Nano))
+	}
+
+	subscribed := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := wsAccept(r.Header.Get("Sec-WebSocket-Key"))
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+		rw.Flush()
+
+		ws := &wsConn{rw: conn, br: rw.Reader}
+		_, _, sub, err := ws.readFrame()
+		if err != nil {
+			return
+		}
+		subscribed <- string(sub)
+
+		rw.Write(wsServerFrame(true, wsPing, "hi"))
+		rw.Flush()
+		if _, opcode, payload, err := ws.readFrame(); err != nil || opcode != wsPong || string(payload) != "hi" {
+			return
+		}
+
+		second := match(30*time.Second, "101", "2")
+		rw.Write(wsServerFrame(true, wsText, `{"type":"subscriptions"}`))
+		rw.Write(wsServerFrame(true, wsText, match(5*time.Second, "100", "1")))
+		rw.Write(wsServerFrame(false, wsText, second[:20])) // fragmented
+		rw.Write(wsServerFrame(true, wsContinuation, second[20:]))
+		rw.Write(wsServerFrame(true, wsText, match(40*time.Second, "99.5", "0.5")))
+		rw.Write(wsServerFrame(true, wsText, match(70*time.Second, "102", "1")))
+		rw.Flush()
+		ws.readFrame() // hold the connection open until the client goes
+	}))
+	defer srv.Close()
+	defer func(u string) { CoinbaseStreamURL = u }(CoinbaseStreamURL)
+	CoinbaseStreamURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan Bar)
+	done := make(chan error, 1)
+	go func() { done <- StreamCoinbase(ctx, "btc/usd", Min1, out) }()
+
+	select {
+	case bar := <-out:
+		assert(t, bar.Date.Equal(base), "bar date %v, want %v", bar.Date, base)
+		equals(t, Bar{Date: bar.Date, Open: 100, High: 101, Low: 99.5, Close: 99.5, Volume: 3.5}, bar)
+	case err := <-done:
+		t.Fatalf("stream ended early: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no bar received")
+	}
+	assert(t, strings.Contains(<-subscribed, `"product_ids":["BTC-USD"]`), "unexpected subscribe message")
+
+	cancel()
+	select {
+	case err := <-done:
+		equals(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not stopped by cancel")
+	}
+}
+
+func TestParseBinanceTrade(t *testing.T) {
+	trade, ok, err := parseBinanceTrade([]byte(`{"e":"trade","E":1718000000123,"s":"BTCUSDT","t":1,"p":"67000.50","q":"0.01","T":1718000000120,"m":true}`))
+	equals(t, nil, err)
+	equals(t, true, ok)
+	equals(t, streamTrade{time: time.UnixMilli(1718000000120), price: 67000.5, size: 0.01}, trade)
+
+	_, ok, err = parseBinanceTrade([]byte(`{"result":null,"id":1}`))
+	equals(t, false, ok)
+	equals(t, nil, err)
+	_, _, err = parseBinanceTrade([]byte(`{"error":{"code":2,"msg":"Invalid request"}}`))
+	assert(t, err != nil, "expected error message to be returned")
+}